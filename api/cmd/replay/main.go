@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"recommendation-engine/api/internal/cache"
+	"recommendation-engine/api/internal/database"
+	"recommendation-engine/api/internal/events"
+	"recommendation-engine/api/internal/features"
+	"recommendation-engine/api/internal/ingest"
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/rollup"
+	"recommendation-engine/api/internal/storage"
+	"recommendation-engine/api/internal/storage/sqlite"
+)
+
+// replay rebuilds the state derived from stored events by pushing them
+// through the same ingest.Pipeline live ingestion uses: the state snapshot
+// (counters, similarity data, trending), the hourly rollups, user
+// features, item popularity, sessions and users.last_active.
+//
+// The snapshot is written from scratch, but rollups, features and
+// popularity are added to. Replay only events those stores have not seen,
+// such as after losing Redis or for hours missing from the rollups, or
+// leave them out with -targets.
+//
+// Rollups and last_active go to the source database, or to -db with
+// -source=log. Features, popularity and sessions go to the Redis at -redis
+// and are skipped without one, since the API then keeps them in process.
+// -dry-run only rebuilds the state in memory.
+//
+//	go run ./cmd/replay -source=log -log=events.ndjson -from=2024-01-01T00:00:00Z
+//	go run ./cmd/replay -source=db -dry-run
+//	go run ./cmd/replay -source=sqlite -sqlite=recommendations.db -targets=state,rollups
+func main() {
+	source := flag.String("source", "log", "event source: log, db or sqlite")
+	logPath := flag.String("log", getEnv("EVENT_LOG_PATH", "events.ndjson"), "NDJSON event log to read when -source=log")
+	dsn := flag.String("db", getEnv("DATABASE_URL", ""), "Postgres DSN to read user_events from when -source=db, and to write rollups to when -source=log")
+	sqlitePath := flag.String("sqlite", getEnv("SQLITE_PATH", "recommendations.db"), "SQLite database to read user_events from when -source=sqlite")
+	redisURL := flag.String("redis", getEnv("REDIS_URL", ""), "Redis to rebuild features, popularity and sessions in")
+	targetList := flag.String("targets", strings.Join(allTargets, ","), "comma-separated stores to rebuild: "+strings.Join(allTargets, ", "))
+	fromStr := flag.String("from", "", "only replay events with event time at or after this RFC3339 time")
+	toStr := flag.String("to", "", "only replay events with event time before this RFC3339 time")
+	snapshot := flag.String("snapshot", getEnv("STATE_SNAPSHOT_PATH", "state.json"), "where to write the rebuilt state")
+	dryRun := flag.Bool("dry-run", false, "process events and report totals without writing anything")
+	every := flag.Int("progress", 10000, "report progress every N events")
+	flag.Parse()
+
+	from, err := parseTime(*fromStr)
+	if err != nil {
+		log.Fatalf("invalid -from: %v", err)
+	}
+	to, err := parseTime(*toStr)
+	if err != nil {
+		log.Fatalf("invalid -to: %v", err)
+	}
+	targets, err := parseTargets(*targetList)
+	if err != nil {
+		log.Fatalf("invalid -targets: %v", err)
+	}
+	if *dryRun {
+		targets = map[string]bool{"state": true}
+	}
+
+	state := events.NewState()
+	state.Policy, err = events.PolicyFromEnv()
+	if err != nil {
+		log.Fatalf("invalid event-time policy: %v", err)
+	}
+	pipeline := &ingest.Pipeline{State: state}
+	ctx := context.Background()
+
+	var db eventStore
+	switch *source {
+	case "log":
+		if *dsn != "" && (targets["rollups"] || targets["activity"]) {
+			db, err = database.NewPostgresDB(*dsn)
+		}
+	case "db":
+		if *dsn == "" {
+			log.Fatal("-db or DATABASE_URL is required when -source=db")
+		}
+		db, err = database.NewPostgresDB(*dsn)
+	case "sqlite":
+		db, err = sqlite.Open(*sqlitePath)
+	default:
+		log.Fatalf("unknown source %q (want log, db or sqlite)", *source)
+	}
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+	if db != nil {
+		defer db.Close()
+		pipeline.Categories = storage.NewCategories(db)
+		if targets["rollups"] {
+			pipeline.Rollups = rollup.NewAggregator(db, 2*state.Policy.AllowedLateness)
+		}
+		if targets["activity"] {
+			pipeline.Activity = ingest.NewActivityTracker(db)
+		}
+	} else if targets["rollups"] || targets["activity"] {
+		log.Println("⚠️  No database to write to (-db) - skipping rollups and last_active")
+	}
+
+	if targets["features"] || targets["popularity"] || targets["sessions"] {
+		if err := openRedisTargets(pipeline, *redisURL, targets); err != nil {
+			log.Fatalf("failed to set up Redis stores: %v", err)
+		}
+	}
+
+	start := time.Now()
+	var count, dropped int64
+
+	apply := func(e models.UserEvent) error {
+		if pipeline.Apply(ctx, e) == events.TooLate {
+			dropped++
+		}
+		count++
+		if *every > 0 && count%int64(*every) == 0 {
+			log.Printf("⏳ replayed %d events (%.0f/s), at %s",
+				count, float64(count)/time.Since(start).Seconds(), e.Timestamp.Format(time.RFC3339))
+			return flush(ctx, pipeline)
+		}
+		return nil
+	}
+
+	log.Printf("🔁 Replaying events from %s into %s", *source, strings.Join(pipelineTargets(pipeline), ", "))
+	if *source == "log" {
+		err = events.ReadLog(*logPath, from, to, apply)
+	} else {
+		err = db.ForEachUserEvent(ctx, from, to, apply)
+	}
+	if err == nil {
+		err = flush(ctx, pipeline)
+	}
+	if err != nil {
+		log.Fatalf("replay failed after %d events: %v", count, err)
+	}
+
+	log.Printf("✅ Replayed %d events in %s: %d users, %d items, %d impressions, %d clicks, %d late, %d dropped as too late",
+		count, time.Since(start).Round(time.Millisecond), len(state.Interactions),
+		len(state.Items), state.Impressions, state.Clicks, state.LateEvents, dropped)
+
+	if *dryRun {
+		log.Println("📝 Dry run - nothing written")
+		return
+	}
+	if !targets["state"] {
+		return
+	}
+	if err := state.Save(*snapshot); err != nil {
+		log.Fatalf("failed to write snapshot: %v", err)
+	}
+	log.Printf("💾 Wrote state snapshot to %s", *snapshot)
+}
+
+// allTargets are the stores replay can rebuild.
+var allTargets = []string{"state", "rollups", "features", "popularity", "sessions", "activity"}
+
+// eventStore is a database replay reads events from and writes rollups
+// and last_active to.
+type eventStore interface {
+	storage.Store
+	ForEachUserEvent(ctx context.Context, from, to time.Time, fn func(models.UserEvent) error) error
+	Close() error
+}
+
+func parseTargets(value string) (map[string]bool, error) {
+	targets := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, target := range allTargets {
+			known = known || target == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown target %q (want %s)", name, strings.Join(allTargets, ", "))
+		}
+		targets[name] = true
+	}
+	return targets, nil
+}
+
+// openRedisTargets adds the Redis-backed stores in targets to pipeline,
+// configured from the same environment variables as the API. Without a
+// Redis, or when the API is configured to keep them in process, they are
+// skipped.
+func openRedisTargets(pipeline *ingest.Pipeline, redisURL string, targets map[string]bool) error {
+	if backend := os.Getenv("CACHE_BACKEND"); redisURL == "" || backend == "memory" || backend == "off" {
+		log.Println("⚠️  The API keeps features, popularity and sessions in process - skipping them")
+		return nil
+	}
+	redisCache, err := cache.NewRedisCache(redisURL)
+	if err != nil {
+		return err
+	}
+
+	if targets["features"] {
+		config, err := features.ConfigFromEnv()
+		if err != nil {
+			return err
+		}
+		pipeline.Features = features.NewStore(redisCache, "redis", config)
+	}
+	if targets["popularity"] {
+		retention, err := cache.PopularityRetentionFromEnv()
+		if err != nil {
+			return err
+		}
+		pipeline.Popularity = redisCache.Popularity(retention)
+	}
+	if targets["sessions"] {
+		if os.Getenv("SESSION_STORE") == "memory" {
+			log.Println("⚠️  SESSION_STORE=memory - skipping sessions")
+			return nil
+		}
+		config, err := cache.SessionConfigFromEnv()
+		if err != nil {
+			return err
+		}
+		pipeline.Sessions = redisCache.Sessions(config)
+	}
+	return nil
+}
+
+// flush writes the buffered rollups and last_active updates.
+func flush(ctx context.Context, pipeline *ingest.Pipeline) error {
+	if pipeline.Rollups != nil {
+		if err := pipeline.Rollups.Flush(ctx); err != nil {
+			return fmt.Errorf("flushing rollups: %w", err)
+		}
+	}
+	if pipeline.Activity != nil {
+		if err := pipeline.Activity.Flush(ctx); err != nil {
+			return fmt.Errorf("flushing last_active: %w", err)
+		}
+	}
+	return nil
+}
+
+// pipelineTargets names the stores pipeline writes to.
+func pipelineTargets(pipeline *ingest.Pipeline) []string {
+	var names []string
+	for _, target := range []struct {
+		name string
+		set  bool
+	}{
+		{"state", pipeline.State != nil},
+		{"rollups", pipeline.Rollups != nil},
+		{"features", pipeline.Features != nil},
+		{"popularity", pipeline.Popularity != nil},
+		{"sessions", pipeline.Sessions != nil},
+		{"activity", pipeline.Activity != nil},
+	} {
+		if target.set {
+			names = append(names, target.name)
+		}
+	}
+	return names
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/rollup"
+)
+
+// Hourly item and category counters, flushed to the rollup tables
+var rollups = rollup.NewAggregator(store, 48*time.Hour)
+
+// Content analytics endpoint, read from the hourly rollups. ?hours= sets
+// the window (default 24, up to 30 days).
+func contentAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	from, to := analyticsWindow(r)
+
+	items, err := store.ItemRollups(r.Context(), from, to)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+	categoryRollups, err := store.CategoryRollups(r.Context(), from, to)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+	previous, err := store.CategoryRollups(r.Context(), from.Add(-to.Sub(from)), from)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+
+	trend := derived.TrendScores(time.Now())
+	var performance []ContentPerformance
+	var total models.RollupCounts
+	for _, item := range items {
+		performance = append(performance, contentPerformanceOf(item, trend[item.Key]))
+		total.Add(item.RollupCounts)
+	}
+
+	// Get top performing items (sorted by CTR)
+	topPerforming := make([]ContentPerformance, len(performance))
+	copy(topPerforming, performance)
+	sort.Slice(topPerforming, func(i, j int) bool {
+		return topPerforming[i].CTR > topPerforming[j].CTR
+	})
+	if len(topPerforming) > 10 {
+		topPerforming = topPerforming[:10]
+	}
+
+	// Get trending items (sorted by trend score)
+	trendingItems := make([]ContentPerformance, len(performance))
+	copy(trendingItems, performance)
+	sort.Slice(trendingItems, func(i, j int) bool {
+		return trendingItems[i].TrendScore > trendingItems[j].TrendScore
+	})
+	if len(trendingItems) > 5 {
+		trendingItems = trendingItems[:5]
+	}
+
+	// Get category performance, trending against the previous window
+	itemsPerCategory := make(map[string]int)
+	for _, item := range items {
+		itemsPerCategory[item.Category]++
+	}
+	previousClicks := make(map[string]int64)
+	for _, c := range previous {
+		previousClicks[c.Key] = c.Clicks
+	}
+	var categories []CategoryPerformance
+	for _, c := range categoryRollups {
+		categories = append(categories, CategoryPerformance{
+			Category:    c.Key,
+			TotalItems:  itemsPerCategory[c.Key],
+			TotalClicks: int(c.Clicks),
+			AvgCTR:      c.CTR(),
+			Trend:       trendOf(c.Clicks, previousClicks[c.Key]),
+		})
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].AvgCTR > categories[j].AvgCTR
+	})
+
+	analytics := ContentAnalytics{
+		TopPerforming: topPerforming,
+		Categories:    categories,
+		TrendingItems: trendingItems,
+		Summary: map[string]interface{}{
+			"total_items":       len(items),
+			"total_impressions": total.Impressions,
+			"total_clicks":      total.Clicks,
+			"overall_ctr":       total.CTR(),
+			"avg_duration":      total.AvgDwell(),
+			"window_start":      from,
+			"window_end":        to,
+			"last_updated":      time.Now(),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analytics)
+}
+
+// Content item detail endpoint: window totals, a daily history for the
+// last 7 days and items in the same category with similar CTR
+func contentItemDetailHandler(w http.ResponseWriter, r *http.Request) {
+	itemID := strings.TrimPrefix(r.URL.Path, "/content-analytics/")
+	if itemID == "" {
+		http.Error(w, `{"error": "Item ID required"}`, http.StatusBadRequest)
+		return
+	}
+
+	from, to := analyticsWindow(r)
+	items, err := store.ItemRollups(r.Context(), from, to)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+	var current *models.Rollup
+	for i := range items {
+		if items[i].Key == itemID {
+			current = &items[i]
+			break
+		}
+	}
+	if current == nil {
+		http.Error(w, `{"error": "Content item not found"}`, http.StatusNotFound)
+		return
+	}
+
+	history, err := dailyHistory(r.Context(), itemID, to)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+
+	trend := derived.TrendScores(time.Now())
+	perf := contentPerformanceOf(*current, trend[itemID])
+
+	var similar []ContentPerformance
+	for _, item := range items {
+		if item.Key != itemID && item.Category == current.Category {
+			similar = append(similar, contentPerformanceOf(item, trend[item.Key]))
+		}
+	}
+	sort.Slice(similar, func(i, j int) bool {
+		return math.Abs(similar[i].CTR-perf.CTR) < math.Abs(similar[j].CTR-perf.CTR)
+	})
+	if len(similar) > 3 {
+		similar = similar[:3]
+	}
+
+	conversion := 0.0
+	if current.Recommended > 0 {
+		conversion = float64(current.Clicks) / float64(current.Recommended)
+	}
+
+	response := map[string]interface{}{
+		"content_performance": perf,
+		"performance_history": history,
+		"similar_items":       similar,
+		"recommendation_impact": map[string]interface{}{
+			"times_recommended": current.Recommended,
+			"conversion_rate":   conversion,
+			"engagement_score":  perf.CTR * perf.AvgDuration,
+			"unique_users":      current.UniqueUsers,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// analyticsWindow returns the whole hours covered by ?hours=, ending with
+// the current hour.
+func analyticsWindow(r *http.Request) (time.Time, time.Time) {
+	hours := 24
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("hours")); err == nil && parsed > 0 && parsed <= 24*30 {
+		hours = parsed
+	}
+	to := time.Now().UTC().Truncate(time.Hour).Add(time.Hour)
+	return to.Add(-time.Duration(hours) * time.Hour), to
+}
+
+func dailyHistory(ctx context.Context, itemID string, to time.Time) ([]map[string]interface{}, error) {
+	end := to.Add(-time.Hour).Truncate(24 * time.Hour).Add(24 * time.Hour)
+	start := end.AddDate(0, 0, -7)
+	hourly, err := store.HourlyItemRollups(ctx, itemID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	days := make([]models.RollupCounts, 7)
+	for _, h := range hourly {
+		days[int(h.Hour.Sub(start)/(24*time.Hour))].Add(h.RollupCounts)
+	}
+
+	history := make([]map[string]interface{}, 0, len(days))
+	for i, day := range days {
+		history = append(history, map[string]interface{}{
+			"date":         start.AddDate(0, 0, i).Format("2006-01-02"),
+			"impressions":  day.Impressions,
+			"clicks":       day.Clicks,
+			"ctr":          day.CTR(),
+			"duration":     day.AvgDwell(),
+			"unique_users": day.UniqueUsers,
+		})
+	}
+	return history, nil
+}
+
+func contentPerformanceOf(item models.Rollup, trendScore float64) ContentPerformance {
+	title := item.Title
+	if title == "" {
+		title = item.Key
+	}
+	return ContentPerformance{
+		ItemID:      item.Key,
+		Title:       title,
+		Category:    item.Category,
+		Impressions: int(item.Impressions),
+		Clicks:      int(item.Clicks),
+		CTR:         item.CTR(),
+		AvgDuration: item.AvgDwell(),
+		TrendScore:  trendScore,
+		LastUpdated: time.Now(),
+	}
+}
+
+// trendOf compares clicks with the previous window; changes within 10% are
+// stable.
+func trendOf(current, previous int64) string {
+	switch {
+	case float64(current) > float64(previous)*1.1:
+		return "up"
+	case float64(current) < float64(previous)*0.9:
+		return "down"
+	default:
+		return "stable"
+	}
+}
+
+func writeAnalyticsError(w http.ResponseWriter, err error) {
+	log.Printf("Error reading rollups: %v", err)
+	http.Error(w, `{"error": "Failed to load analytics"}`, storageErrorStatus(err))
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"recommendation-engine/api/internal/cache"
+	"recommendation-engine/api/internal/features"
+	"recommendation-engine/api/internal/services"
+)
+
+// cacheBackendFromEnv returns CACHE_BACKEND (tiered, redis, memory or
+// off). It defaults to tiered when REDIS_URL is set and memory otherwise.
+func cacheBackendFromEnv() string {
+	if os.Getenv("REDIS_URL") != "" {
+		return getEnv("CACHE_BACKEND", "tiered")
+	}
+	return getEnv("CACHE_BACKEND", "memory")
+}
+
+// openCache returns the cache for backend, or nil for off. An unreachable
+// Redis falls back to the in-process LRU so the API still starts. The
+// tiered backend keeps local copies for at most LOCAL_CACHE_TTL.
+func openCache(backend string) (cache.Cache, error) {
+	maxEntries, err := strconv.Atoi(getEnv("CACHE_MAX_ENTRIES", "10000"))
+	if err != nil || maxEntries <= 0 {
+		return nil, fmt.Errorf("CACHE_MAX_ENTRIES: invalid size %q", os.Getenv("CACHE_MAX_ENTRIES"))
+	}
+
+	localTTL, err := time.ParseDuration(getEnv("LOCAL_CACHE_TTL", "30s"))
+	if err != nil || localTTL <= 0 {
+		return nil, fmt.Errorf("LOCAL_CACHE_TTL: invalid duration %q", os.Getenv("LOCAL_CACHE_TTL"))
+	}
+
+	switch backend {
+	case "redis", "tiered":
+		redisCache, err := cache.NewRedisCache(os.Getenv("REDIS_URL"))
+		if err != nil {
+			log.Printf("Warning: Redis unavailable, using in-process cache: %v", err)
+			cacheBackend = "memory"
+			return cache.NewLRU(maxEntries, cache.SystemClock), nil
+		}
+		redisCache.SetTimeouts(ops)
+		if backend == "redis" {
+			return redisCache, nil
+		}
+		tiered, err := cache.NewTiered(redisCache, cache.NewLRU(maxEntries, cache.SystemClock), localTTL)
+		if err != nil {
+			log.Printf("Warning: cache invalidation channel unavailable, using Redis only: %v", err)
+			cacheBackend = "redis"
+			return redisCache, nil
+		}
+		return tiered, nil
+	case "memory":
+		return cache.NewLRU(maxEntries, cache.SystemClock), nil
+	case "off":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown CACHE_BACKEND %q (want tiered, redis, memory or off)", backend)
+	}
+}
+
+// openPopularity returns windowed item counters kept in Redis when the
+// cache uses it and in process otherwise. They cover the last
+// POPULARITY_RETENTION (default 1h).
+func openPopularity(c cache.Cache) (cache.Popularity, error) {
+	retention, err := cache.PopularityRetentionFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := c.(type) {
+	case *cache.RedisCache:
+		return c.Popularity(retention), nil
+	case *cache.Tiered:
+		return c.Remote().Popularity(retention), nil
+	}
+	return cache.NewLocalPopularity(retention, cache.SystemClock), nil
+}
+
+// openFeatures returns the user feature store, in Redis when the cache
+// uses it and otherwise in an in-process LRU of FEATURE_MAX_USERS users
+// (default 100000). FEATURE_LAST_N, FEATURE_HALF_LIFE and FEATURE_TTL
+// override features.DefaultConfig. Reads are counted in cacheMetrics.
+func openFeatures(c cache.Cache) (*features.Store, error) {
+	config, err := features.ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := c.(type) {
+	case *cache.RedisCache:
+		return features.NewStore(cache.InstrumentUpdater(c, cacheMetrics), "redis", config), nil
+	case *cache.Tiered:
+		return features.NewStore(cache.InstrumentUpdater(c.Remote(), cacheMetrics), "redis", config), nil
+	}
+	maxUsers, err := strconv.Atoi(getEnv("FEATURE_MAX_USERS", "100000"))
+	if err != nil || maxUsers <= 0 {
+		return nil, fmt.Errorf("FEATURE_MAX_USERS: invalid size %q", os.Getenv("FEATURE_MAX_USERS"))
+	}
+	return features.NewStore(cache.InstrumentUpdater(cache.NewLRU(maxUsers, cache.SystemClock), cacheMetrics), "memory", config), nil
+}
+
+// openSessions returns the session store: in Redis when the cache uses it,
+// unless SESSION_STORE=memory, and otherwise in process. SESSION_GAP,
+// SESSION_HISTORY, SESSION_HISTORY_TTL and SESSION_MAX_ENDED override
+// cache.DefaultSessionConfig.
+func openSessions(c cache.Cache) (cache.Sessions, error) {
+	config, err := cache.SessionConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind := os.Getenv("SESSION_STORE"); kind {
+	case "", "redis":
+		switch c := c.(type) {
+		case *cache.RedisCache:
+			return c.Sessions(config), nil
+		case *cache.Tiered:
+			return c.Remote().Sessions(config), nil
+		}
+		if kind == "redis" {
+			return nil, fmt.Errorf("SESSION_STORE=redis needs the cache to use Redis (CACHE_BACKEND is %s)", cacheBackend)
+		}
+	case "memory":
+	default:
+		return nil, fmt.Errorf("SESSION_STORE: unknown store %q (want redis or memory)", kind)
+	}
+	return cache.NewLocalSessions(config, cache.SystemClock), nil
+}
+
+// endIdleSessionsPeriodically moves sessions nobody has returned to into
+// history, checking at least once a minute.
+func endIdleSessionsPeriodically() {
+	interval := userSessions.Config().Gap
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	for range time.Tick(interval) {
+		n, err := userSessions.EndIdle(context.Background())
+		if err != nil {
+			log.Printf("Warning: failed to end idle sessions: %v", err)
+		}
+		if n > 0 {
+			log.Printf("🕒 Ended %d idle sessions", n)
+		}
+	}
+}
+
+// Popular items: GET /popular?minutes=&category=&limit= returns the items
+// with the most weighted events over the last minutes (default 60, capped
+// at POPULARITY_RETENTION)
+func popularHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	minutes := 60
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("minutes")); err == nil && parsed > 0 {
+		minutes = parsed
+	}
+	limit := 10
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsed > 0 && parsed <= 100 {
+		limit = parsed
+	}
+	category := r.URL.Query().Get("category")
+
+	window := time.Duration(minutes) * time.Minute
+	if retention := popularity.Retention(); window > retention {
+		window = retention
+	}
+	items, err := popularity.Top(r.Context(), category, window, limit)
+	if err != nil {
+		log.Printf("Error reading item popularity: %v", err)
+		http.Error(w, `{"error": "Failed to load popular items"}`, storageErrorStatus(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"window_minutes": int(window / time.Minute),
+		"category":       category,
+		"items":          items,
+	})
+}
+
+// cacheTTLsFromEnv returns services.DefaultCacheTTLs overridden by
+// RECS_SOFT_TTL, RECS_HARD_TTL, RECS_LOCK_TTL and RECS_LOCK_WAIT.
+func cacheTTLsFromEnv() (services.CacheTTLs, error) {
+	ttls := services.DefaultCacheTTLs()
+	for _, setting := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"RECS_SOFT_TTL", &ttls.Soft},
+		{"RECS_HARD_TTL", &ttls.Hard},
+		{"RECS_LOCK_TTL", &ttls.Lock},
+		{"RECS_LOCK_WAIT", &ttls.LockWait},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return ttls, fmt.Errorf("%s: invalid duration %q", setting.name, value)
+		}
+		*setting.dst = d
+	}
+	if ttls.Hard < ttls.Soft {
+		return ttls, fmt.Errorf("RECS_HARD_TTL (%s) is shorter than RECS_SOFT_TTL (%s)", ttls.Hard, ttls.Soft)
+	}
+	return ttls, nil
+}
+
+// Cache invalidation: POST /cache/invalidate drops cached lists for a user,
+// lists containing any of the items, or lists from a strategy at a model
+// version (the current one by default)
+func cacheInvalidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		UserID       string   `json:"user_id"`
+		ItemIDs      []string `json:"item_ids"`
+		Strategy     string   `json:"strategy"`
+		ModelVersion string   `json:"model_version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	if req.UserID == "" && len(req.ItemIDs) == 0 && req.Strategy == "" {
+		http.Error(w, `{"error": "user_id, item_ids or strategy required"}`, http.StatusBadRequest)
+		return
+	}
+
+	result := map[string]interface{}{}
+	if req.UserID != "" {
+		if err := recommender.InvalidateUser(r.Context(), req.UserID); err != nil {
+			writeCacheError(w, err)
+			return
+		}
+		result["user_id"] = req.UserID
+	}
+	if len(req.ItemIDs) > 0 {
+		n, err := recommender.InvalidateItems(r.Context(), req.ItemIDs)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+		result["item_lists"] = n
+	}
+	if req.Strategy != "" {
+		if req.ModelVersion == "" {
+			req.ModelVersion = recommender.ModelVersion()
+		}
+		n, err := recommender.InvalidateStrategy(r.Context(), req.Strategy, req.ModelVersion)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+		result["strategy_lists"] = n
+		result["model_version"] = req.ModelVersion
+	}
+
+	log.Printf("🧽 CACHE INVALIDATED: %v", result)
+	writeJSON(w, http.StatusOK, result)
+}
+
+func writeCacheError(w http.ResponseWriter, err error) {
+	log.Printf("Error invalidating cache: %v", err)
+	http.Error(w, `{"error": "Failed to invalidate cache"}`, storageErrorStatus(err))
+}
+
+// warmerConfigFromEnv returns services.DefaultWarmerConfig overridden by
+// WARM_INTERVAL (0 disables scheduled runs), WARM_ACTIVE_WITHIN,
+// WARM_MAX_USERS, WARM_CONCURRENCY and WARM_RATE (lists per second up to
+// services.MaxWarmRate, 0 for no cap).
+func warmerConfigFromEnv() (services.WarmerConfig, error) {
+	config := services.DefaultWarmerConfig()
+	for _, setting := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"WARM_INTERVAL", &config.Interval},
+		{"WARM_ACTIVE_WITHIN", &config.ActiveWithin},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return config, fmt.Errorf("%s: invalid duration %q", setting.name, value)
+		}
+		*setting.dst = d
+	}
+	for _, setting := range []struct {
+		name string
+		dst  *int
+	}{
+		{"WARM_MAX_USERS", &config.MaxUsers},
+		{"WARM_CONCURRENCY", &config.Concurrency},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return config, fmt.Errorf("%s: invalid count %q", setting.name, value)
+		}
+		*setting.dst = n
+	}
+	if value := os.Getenv("WARM_RATE"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(rate >= 0 && rate <= services.MaxWarmRate) {
+			return config, fmt.Errorf("WARM_RATE: invalid rate %q (want 0 to %g)", value, services.MaxWarmRate)
+		}
+		config.RatePerSecond = rate
+	}
+	return config, nil
+}
+
+// Cache warming: GET /cache/warm reports the current or last run, POST
+// starts one
+func cacheWarmHandler(w http.ResponseWriter, r *http.Request) {
+	if warmer == nil {
+		http.Error(w, `{"error": "Cache warming needs a cache"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, warmer.Progress())
+	case http.MethodPost:
+		if err := warmer.Start("manual"); err != nil {
+			writeJSON(w, http.StatusConflict, map[string]interface{}{"error": err.Error(), "progress": warmer.Progress()})
+			return
+		}
+		writeJSON(w, http.StatusAccepted, warmer.Progress())
+	default:
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestWarmerConfigRate(t *testing.T) {
+	tests := []struct {
+		value string
+		rate  float64
+		valid bool
+	}{
+		{"", 50, true},
+		{"0", 0, true},
+		{"2.5", 2.5, true},
+		{"1000000", 1e6, true},
+		{"1e10", 0, false},
+		{"-1", 0, false},
+		{"NaN", 0, false},
+		{"Inf", 0, false},
+		{"fast", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("WARM_RATE", tt.value)
+			config, err := warmerConfigFromEnv()
+			if (err == nil) != tt.valid {
+				t.Fatalf("err = %v, want valid %v", err, tt.valid)
+			}
+			if tt.valid && config.RatePerSecond != tt.rate {
+				t.Errorf("rate = %v, want %v", config.RatePerSecond, tt.rate)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/services"
+	"recommendation-engine/api/internal/storage"
+)
+
+const maxBulkItems = 1000
+
+var catalog = services.NewCatalog(store)
+
+// setupCatalog wires catalog changes to the caches and indexes that hold
+// item data.
+func setupCatalog() {
+	catalog = services.NewCatalog(store)
+	catalog.OnChange(func(ctx context.Context, itemIDs []string) {
+		if _, err := recommender.InvalidateItems(ctx, itemIDs); err != nil {
+			log.Printf("Warning: failed to invalidate cached recommendations for %d items: %v", len(itemIDs), err)
+		}
+		itemCategories.Forget(itemIDs...)
+	})
+}
+
+// Catalog collection endpoint: GET lists items, POST creates one
+func itemsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		limit := 100
+		if parsed, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+		items, err := catalog.List(r.Context(), r.URL.Query().Get("category"), limit)
+		if err != nil {
+			writeCatalogError(w, err)
+			return
+		}
+		if items == nil {
+			items = []models.ContentItem{}
+		}
+		writeJSON(w, http.StatusOK, items)
+
+	case http.MethodPost:
+		var item models.ContentItem
+		if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		if err := catalog.Create(r.Context(), item); err != nil {
+			writeCatalogError(w, err)
+			return
+		}
+		writeStoredItem(w, r, item.ID, http.StatusCreated)
+
+	default:
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// Catalog item endpoint: GET, PUT and DELETE /items/{id}, plus
+// POST /items/bulk for bulk upserts
+func itemDetailHandler(w http.ResponseWriter, r *http.Request) {
+	itemID := strings.TrimPrefix(r.URL.Path, "/items/")
+	if itemID == "" {
+		http.Error(w, `{"error": "Item ID required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if itemID == "bulk" && r.Method == http.MethodPost {
+		bulkUpsertItems(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeStoredItem(w, r, itemID, http.StatusOK)
+
+	case http.MethodPut:
+		var item models.ContentItem
+		if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		if item.ID != "" && item.ID != itemID {
+			http.Error(w, `{"error": "Item ID in body does not match path"}`, http.StatusBadRequest)
+			return
+		}
+		item.ID = itemID
+		if err := catalog.Update(r.Context(), item); err != nil {
+			writeCatalogError(w, err)
+			return
+		}
+		writeStoredItem(w, r, itemID, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := catalog.Delete(r.Context(), itemID); err != nil {
+			writeCatalogError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+func bulkUpsertItems(w http.ResponseWriter, r *http.Request) {
+	var items []models.ContentItem
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	if len(items) > maxBulkItems {
+		http.Error(w, `{"error": "Too many items in one request"}`, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := catalog.Upsert(r.Context(), items); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "upserted",
+		"upserted": len(items),
+	})
+}
+
+func writeStoredItem(w http.ResponseWriter, r *http.Request, itemID string, status int) {
+	item, err := catalog.Get(r.Context(), itemID)
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	if item == nil {
+		http.Error(w, `{"error": "Content item not found"}`, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, status, item)
+}
+
+func writeCatalogError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidItem):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, `{"error": "Content item not found"}`, http.StatusNotFound)
+	case errors.Is(err, storage.ErrAlreadyExists):
+		http.Error(w, `{"error": "Content item already exists"}`, http.StatusConflict)
+	default:
+		log.Printf("Catalog error: %v", err)
+		http.Error(w, `{"error": "Catalog operation failed"}`, storageErrorStatus(err))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"math"
 	"math/rand"
 	"net/http"
 	"os"
@@ -12,6 +13,21 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"recommendation-engine/api/internal/abtest"
+	"recommendation-engine/api/internal/attribution"
+	"recommendation-engine/api/internal/cache"
+	"recommendation-engine/api/internal/database"
+	"recommendation-engine/api/internal/events"
+	"recommendation-engine/api/internal/ingest"
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/quality"
+	"recommendation-engine/api/internal/rollup"
+	"recommendation-engine/api/internal/services"
+	"recommendation-engine/api/internal/storage"
+	"recommendation-engine/api/internal/storage/memory"
+	"recommendation-engine/api/internal/storage/sqlite"
+	"recommendation-engine/api/internal/timeout"
 )
 
 // Add these structs with other type definitions
@@ -80,27 +96,52 @@ type AlgorithmState struct {
 	Explanation    string               `json:"explanation"`
 }
 
-// User Session structure
-type UserSession struct {
-	UserID      string    `json:"user_id"`
-	SessionID   string    `json:"session_id"`
-	StartTime   time.Time `json:"start_time"`
-	LastActive  time.Time `json:"last_active"`
-	PageViews   int       `json:"page_views"`
-	Clicks      int       `json:"clicks"`
-	SessionTime int       `json:"session_time"` // in seconds
-	Categories  []string  `json:"categories"`
-}
-
 // Add these global variables
 var (
-	contentPerformance = make(map[string]*ContentPerformance)
-	categoryPerformance = make(map[string]*CategoryPerformance)
-	userInteractions   = make(map[string][]string)
-	algorithmStates    = make(map[string]*AlgorithmState)
-	userSessions       = make(map[string]*UserSession)
+	algorithmStates = make(map[string]*AlgorithmState)
+)
+
+// Derived state built from the event stream. userInteractions aliases the
+// map inside derived.
+var (
+	derived          = events.NewState()
+	eventLog         *events.Log
+	userInteractions = derived.Interactions
+)
+
+// Event-quality filter and the events it has held back
+var (
+	eventFilter = quality.NewFilter(quality.DefaultConfig())
+	quarantine  = quality.NewQuarantineStore(1000)
+)
+
+// Served recommendation lists, kept for click attribution
+var impressions = attribution.NewTracker(30*time.Minute, 100000)
+
+// Storage backend chosen by STORAGE; see storageKindFromEnv
+var (
+	store        storage.Store    = memory.New()
+	storageKind                   = "memory"
+	cacheBackend                  = "off"
+	cacheMetrics                  = cache.NewMetrics()
+	popularity   cache.Popularity = cache.NewLocalPopularity(time.Hour, cache.SystemClock)
+	userSessions cache.Sessions   = cache.NewLocalSessions(cache.DefaultSessionConfig(), cache.SystemClock)
+	recommender                   = services.NewRecommender(store, nil)
+	activity                      = ingest.NewActivityTracker(store)
+	ops                           = timeout.NewTracker(timeout.DefaultConfig())
 )
 
+// Item categories, shared by ingestion and ranking so user features and
+// the items they boost agree
+var itemCategories *storage.Categories
+
+// Cache warmer, nil when there is no cache
+var warmer *services.Warmer
+
+// Stores every stored event is applied to; cmd/replay rebuilds them
+// through the same pipeline
+var ingestion *ingest.Pipeline
+
 // Global variables for live metrics
 var (
 	totalImpressions = 10000
@@ -136,305 +177,212 @@ var experiments = map[string]*Experiment{
 }
 
 func main() {
-	// Initialize random seed
-	rand.Seed(time.Now().UnixNano())
-
-	// For now, use simple version - we'll add database later
-	log.Println("🚀 Starting SIMPLE recommendation API on :8080")
-	log.Println("📝 Note: Using mock data - database integration pending")
-	
-	http.HandleFunc("/recommend", recommendHandler)
-	http.HandleFunc("/event", eventHandler) 
-	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/metrics", metricsHandler)
-	http.HandleFunc("/ab-tests", abTestsHandler)
-	http.HandleFunc("/ab-tests/", abTestDetailHandler)
-	http.HandleFunc("/engagement-metrics", engagementMetricsHandler)
-	http.HandleFunc("/user-sessions", userSessionsHandler)
-	http.HandleFunc("/user-sessions/", userSessionDetailHandler)
-	http.HandleFunc("/content-analytics", contentAnalyticsHandler)
-	http.HandleFunc("/content-analytics/", contentItemDetailHandler)
-	http.HandleFunc("/algorithm-visualization", algorithmVisualizationHandler)
-	http.HandleFunc("/algorithm-visualization/", algorithmVisualizationDetailHandler)
-
-	log.Fatal(http.ListenAndServe(":8080", nil))
-}
-
-// NEW: Content analytics endpoint
-func contentAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
-	// Generate mock data if empty
-	if len(contentPerformance) == 0 {
-		generateMockContentData()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(os.Args[2:])
+		return
 	}
 
-	// Update performance metrics
-	updateContentPerformance()
-
-	// Get top performing items (sorted by CTR)
-	var topPerforming []ContentPerformance
-	for _, perf := range contentPerformance {
-		topPerforming = append(topPerforming, *perf)
-	}
-	sort.Slice(topPerforming, func(i, j int) bool {
-		return topPerforming[i].CTR > topPerforming[j].CTR
-	})
-	if len(topPerforming) > 10 {
-		topPerforming = topPerforming[:10]
-	}
+	// Initialize random seed
+	rand.Seed(time.Now().UnixNano())
 
-	// Get trending items (sorted by trend score)
-	var trendingItems []ContentPerformance
-	for _, perf := range contentPerformance {
-		trendingItems = append(trendingItems, *perf)
+	// Restore derived state from the last snapshot (or a cmd/replay run)
+	snapshotPath := getEnv("STATE_SNAPSHOT_PATH", "state.json")
+	state, err := events.LoadState(snapshotPath)
+	if err != nil {
+		log.Fatalf("Failed to load state snapshot: %v", err)
 	}
-	sort.Slice(trendingItems, func(i, j int) bool {
-		return trendingItems[i].TrendScore > trendingItems[j].TrendScore
-	})
-	if len(trendingItems) > 5 {
-		trendingItems = trendingItems[:5]
+	derived = state
+	derived.Policy, err = events.PolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid event-time policy: %v", err)
 	}
+	userInteractions = derived.Interactions
+	go saveStatePeriodically(snapshotPath, 30*time.Second)
 
-	// Get category performance
-	var categories []CategoryPerformance
-	for _, cat := range categoryPerformance {
-		categories = append(categories, *cat)
+	if path := getEnv("EVENT_LOG_PATH", "events.ndjson"); path != "off" {
+		eventLog, err = events.OpenLog(path)
+		if err != nil {
+			log.Fatalf("Failed to open event log: %v", err)
+		}
+		defer eventLog.Close()
 	}
-	sort.Slice(categories, func(i, j int) bool {
-		return categories[i].AvgCTR > categories[j].AvgCTR
-	})
 
-	analytics := ContentAnalytics{
-		TopPerforming: topPerforming,
-		Categories:    categories,
-		TrendingItems: trendingItems,
-		Summary: map[string]interface{}{
-			"total_items":       len(contentPerformance),
-			"total_impressions": getTotalImpressions(),
-			"total_clicks":      getTotalClicks(),
-			"overall_ctr":       getOverallCTR(),
-			"avg_duration":      getAvgDuration(),
-			"last_updated":      time.Now(),
-		},
+	timeouts, err := timeout.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid timeouts: %v", err)
 	}
+	ops = timeout.NewTracker(timeouts)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(analytics)
-}
-
-// NEW: Content item detail endpoint
-func contentItemDetailHandler(w http.ResponseWriter, r *http.Request) {
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 3 {
-		http.Error(w, `{"error": "Item ID required"}`, http.StatusBadRequest)
-		return
+	erasureHashKey, err = erasureHashKeyFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid erasure settings: %v", err)
 	}
-	
-	itemID := pathParts[2]
-	perf, exists := contentPerformance[itemID]
-	if !exists {
-		http.Error(w, `{"error": "Content item not found"}`, http.StatusNotFound)
-		return
-	}
-
-	// Generate performance history
-	performanceHistory := generatePerformanceHistory(itemID)
 
-	response := map[string]interface{}{
-		"content_performance": perf,
-		"performance_history": performanceHistory,
-		"similar_items":       findSimilarItems(itemID),
-		"recommendation_impact": map[string]interface{}{
-			"times_recommended": rand.Intn(1000) + 100,
-			"conversion_rate":   perf.CTR * 0.8,
-			"engagement_score":  perf.CTR * perf.AvgDuration,
-		},
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-func generateMockContentData() {
-	items := []struct {
-		ID       string
-		Title    string
-		Category string
-	}{
-		{"tech_ai_news", "AI Breakthrough in Healthcare", "technology"},
-		{"science_space", "Mars Mission Latest Updates", "science"},
-		{"business_trends", "Market Analysis Q4 2024", "business"},
-		{"health_wellness", "New Fitness Study Results", "health"},
-		{"entertainment_pop", "Award Show Highlights", "entertainment"},
-		{"tech_blockchain", "Blockchain in Supply Chain", "technology"},
-		{"science_climate", "Climate Change Research", "science"},
-		{"business_startup", "Startup Funding Trends", "business"},
-		{"health_mental", "Mental Wellness Strategies", "health"},
-		{"entertainment_gaming", "Gaming Industry Updates", "entertainment"},
-	}
-
-	for _, item := range items {
-		impressions := 1000 + rand.Intn(5000)
-		clicks := 50 + rand.Intn(impressions/2)
-		ctr := float64(clicks) / float64(impressions)
-		
-		contentPerformance[item.ID] = &ContentPerformance{
-			ItemID:      item.ID,
-			Title:       item.Title,
-			Category:    item.Category,
-			Impressions: impressions,
-			Clicks:      clicks,
-			CTR:         ctr,
-			AvgDuration: 30 + rand.Float64()*120,
-			TrendScore:  rand.Float64(),
-			LastUpdated: time.Now(),
+	storageKind = storageKindFromEnv()
+	switch storageKind {
+	case "postgres":
+		db, err := database.NewPostgresDB(os.Getenv("DATABASE_URL"))
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
 		}
-
-		// Update category performance
-		if _, exists := categoryPerformance[item.Category]; !exists {
-			categoryPerformance[item.Category] = &CategoryPerformance{
-				Category:    item.Category,
-				TotalItems:  0,
-				TotalClicks: 0,
-				AvgCTR:      0,
-				Trend:       "stable",
+		defer db.Close()
+		db.SetTimeouts(ops)
+		replicaDSNs, replicaPolicy, err := database.ReplicaPolicyFromEnv()
+		if err != nil {
+			log.Fatalf("Invalid replica settings: %v", err)
+		}
+		if err := db.AddReplicas(replicaDSNs, replicaPolicy); err != nil {
+			log.Fatalf("Failed to configure read replicas: %v", err)
+		}
+		if err := migrateOnStart(storageKind, db.DB); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+		if schemaVersion >= partitionedSchemaVersion {
+			policy, err := database.PartitionPolicyFromEnv()
+			if err != nil {
+				log.Fatalf("Invalid partition policy: %v", err)
 			}
+			go maintainPartitions(db, policy, time.Hour)
 		}
-	}
-}
-
-func updateContentPerformance() {
-	for _, perf := range contentPerformance {
-		// Simulate live data changes
-		impressionChange := rand.Intn(50)
-		clickChange := rand.Intn(20)
-		
-		perf.Impressions += impressionChange
-		perf.Clicks += clickChange
-		perf.CTR = float64(perf.Clicks) / float64(perf.Impressions)
-		perf.AvgDuration += rand.Float64()*10 - 5
-		if perf.AvgDuration < 10 {
-			perf.AvgDuration = 10
+		store = db
+	case "sqlite":
+		db, err := sqlite.Open(getEnv("SQLITE_PATH", "recommendations.db"))
+		if err != nil {
+			log.Fatalf("Failed to open SQLite database: %v", err)
 		}
-		perf.TrendScore = rand.Float64()
-		perf.LastUpdated = time.Now()
-	}
-
-	// Update category aggregates
-	for category := range categoryPerformance {
-		updateCategoryPerformance(category)
-	}
-}
-
-func updateCategoryPerformance(category string) {
-	var totalItems, totalClicks, totalImpressions int
-	var totalCTR float64
-
-	for _, perf := range contentPerformance {
-		if perf.Category == category {
-			totalItems++
-			totalClicks += perf.Clicks
-			totalImpressions += perf.Impressions
-			totalCTR += perf.CTR
+		defer db.Close()
+		db.SetTimeouts(ops)
+		if err := migrateOnStart(storageKind, db.DB); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
 		}
-	}
-
-	if totalItems > 0 {
-		categoryPerformance[category].TotalItems = totalItems
-		categoryPerformance[category].TotalClicks = totalClicks
-		categoryPerformance[category].AvgCTR = totalCTR / float64(totalItems)
-		
-		// Simple trend calculation
-		if rand.Float64() > 0.7 {
-			categoryPerformance[category].Trend = "up"
-		} else if rand.Float64() < 0.3 {
-			categoryPerformance[category].Trend = "down"
-		} else {
-			categoryPerformance[category].Trend = "stable"
+		store = db
+	case "memory":
+	default:
+		log.Fatalf("Unknown STORAGE %q (want memory, postgres or sqlite)", storageKind)
+	}
+	cacheBackend = cacheBackendFromEnv()
+	appCache, err := openCache(cacheBackend)
+	if err != nil {
+		log.Fatalf("Failed to set up cache: %v", err)
+	}
+	popularity, err = openPopularity(appCache)
+	if err != nil {
+		log.Fatalf("Failed to set up item popularity: %v", err)
+	}
+	userSessions, err = openSessions(appCache)
+	if err != nil {
+		log.Fatalf("Failed to set up user sessions: %v", err)
+	}
+	go endIdleSessionsPeriodically()
+	recommender = services.NewRecommender(store, cache.Instrument(appCache, cacheMetrics))
+	recommender.SetCacheMetrics(cacheMetrics)
+	recommender.SetPopularity(popularity)
+	userFeatures, err := openFeatures(appCache)
+	if err != nil {
+		log.Fatalf("Failed to set up user features: %v", err)
+	}
+	recommender.SetFeatures(userFeatures)
+	itemCategories = storage.NewCategories(store)
+	recommender.SetCategories(itemCategories)
+	if appCache != nil {
+		warmerConfig, err := warmerConfigFromEnv()
+		if err != nil {
+			log.Fatalf("Invalid cache warming settings: %v", err)
 		}
+		warmer = services.NewWarmer(recommender, store, warmerConfig)
 	}
-}
-
-func generatePerformanceHistory(itemID string) []map[string]interface{} {
-	var history []map[string]interface{}
-	baseCTR := contentPerformance[itemID].CTR
-	
-	for i := 6; i >= 0; i-- {
-		date := time.Now().AddDate(0, 0, -i)
-		variation := rand.Float64()*0.1 - 0.05 // ±5% variation
-		history = append(history, map[string]interface{}{
-			"date":        date.Format("2006-01-02"),
-			"impressions": contentPerformance[itemID].Impressions/7 + rand.Intn(100),
-			"clicks":      contentPerformance[itemID].Clicks/7 + rand.Intn(20),
-			"ctr":         baseCTR + variation,
-			"duration":    contentPerformance[itemID].AvgDuration + rand.Float64()*10 - 5,
-		})
-	}
-	return history
-}
-
-func findSimilarItems(itemID string) []ContentPerformance {
-	currentItem := contentPerformance[itemID]
-	var similar []ContentPerformance
-	
-	for _, perf := range contentPerformance {
-		if perf.ItemID != itemID && perf.Category == currentItem.Category {
-			similar = append(similar, *perf)
+	recommender.SetModelVersion(getEnv("MODEL_VERSION", services.DefaultModelVersion))
+	if name := getEnv("EXPERIMENT", abtest.DefaultExperiment); name != "off" {
+		experiment, err := abtest.Lookup(name)
+		if err != nil {
+			log.Fatalf("Invalid EXPERIMENT: %v", err)
 		}
+		recommender.SetExperiment(experiment)
+	}
+	cacheTTLs, err := cacheTTLsFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid cache TTLs: %v", err)
+	}
+	recommender.SetCacheTTLs(cacheTTLs)
+	minViewDwell, err := time.ParseDuration(getEnv("RECS_INVALIDATE_MIN_DWELL", services.DefaultMinViewDwell.String()))
+	if err != nil || minViewDwell < 0 {
+		log.Fatalf("Invalid RECS_INVALIDATE_MIN_DWELL: %q", os.Getenv("RECS_INVALIDATE_MIN_DWELL"))
+	}
+	recommender.SetMinViewDwell(minViewDwell)
+	setupCatalog()
+
+	// Unknown items are registered as placeholders by default except on
+	// Postgres, where the catalog is loaded separately
+	registerItems := getEnv("AUTO_REGISTER_ITEMS", strconv.FormatBool(storageKind != "postgres")) == "true"
+	recommender.RegisterUnknownItems(registerItems)
+
+	activity = ingest.NewActivityTracker(store)
+	go activity.FlushPeriodically(5 * time.Second)
+
+	// Seen users behind unique_users must outlive the allowed lateness
+	rollups = rollup.NewAggregator(store, 2*derived.Policy.AllowedLateness)
+	go rollups.FlushPeriodically(10 * time.Second)
+
+	ingestion = &ingest.Pipeline{
+		State:      derived,
+		Rollups:    rollups,
+		Features:   userFeatures,
+		Popularity: popularity,
+		Sessions:   userSessions,
+		Activity:   activity,
+		Categories: itemCategories,
+	}
+
+	// Warm the cache for recently active users after a deploy
+	if warmer != nil {
+		if getEnv("WARM_ON_START", "true") == "true" {
+			warmer.Start("startup")
+		}
+		go warmer.RunPeriodically()
 	}
-	
-	// Sort by CTR similarity
-	sort.Slice(similar, func(i, j int) bool {
-		diffI := math.Abs(similar[i].CTR - currentItem.CTR)
-		diffJ := math.Abs(similar[j].CTR - currentItem.CTR)
-		return diffI < diffJ
-	})
-	
-	if len(similar) > 3 {
-		return similar[:3]
-	}
-	return similar
-}
-
-func getTotalImpressions() int {
-	total := 0
-	for _, perf := range contentPerformance {
-		total += perf.Impressions
-	}
-	return total
-}
 
-func getTotalClicks() int {
-	total := 0
-	for _, perf := range contentPerformance {
-		total += perf.Clicks
-	}
-	return total
-}
+	log.Println("🚀 Starting SIMPLE recommendation API on :8080")
+	log.Printf("📝 Note: Using %s storage, %s cache", storageKind, cacheBackend)
+	
+	http.HandleFunc("/recommend", recommendHandler)
+	http.HandleFunc("/event", eventHandler) 
+	http.HandleFunc("/attribution", attributionHandler)
+	http.HandleFunc("/quarantine", quarantineHandler)
+	http.HandleFunc("/items", itemsHandler)
+	http.HandleFunc("/items/", itemDetailHandler)
+	http.HandleFunc("/users/", userPrivacyHandler)
+	http.HandleFunc("/erasures", erasuresHandler)
+	http.HandleFunc("/cache/invalidate", cacheInvalidateHandler)
+	http.HandleFunc("/popular", popularHandler)
+	http.HandleFunc("/cache/warm", cacheWarmHandler)
+	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/metrics", metricsHandler)
+	http.HandleFunc("/ab-tests", abTestsHandler)
+	http.HandleFunc("/ab-tests/", abTestDetailHandler)
+	http.HandleFunc("/engagement-metrics", engagementMetricsHandler)
+	http.HandleFunc("/user-sessions", userSessionsHandler)
+	http.HandleFunc("/user-sessions/", userSessionDetailHandler)
+	http.HandleFunc("/content-analytics", contentAnalyticsHandler)
+	http.HandleFunc("/content-analytics/", contentItemDetailHandler)
+	http.HandleFunc("/algorithm-visualization", algorithmVisualizationHandler)
+	http.HandleFunc("/algorithm-visualization/", algorithmVisualizationDetailHandler)
 
-func getOverallCTR() float64 {
-	totalImpressions := getTotalImpressions()
-	totalClicks := getTotalClicks()
-	if totalImpressions == 0 {
-		return 0.0
-	}
-	return float64(totalClicks) / float64(totalImpressions)
+	log.Fatal(http.ListenAndServe(":8080", nil))
 }
 
-func getAvgDuration() float64 {
-	total := 0.0
-	count := 0
-	for _, perf := range contentPerformance {
-		total += perf.AvgDuration
-		count++
-	}
-	if count == 0 {
-		return 0.0
+func saveStatePeriodically(path string, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := derived.Save(path); err != nil {
+			log.Printf("Warning: failed to save state snapshot: %v", err)
+		}
 	}
-	return total / float64(count)
 }
 
 // NEW: Algorithm visualization endpoint
 func algorithmVisualizationHandler(w http.ResponseWriter, r *http.Request) {
+	derived.Lock()
+	defer derived.Unlock()
+
 	// Generate mock algorithm state if empty
 	if len(algorithmStates) == 0 {
 		generateMockAlgorithmData()
@@ -465,6 +413,10 @@ func algorithmVisualizationDetailHandler(w http.ResponseWriter, r *http.Request)
 	}
 	
 	userID := pathParts[2]
+
+	derived.Lock()
+	defer derived.Unlock()
+
 	state, exists := algorithmStates[userID]
 	if !exists {
 		// Create new algorithm state for this user
@@ -638,28 +590,65 @@ func getSimilarityMatrix() map[string]map[string]float64 {
 	return matrix
 }
 
-// NEW: User sessions list endpoint
+// NEW: User sessions list endpoint: GET /user-sessions?status=&limit=
+// lists active sessions, most recently active first, then ended sessions
+// with their final stats, newest first. status=active or status=ended
+// returns only those.
 func userSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != "active" && status != "ended" {
+		http.Error(w, `{"error": "status must be active or ended"}`, http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsed > 0 && parsed <= 1000 {
+		limit = parsed
+	}
+
+	var sessions []cache.Session
+	if status != "ended" {
+		active, err := userSessions.Active(r.Context(), limit)
+		if err != nil {
+			log.Printf("Error listing active sessions: %v", err)
+			http.Error(w, `{"error": "Failed to load sessions"}`, storageErrorStatus(err))
+			return
+		}
+		sessions = append(sessions, active...)
+	}
+	if status != "active" {
+		ended, err := userSessions.Ended(r.Context(), limit)
+		if err != nil {
+			log.Printf("Error listing ended sessions: %v", err)
+			http.Error(w, `{"error": "Failed to load sessions"}`, storageErrorStatus(err))
+			return
+		}
+		sessions = append(sessions, ended...)
+	}
+
 	// Generate some mock user sessions if empty
-	if len(userSessions) == 0 {
-		generateMockSessions()
+	if len(sessions) == 0 && status == "" {
+		sessions = generateMockSessions()
 	}
 
-	sessionsList := make([]map[string]interface{}, 0)
-	for _, session := range userSessions {
-		// Update session time for realism
-		session.SessionTime = int(time.Since(session.StartTime).Seconds())
-		
+	sessionsList := make([]map[string]interface{}, 0, len(sessions))
+	for _, session := range sessions {
+		engagement := 0.0
+		if session.PageViews > 0 {
+			engagement = float64(session.Clicks) / float64(session.PageViews)
+		}
 		sessionsList = append(sessionsList, map[string]interface{}{
 			"user_id":      session.UserID,
 			"session_id":   session.SessionID,
 			"start_time":   session.StartTime,
+			"last_active":  session.LastActive,
+			"end_time":     session.EndTime,
 			"session_time": session.SessionTime,
+			"events":       session.Events,
 			"page_views":   session.PageViews,
 			"clicks":       session.Clicks,
-			"engagement":   float64(session.Clicks) / float64(session.PageViews),
+			"engagement":   engagement,
 			"categories":   session.Categories,
-			"status":       "active",
+			"status":       session.Status(),
 		})
 	}
 
@@ -667,19 +656,31 @@ func userSessionsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(sessionsList)
 }
 
-// NEW: User session detail endpoint
+// NEW: User session detail endpoint: the user's current session, or their
+// latest ended one, with analytics and their session history
 func userSessionDetailHandler(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 3 {
+	if len(pathParts) < 3 || pathParts[2] == "" {
 		http.Error(w, `{"error": "User ID required"}`, http.StatusBadRequest)
 		return
 	}
 	
 	userID := pathParts[2]
-	session, exists := userSessions[userID]
-	if !exists {
-		// Create a new session for this user
-		session = &UserSession{
+
+	current, history, err := userSessions.User(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error loading sessions for %s: %v", userID, err)
+		http.Error(w, `{"error": "Failed to load sessions"}`, storageErrorStatus(err))
+		return
+	}
+
+	session := current
+	if session == nil && len(history) > 0 {
+		session = &history[0]
+	}
+	if session == nil {
+		// Show a placeholder session for users with no activity yet
+		session = &cache.Session{
 			UserID:     userID,
 			SessionID:  "session_" + userID + "_" + strconv.FormatInt(time.Now().Unix(), 10),
 			StartTime:  time.Now(),
@@ -688,18 +689,15 @@ func userSessionDetailHandler(w http.ResponseWriter, r *http.Request) {
 			Clicks:     0,
 			Categories: []string{"general"},
 		}
-		userSessions[userID] = session
 	}
 
-	// Update session activity
-	session.LastActive = time.Now()
-	session.SessionTime = int(time.Since(session.StartTime).Seconds())
-
 	// Generate mock click stream
 	clickStream := generateClickStream(session)
 
 	response := map[string]interface{}{
 		"session": session,
+		"status":  session.Status(),
+		"history": history,
 		"analytics": map[string]interface{}{
 			"click_stream":          clickStream,
 			"avg_time_per_click":    session.SessionTime / max(session.Clicks, 1),
@@ -712,7 +710,7 @@ func userSessionDetailHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func generateMockSessions() {
+func generateMockSessions() []cache.Session {
 	users := []string{"alice", "bob", "charlie", "diana", "eve", "frank", "grace", "henry"}
 	categories := [][]string{
 		{"technology", "science"},
@@ -725,20 +723,24 @@ func generateMockSessions() {
 		{"finance", "lifestyle"},
 	}
 
+	sessions := make([]cache.Session, 0, len(users))
 	for i, user := range users {
-		userSessions[user] = &UserSession{
-			UserID:     user,
-			SessionID:  "session_" + user + "_" + strconv.FormatInt(time.Now().Unix(), 10),
-			StartTime:  time.Now().Add(-time.Duration(rand.Intn(60)) * time.Minute),
-			LastActive: time.Now().Add(-time.Duration(rand.Intn(10)) * time.Minute),
-			PageViews:  5 + rand.Intn(20),
-			Clicks:     2 + rand.Intn(10),
-			Categories: categories[i],
-		}
+		startTime := time.Now().Add(-time.Duration(rand.Intn(60)) * time.Minute)
+		sessions = append(sessions, cache.Session{
+			UserID:      user,
+			SessionID:   "session_" + user + "_" + strconv.FormatInt(time.Now().Unix(), 10),
+			StartTime:   startTime,
+			LastActive:  time.Now().Add(-time.Duration(rand.Intn(10)) * time.Minute),
+			PageViews:   5 + rand.Intn(20),
+			Clicks:      2 + rand.Intn(10),
+			SessionTime: int(time.Since(startTime).Seconds()),
+			Categories:  categories[i],
+		})
 	}
+	return sessions
 }
 
-func generateClickStream(session *UserSession) []map[string]interface{} {
+func generateClickStream(session *cache.Session) []map[string]interface{} {
 	stream := []map[string]interface{}{
 		{
 			"timestamp": session.StartTime.Format(time.RFC3339),
@@ -755,7 +757,7 @@ func generateClickStream(session *UserSession) []map[string]interface{} {
 		stream = append(stream, map[string]interface{}{
 			"timestamp": currentTime.Format(time.RFC3339),
 			"action":    "click",
-			"item_id":   "item_" + session.Categories[rand.Intn(len(session.Categories))] + "_" + strconv.Itoa(i),
+			"item_id":   "item_" + mockCategory(session.Categories) + "_" + strconv.Itoa(i),
 			"duration":  10 + rand.Intn(50),
 		})
 	}
@@ -763,7 +765,14 @@ func generateClickStream(session *UserSession) []map[string]interface{} {
 	return stream
 }
 
-func getCategoryDistribution(session *UserSession) map[string]int {
+func mockCategory(categories []string) string {
+	if len(categories) == 0 {
+		return "general"
+	}
+	return categories[rand.Intn(len(categories))]
+}
+
+func getCategoryDistribution(session *cache.Session) map[string]int {
 	distribution := make(map[string]int)
 	for _, category := range session.Categories {
 		distribution[category] = 5 + rand.Intn(10)
@@ -771,12 +780,12 @@ func getCategoryDistribution(session *UserSession) map[string]int {
 	return distribution
 }
 
-func calculateEngagementScore(session *UserSession) float64 {
+func calculateEngagementScore(session *cache.Session) float64 {
 	if session.PageViews == 0 {
 		return 0.0
 	}
 	clickRatio := float64(session.Clicks) / float64(session.PageViews)
-	timeRatio := float64(session.SessionTime) / float64(session.Clicks*10)
+	timeRatio := float64(session.SessionTime) / float64(max(session.Clicks, 1)*10)
 	return (clickRatio*0.6 + timeRatio*0.4) * 100
 }
 
@@ -793,6 +802,10 @@ func engagementMetricsHandler(w http.ResponseWriter, r *http.Request) {
 	updateLiveMetrics()
 	
 	currentCTR := float64(totalClicks) / float64(totalImpressions)
+
+	derived.Lock()
+	lateEvents, droppedLate := derived.LateEvents, derived.DroppedLate
+	derived.Unlock()
 	
 	metrics := map[string]interface{}{
 		"timestamp":         time.Now().Format(time.RFC3339),
@@ -802,6 +815,9 @@ func engagementMetricsHandler(w http.ResponseWriter, r *http.Request) {
 		"active_users":      activeUsers,
 		"uptime_minutes":    time.Since(systemStartTime).Minutes(),
 		"engagement_trend":  engagementStats,
+		"event_time_trend":  derived.Trend(time.Now().Add(-5*time.Minute), time.Now()),
+		"late_events":       lateEvents,
+		"dropped_late":      droppedLate,
 		"performance": map[string]interface{}{
 			"p95_latency_ms": 24,
 			"error_rate":      0.0023,
@@ -959,15 +975,39 @@ func recommendHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// SIMPLE VERSION - Mock recommendations
-	recommendations, strategy := getMockRecommendations(userID, count)
-	diversityScore := calculateDiversityScore(recommendations)
+	// The user's variant picks the strategy and its parameters. Anonymous
+	// traffic shares one ID, so it stays outside experiments.
+	var experiment, variant string
+	if userID != "anonymous" {
+		assignment, err := recommender.AssignVariant(r.Context(), userID)
+		if err != nil {
+			log.Printf("Warning: failed to assign variant for %s, serving defaults: %v", userID, err)
+		} else if assignment != nil {
+			experiment, variant = assignment.Experiment, assignment.Variant
+		}
+	}
+
+	list, err := recommender.GetRecommendations(r.Context(), userID, variant, count)
+	if err != nil {
+		log.Printf("Error getting recommendations: %v", err)
+		http.Error(w, `{"error": "Failed to get recommendations"}`, storageErrorStatus(err))
+		return
+	}
+	diversityScore := calculateDiversityScore(r.Context(), list.Recommendations)
+	requestID := logImpression(userID, list.Recommendations, list.Strategy, experiment, variant)
 
 	response := map[string]interface{}{
+		"request_id":      requestID,
 		"user_id":         userID,
-		"recommendations": recommendations,
+		"recommendations": list.Recommendations,
 		"latency_ms":      time.Since(start).Milliseconds(),
-		"strategy":        strategy,
+		"strategy":        list.Strategy,
+		"experiment":      experiment,
+		"variant":         variant,
+		"model_version":   list.ModelVersion,
+		"generated_at":    list.GeneratedAt,
+		"cached":          list.Cached,
+		"stale":           list.Stale,
 		"timestamp":       time.Now().Format(time.RFC3339),
 		"version":         "simple-v1",
 		"diversity_score": diversityScore,
@@ -977,19 +1017,72 @@ func recommendHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func calculateDiversityScore(recommendations []map[string]interface{}) float64 {
+// logImpression records the served list for click attribution and returns
+// its request ID.
+func logImpression(userID string, recommendations []services.Recommendation, strategy, experiment, variant string) string {
+	imp := models.Impression{
+		RequestID:  attribution.NewRequestID(),
+		UserID:     userID,
+		Strategy:   strategy,
+		Experiment: experiment,
+		Variant:    variant,
+		ServedAt:   time.Now().UTC(),
+	}
+	for i, rec := range recommendations {
+		imp.Items = append(imp.Items, models.ServedItem{
+			ItemID:   rec.ItemID,
+			Position: i + 1,
+			Score:    rec.Score,
+		})
+	}
+
+	impressions.Record(imp)
+	rollups.AddServed(imp)
+	go func() {
+		if err := store.LogRecommendationsServed(context.Background(), imp); err != nil {
+			log.Printf("Warning: failed to log recommendations served: %v", err)
+		}
+	}()
+	return imp.RequestID
+}
+
+// findServedList finds the served list an event's request_id refers to,
+// falling back to recommendations_served for lists this process did not
+// serve.
+func findServedList(ctx context.Context, e models.UserEvent) (models.Impression, bool) {
+	if e.RequestID == "" {
+		return models.Impression{}, false
+	}
+
+	imp, ok := impressions.Lookup(e.RequestID)
+	if !ok {
+		stored, err := store.GetRecommendationsServed(ctx, e.RequestID)
+		if err != nil {
+			log.Printf("Warning: failed to load recommendations served: %v", err)
+		}
+		if stored != nil {
+			imp, ok = *stored, true
+		}
+	}
+	return imp, ok
+}
+
+// Attribution summary endpoint: impressions, clicks and CTR per strategy,
+// variant and position
+func attributionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(impressions.Summary())
+}
+
+func calculateDiversityScore(ctx context.Context, recommendations []services.Recommendation) float64 {
 	if len(recommendations) == 0 {
 		return 0.0
 	}
 	
-	// Extract categories from item IDs (simple heuristic)
+	// Count the item categories ranking uses
 	categories := make(map[string]bool)
 	for _, rec := range recommendations {
-		itemID := rec["item_id"].(string)
-		// Simple category extraction from item_id format: "category_content"
-		if parts := strings.Split(itemID, "_"); len(parts) > 1 {
-			categories[parts[0]] = true
-		}
+		categories[itemCategories.Of(ctx, rec.ItemID)] = true
 	}
 	
 	// Calculate diversity as ratio of unique categories to total recommendations
@@ -999,50 +1092,14 @@ func calculateDiversityScore(recommendations []map[string]interface{}) float64 {
 	return float64(uniqueCategories) / float64(totalItems)
 }
 
-func getMockRecommendations(userID string, count int) ([]map[string]interface{}, string) {
-	// Simple logic: if user has specific pattern, return personalized, else trending
-	var recommendations []map[string]interface{}
-	strategy := "trending"
-	
-	if len(userID) > 5 {
-		strategy = "personalized"
-		// Mock personalized recommendations
-		personalizedItems := []map[string]interface{}{
-			{"item_id": "tech_ai_news", "score": 0.95, "explanation": "Based on your tech interests"},
-			{"item_id": "science_space", "score": 0.88, "explanation": "Similar to content you viewed"},
-			{"item_id": "business_trends", "score": 0.82, "explanation": "Popular in your network"},
-			{"item_id": "health_wellness", "score": 0.78, "explanation": "Complementary content"},
-			{"item_id": "entertainment_pop", "score": 0.75, "explanation": "Trending now"},
-		}
-		recommendations = personalizedItems[:min(count, len(personalizedItems))]
-	} else {
-		// Mock trending recommendations
-		trendingItems := []map[string]interface{}{
-			{"item_id": "breaking_news_1", "score": 0.92, "explanation": "🔥 Trending worldwide"},
-			{"item_id": "viral_video_1", "score": 0.89, "explanation": "📈 Going viral"},
-			{"item_id": "popular_tutorial", "score": 0.85, "explanation": "⭐ Most watched today"},
-			{"item_id": "celebrity_news", "score": 0.81, "explanation": "🌟 Top story"},
-			{"item_id": "sports_highlight", "score": 0.79, "explanation": "🏆 Match of the day"},
-		}
-		recommendations = trendingItems[:min(count, len(trendingItems))]
-	}
-	
-	return recommendations, strategy
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 func eventHandler(w http.ResponseWriter, r *http.Request) {
 	var event struct {
 		UserID    string `json:"user_id"`
 		ItemID    string `json:"item_id"`
 		EventType string `json:"event_type"`
-		Duration  *int   `json:"duration_seconds"`
+		Duration  *int      `json:"duration_seconds"`
+		RequestID string    `json:"request_id"`
+		Timestamp time.Time `json:"timestamp"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
@@ -1055,52 +1112,126 @@ func eventHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Track user session activity
-	trackUserSession(event.UserID, event.EventType, event.ItemID)
+	// Aggregate on the client's event time, within the allowed clock skew
+	received := time.Now().UTC()
+	eventTime, err := derived.Policy.ValidateTimestamp(event.Timestamp, received)
+	if err != nil {
+		http.Error(w, `{"error": "timestamp is too far in the future"}`, http.StatusBadRequest)
+		return
+	}
+
+	ev := models.UserEvent{
+		UserID:     event.UserID,
+		ItemID:     event.ItemID,
+		EventType:  event.EventType,
+		Duration:   event.Duration,
+		Timestamp:  eventTime,
+		ReceivedAt: received,
+		RequestID:  event.RequestID,
+	}
+
+	// Event-quality checks run before anything derived or stored sees the
+	// event; quarantined events are kept separately for review
+	served, hasServed := findServedList(r.Context(), ev)
+	hasServed = hasServed && served.UserID == ev.UserID && served.Position(ev.ItemID) > 0
+	verdict := eventFilter.Check(ev, r.UserAgent(), hasServed)
+	if verdict.Action == quality.Quarantine {
+		quarantineEvent(ev, r.UserAgent(), verdict.Reasons)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  "quarantined",
+			"user_id": event.UserID,
+			"reasons": verdict.Reasons,
+		})
+		return
+	}
+	if verdict.Action == quality.Flag {
+		ev.Flags = verdict.Reasons
+	}
+
+	if err := recommender.TrackUserEvent(r.Context(), ev); errors.Is(err, storage.ErrUnknownItem) {
+		http.Error(w, `{"error": "Unknown item_id"}`, http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		log.Printf("Error tracking event: %v", err)
+		http.Error(w, `{"error": "Failed to record event"}`, storageErrorStatus(err))
+		return
+	}
+
+	// Update features, popularity, counters, trending, rollups and sessions
+	lateness := ingestion.Apply(r.Context(), ev)
+
+	if eventLog != nil {
+		if err := eventLog.Append(ev); err != nil {
+			log.Printf("Warning: failed to append event to log: %v", err)
+		}
+	}
 
 	// SIMPLE VERSION - Just log the event
-	log.Printf("📊 EVENT: user=%s item=%s type=%s duration=%v", 
-		event.UserID, event.ItemID, event.EventType, event.Duration)
+	log.Printf("📊 EVENT: user=%s item=%s type=%s duration=%v request=%s", 
+		event.UserID, event.ItemID, event.EventType, event.Duration, event.RequestID)
+
+	response := map[string]interface{}{
+		"status":   "recorded",
+		"user_id":  event.UserID,
+		"storage":  storageKind,
+		"lateness": lateness,
+	}
+	if hasServed {
+		if attr, ok := impressions.Attribute(served, ev); ok {
+			response["attribution"] = attr
+		}
+	}
+	if len(ev.Flags) > 0 {
+		response["flags"] = ev.Flags
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "recorded",
-		"user_id": event.UserID,
-		"note":    "mock-storage",
-	})
+	json.NewEncoder(w).Encode(response)
 }
 
-// NEW: Track user session activity
-func trackUserSession(userID, eventType, itemID string) {
-	session, exists := userSessions[userID]
-	if !exists {
-		session = &UserSession{
-			UserID:     userID,
-			SessionID:  "session_" + userID + "_" + strconv.FormatInt(time.Now().Unix(), 10),
-			StartTime:  time.Now(),
-			LastActive: time.Now(),
-			PageViews:  0,
-			Clicks:     0,
-			Categories: []string{},
+func quarantineEvent(e models.UserEvent, userAgent string, reasons []string) {
+	quarantine.Add(quality.QuarantinedEvent{
+		Event:         e,
+		UserAgent:     userAgent,
+		Reasons:       reasons,
+		QuarantinedAt: time.Now().UTC(),
+	})
+	log.Printf("🚫 QUARANTINED: user=%s item=%s type=%s reasons=%v", e.UserID, e.ItemID, e.EventType, reasons)
+
+	go func() {
+		if err := store.LogQuarantinedEvent(context.Background(), e, userAgent, reasons); err != nil {
+			log.Printf("Warning: failed to store quarantined event: %v", err)
 		}
-		userSessions[userID] = session
+	}()
+}
+
+// Quarantine review endpoint: most recent quarantined events and how often
+// each rule fired
+func quarantineHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsed > 0 && parsed <= 1000 {
+		limit = parsed
 	}
 
-	session.LastActive = time.Now()
+	response := map[string]interface{}{
+		"total_quarantined": quarantine.Total(),
+		"rule_counts":       eventFilter.Counts(),
+		"events":            quarantine.Recent(limit),
+	}
 
-	switch eventType {
-	case "view":
-		session.PageViews++
-		// Extract category from item ID
-		if parts := strings.Split(itemID, "_"); len(parts) > 1 {
-			category := parts[0]
-			if !contains(session.Categories, category) {
-				session.Categories = append(session.Categories, category)
-			}
-		}
-	case "click":
-		session.Clicks++
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// storageErrorStatus maps a storage failure to a response code: timeouts
+// and cancellations are reported as unavailable rather than as errors.
+func storageErrorStatus(err error) int {
+	if timeout.IsCanceled(err) {
+		return http.StatusServiceUnavailable
 	}
+	return http.StatusInternalServerError
 }
 
 func contains(slice []string, item string) bool {
@@ -1114,10 +1245,13 @@ func contains(slice []string, item string) bool {
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	health := map[string]interface{}{
-		"status":    "healthy",
-		"timestamp": time.Now().Format(time.RFC3339),
-		"version":   "simple-v1",
-		"features":  []string{"mock-recommendations", "event-logging", "health-check", "diversity-scoring", "ab-testing", "live-metrics", "user-sessions"},
+		"status":         "healthy",
+		"timestamp":      time.Now().Format(time.RFC3339),
+		"version":        "simple-v1",
+		"storage":        storageKind,
+		"cache":          cacheBackend,
+		"schema_version": schemaVersion,
+		"features":       []string{"mock-recommendations", "event-logging", "health-check", "diversity-scoring", "ab-testing", "live-metrics", "user-sessions", "event-log", "click-attribution", "event-quality", "content-catalog", "privacy-requests"},
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1132,6 +1266,30 @@ func metricsHandler(w http.ResponseWriter, r *http.Request) {
 		"status":    "operational",
 		"uptime":    "since-last-deploy",
 	}
+	metrics["dependencies"] = ops.Stats()
+	pendingRollups, flushedRollups := rollups.Stats()
+	metrics["rollups"] = map[string]interface{}{
+		"pending_item_hours": pendingRollups,
+		"item_hours_flushed": flushedRollups,
+	}
+	if db, ok := store.(*database.DB); ok {
+		if replicas, fallbacks := db.Replicas(); replicas != nil {
+			metrics["read_replicas"] = map[string]interface{}{
+				"replicas":          replicas,
+				"primary_fallbacks": fallbacks,
+			}
+		}
+	}
+	metrics["cache"] = map[string]interface{}{
+		"backend":    cacheBackend,
+		"keyspaces":  cacheMetrics.Keyspaces(),
+		"strategies": cacheMetrics.Strategies(),
+	}
+	pending, flushed := activity.Stats()
+	metrics["user_activity"] = map[string]interface{}{
+		"pending_updates": pending,
+		"users_flushed":   flushed,
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(metrics)
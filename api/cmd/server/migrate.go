@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"recommendation-engine/api/internal/database"
+	"recommendation-engine/api/internal/migrate"
+	"recommendation-engine/api/internal/storage/sqlite"
+)
+
+// Schema version of the connected database, reported by /health. Zero
+// when running on in-memory storage.
+var schemaVersion int
+
+// storageKindFromEnv returns STORAGE (memory, postgres or sqlite). It
+// defaults to postgres when DATABASE_URL is set and memory otherwise.
+func storageKindFromEnv() string {
+	if os.Getenv("DATABASE_URL") != "" {
+		return getEnv("STORAGE", "postgres")
+	}
+	return getEnv("STORAGE", "memory")
+}
+
+// newMigrator loads the migrations for the given storage kind. SQLite has
+// its own set, in data/migrations/sqlite by default.
+func newMigrator(kind string, db *sql.DB) (*migrate.Migrator, error) {
+	if kind == "sqlite" {
+		migrations, err := migrate.Load(getEnv("SQLITE_MIGRATIONS_DIR", "../data/migrations/sqlite"))
+		if err != nil {
+			return nil, err
+		}
+		return migrate.NewSQLite(db, migrations), nil
+	}
+	migrations, err := migrate.Load(getEnv("MIGRATIONS_DIR", "../data/migrations"))
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, migrations), nil
+}
+
+// migrateOnStart applies pending migrations when MIGRATE_ON_START=true and
+// records the resulting schema version. SQLite databases are migrated by
+// default, since nothing else creates their schema.
+func migrateOnStart(kind string, db *sql.DB) error {
+	ctx := context.Background()
+	if getEnv("MIGRATE_ON_START", strconv.FormatBool(kind == "sqlite")) == "true" {
+		migrator, err := newMigrator(kind, db)
+		if err != nil {
+			return err
+		}
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			log.Printf("📦 Applied migration %s", m.Name)
+		}
+	}
+
+	version, err := migrate.Version(ctx, db)
+	if err != nil {
+		log.Printf("Warning: could not read schema version: %v", err)
+		return nil
+	}
+	schemaVersion = version
+	log.Printf("📦 Database schema version %d", schemaVersion)
+	return nil
+}
+
+// runMigrateCommand implements `server migrate <up|down [n]|status|baseline <version>>`.
+func runMigrateCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatal("usage: server migrate <up|down [n]|status|baseline <version>>")
+	}
+
+	kind := storageKindFromEnv()
+	var db *sql.DB
+	switch kind {
+	case "postgres":
+		pg, err := database.NewPostgresDB(os.Getenv("DATABASE_URL"))
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		db = pg.DB
+	case "sqlite":
+		lite, err := sqlite.Open(getEnv("SQLITE_PATH", "recommendations.db"))
+		if err != nil {
+			log.Fatalf("Failed to open SQLite database: %v", err)
+		}
+		db = lite.DB
+	default:
+		log.Fatal("DATABASE_URL or STORAGE=sqlite is required to run migrations")
+	}
+	defer db.Close()
+
+	migrator, err := newMigrator(kind, db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		for _, m := range applied {
+			log.Printf("✅ Applied %s", m.Name)
+		}
+		log.Printf("%d migration(s) applied", len(applied))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalf("invalid step count %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		for _, m := range reverted {
+			log.Printf("↩️  Reverted %s", m.Name)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%03d  %-40s %s\n", s.Version, s.Name, applied)
+		}
+	case "baseline":
+		if len(args) < 2 {
+			log.Fatal("usage: server migrate baseline <version>")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			log.Fatalf("invalid version %q", args[1])
+		}
+		if err := migrator.Baseline(ctx, version); err != nil {
+			log.Fatalf("Baseline failed: %v", err)
+		}
+		log.Printf("✅ Marked migrations up to %d as applied", version)
+	default:
+		log.Fatalf("unknown migrate command %q", args[0])
+	}
+}
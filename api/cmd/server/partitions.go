@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"recommendation-engine/api/internal/database"
+)
+
+// partitionedSchemaVersion is the migration that partitions user_events.
+const partitionedSchemaVersion = 6
+
+// maintainPartitions keeps user_events partitions created ahead of time
+// and applies the retention policy, once at startup and then every
+// interval.
+func maintainPartitions(db *database.DB, policy database.PartitionPolicy, interval time.Duration) {
+	for {
+		now := time.Now().UTC()
+		ctx := context.Background()
+
+		created, err := db.EnsurePartitions(ctx, policy, now)
+		for _, p := range created {
+			log.Printf("🗂️  Created partition %s", p.Name)
+		}
+		if err != nil {
+			log.Printf("Warning: failed to create event partitions: %v", err)
+		}
+
+		removed, err := db.ApplyRetention(ctx, policy, now)
+		for _, p := range removed {
+			log.Printf("🗑️  Dropped partition %s (events before %s)", p.Name, p.To.Format("2006-01-02"))
+		}
+		if err != nil {
+			log.Printf("Warning: failed to apply event retention: %v", err)
+		}
+
+		time.Sleep(interval)
+	}
+}
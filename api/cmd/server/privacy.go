@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"recommendation-engine/api/internal/attribution"
+	"recommendation-engine/api/internal/events"
+	"recommendation-engine/api/internal/models"
+)
+
+// erasureHashKey keys the subject hashes in the erasure audit log. Set by
+// erasureHashKeyFromEnv at startup.
+var erasureHashKey []byte
+
+// User endpoints: GET /users/{id}/features returns the user's online
+// features; GET /users/{id}/export returns everything held about a user,
+// DELETE /users/{id} erases them
+func userPrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/users/")
+	userID, action, _ := strings.Cut(path, "/")
+	if userID == "" {
+		http.Error(w, `{"error": "User ID required"}`, http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case action == "features" && r.Method == http.MethodGet:
+		userFeaturesHandler(w, r, userID)
+	case action == "export" && r.Method == http.MethodGet:
+		exportUser(w, r, userID)
+	case action == "" && r.Method == http.MethodDelete:
+		eraseUserHandler(w, r, userID)
+	case action == "" || action == "export" || action == "features":
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, `{"error": "Not found"}`, http.StatusNotFound)
+	}
+}
+
+func exportUser(w http.ResponseWriter, r *http.Request, userID string) {
+	stored, err := store.ExportUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error exporting user data: %v", err)
+		http.Error(w, `{"error": "Failed to export user data"}`, storageErrorStatus(err))
+		return
+	}
+	cached, err := recommender.CachedUserData(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error exporting cached user data: %v", err)
+		http.Error(w, `{"error": "Failed to export user data"}`, storageErrorStatus(err))
+		return
+	}
+
+	userFeatures, err := recommender.UserFeatures(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error exporting user features: %v", err)
+		http.Error(w, `{"error": "Failed to export user data"}`, storageErrorStatus(err))
+		return
+	}
+
+	session, sessionHistory, err := userSessions.User(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error exporting user sessions: %v", err)
+		http.Error(w, `{"error": "Failed to export user data"}`, storageErrorStatus(err))
+		return
+	}
+
+	derived.Lock()
+	interactions := append([]string(nil), derived.Interactions[userID]...)
+	derived.Unlock()
+
+	if stored.Empty() && session == nil && len(sessionHistory) == 0 && len(interactions) == 0 && userFeatures == nil {
+		http.Error(w, `{"error": "No data held for user"}`, http.StatusNotFound)
+		return
+	}
+
+	bundle := map[string]interface{}{
+		"user_id":         userID,
+		"exported_at":     time.Now().UTC(),
+		"storage":         stored,
+		"session":         session,
+		"session_history": sessionHistory,
+		"interactions":    interactions,
+	}
+	if cached != nil {
+		bundle["cache"] = cached
+	}
+	if userFeatures != nil {
+		bundle["features"] = userFeatures
+	}
+	writeJSON(w, http.StatusOK, bundle)
+}
+
+func userFeaturesHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	userFeatures, err := recommender.UserFeatures(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error reading user features: %v", err)
+		http.Error(w, `{"error": "Failed to load user features"}`, storageErrorStatus(err))
+		return
+	}
+	if userFeatures == nil {
+		http.Error(w, `{"error": "No features held for user"}`, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, userFeatures)
+}
+
+func eraseUserHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	requestedBy := r.Header.Get("X-Requested-By")
+	if requestedBy == "" {
+		requestedBy = r.RemoteAddr
+	}
+
+	rec := eraseUser(r.Context(), userID, requestedBy)
+	if err := store.LogErasure(context.Background(), rec); err != nil {
+		// The log line stands in for the audit row
+		log.Printf("Warning: failed to record erasure audit %+v: %v", rec, err)
+		http.Error(w, `{"error": "User erased but the audit record could not be written"}`, storageErrorStatus(err))
+		return
+	}
+	log.Printf("🧹 ERASED: subject=%s status=%s removed=%v", rec.SubjectHash, rec.Status, rec.Removed)
+
+	status := http.StatusOK
+	if rec.Status != "completed" {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, rec)
+}
+
+// eraseUser removes the user from storage, the cache, the event log, the
+// archives of dropped event partitions and in-process state. Events are kept under a random pseudonym so
+// aggregates do not change. In-process buffers are cleared first so a
+// background flush cannot recreate the user.
+func eraseUser(ctx context.Context, userID, requestedBy string) models.ErasureRecord {
+	rec := models.ErasureRecord{
+		SubjectHash: subjectHash(userID),
+		RequestedBy: requestedBy,
+		Removed:     make(map[string]int64),
+		Errors:      make(map[string]string),
+		RequestedAt: time.Now().UTC(),
+	}
+	pseudonym := "erased_" + attribution.NewRequestID()[:16]
+
+	activity.Forget(userID)
+	rollups.ForgetUser(userID)
+	eventFilter.Forget(userID)
+	rec.Removed["quarantine_buffer"] = int64(quarantine.RemoveUser(userID))
+	rec.Removed["served_lists"] = int64(impressions.ForgetUser(userID))
+	if derived.ForgetUser(userID) {
+		rec.Removed["derived_state"] = 1
+	}
+
+	if removed, err := store.EraseUser(ctx, userID, pseudonym); err != nil {
+		rec.Errors["storage"] = erasureError(rec, "storage", err)
+	} else {
+		for table, n := range removed {
+			rec.Removed[table] = n
+		}
+	}
+
+	if n, err := recommender.ForgetUser(ctx, userID); err != nil {
+		rec.Errors["cache"] = erasureError(rec, "cache", err)
+	} else {
+		rec.Removed["cache_keys"] = n
+	}
+
+	if n, err := userSessions.DeleteUser(ctx, userID); err != nil {
+		rec.Errors["sessions"] = erasureError(rec, "sessions", err)
+	} else {
+		rec.Removed["sessions"] = n
+	}
+
+	pseudonymize := func(e *models.UserEvent) bool {
+		if e.UserID != userID {
+			return false
+		}
+		e.UserID = pseudonym
+		return true
+	}
+	if eventLog != nil {
+		n, err := eventLog.Rewrite(pseudonymize)
+		if err != nil {
+			rec.Errors["event_log"] = erasureError(rec, "event_log", err)
+		} else {
+			rec.Removed["event_log"] = int64(n)
+		}
+	}
+	if dir := os.Getenv("EVENT_ARCHIVE_DIR"); dir != "" {
+		n, err := events.RewriteArchives(dir, pseudonymize)
+		if err != nil {
+			rec.Errors["event_archive"] = erasureError(rec, "event_archive", err)
+		}
+		rec.Removed["event_archive"] = int64(n)
+	}
+
+	rec.Status = "completed"
+	if len(rec.Errors) > 0 {
+		rec.Status = "partial"
+	} else {
+		rec.Errors = nil
+	}
+	rec.CompletedAt = time.Now().UTC()
+	return rec
+}
+
+// Erasure audit log: GET /erasures?user_id=&limit=
+func erasuresHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 50
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsed > 0 && parsed <= 1000 {
+		limit = parsed
+	}
+	var hash string
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		hash = subjectHash(userID)
+	}
+
+	records, err := store.Erasures(r.Context(), hash, limit)
+	if err != nil {
+		log.Printf("Error reading erasure audit: %v", err)
+		http.Error(w, `{"error": "Failed to load erasure audit"}`, storageErrorStatus(err))
+		return
+	}
+	if records == nil {
+		records = []models.ErasureRecord{}
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// erasureError logs why a step of an erasure failed and returns what the
+// audit record keeps. Driver errors can quote the user ID, so the record
+// only says how the step failed.
+func erasureError(rec models.ErasureRecord, step string, err error) string {
+	log.Printf("Warning: erasure of %s failed at %s: %v", rec.SubjectHash, step, err)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timed out"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "failed"
+	}
+}
+
+// subjectHash identifies an erased user in the audit log without keeping
+// their ID. It is an HMAC so IDs cannot be recovered by hashing guesses
+// without the server's key.
+func subjectHash(userID string) string {
+	mac := hmac.New(sha256.New, erasureHashKey)
+	mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// erasureHashKeyFromEnv reads ERASURE_HASH_KEY. Without it a random key is
+// used, and /erasures?user_id= only finds erasures made since startup.
+func erasureHashKeyFromEnv() ([]byte, error) {
+	if value := os.Getenv("ERASURE_HASH_KEY"); value != "" {
+		if len(value) < 16 {
+			return nil, errors.New("ERASURE_HASH_KEY: must be at least 16 characters")
+		}
+		return []byte(value), nil
+	}
+	log.Printf("Warning: ERASURE_HASH_KEY is not set, erasure audit lookups by user_id will not match erasures from before a restart")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"recommendation-engine/api/internal/models"
+)
+
+func TestSubjectHashIsKeyed(t *testing.T) {
+	defer func(key []byte) { erasureHashKey = key }(erasureHashKey)
+
+	erasureHashKey = []byte("first-key-0123456789")
+	first := subjectHash("alice")
+	if subjectHash("alice") != first {
+		t.Error("subject hash is not stable under one key")
+	}
+	if subjectHash("bob") == first {
+		t.Error("different users share a subject hash")
+	}
+	erasureHashKey = []byte("second-key-0123456789")
+	if subjectHash("alice") == first {
+		t.Error("subject hash does not depend on the key")
+	}
+}
+
+func TestErasureErrorDropsDriverMessage(t *testing.T) {
+	rec := models.ErasureRecord{SubjectHash: "h"}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"driver error", errors.New(`pq: duplicate key value (user_id)=(alice@example.com)`), "failed"},
+		{"timeout", fmt.Errorf("erase alice@example.com: %w", context.DeadlineExceeded), "timed out"},
+		{"canceled", context.Canceled, "canceled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := erasureError(rec, "storage", tt.err)
+			if got != tt.want || strings.Contains(got, "alice") {
+				t.Errorf("erasureError = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
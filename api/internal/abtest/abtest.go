@@ -0,0 +1,122 @@
+// Package abtest buckets users into experiment variants and says how each
+// variant's recommendations are produced. Bucketing matches assign_variant
+// in ab-testing/experiment_config.py, so Go and Python agree on every
+// user's variant.
+package abtest
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Params control how a list is produced.
+type Params struct {
+	// Strategy labels personalized lists.
+	Strategy string `json:"strategy"`
+	// AffinityBoost is the most a category affinity adds to a personalized
+	// score.
+	AffinityBoost float64 `json:"affinity_boost"`
+	// ColdStartViews is how many recent views a user needs before their
+	// lists are personalized rather than trending.
+	ColdStartViews int `json:"cold_start_views"`
+}
+
+// DefaultParams are used outside experiments.
+func DefaultParams() Params {
+	return Params{Strategy: "personalized", AffinityBoost: 0.1, ColdStartViews: 3}
+}
+
+// Variant is one arm of an experiment. Weight is its share of users, 0 to
+// 1.
+type Variant struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	Params Params  `json:"params"`
+}
+
+// Experiment splits users between variants by weight. The first variant
+// is the control.
+type Experiment struct {
+	Name     string    `json:"name"`
+	Variants []Variant `json:"variants"`
+}
+
+// DefaultExperiment is homepage_recommendations_v1 from
+// ab-testing/experiment_config.py: half of users get the collaborative
+// hybrid, half a hybrid that leans harder on their category affinities.
+const DefaultExperiment = "homepage_recommendations_v1"
+
+var known = map[string]Experiment{
+	DefaultExperiment: {
+		Name: DefaultExperiment,
+		Variants: []Variant{
+			{Name: "control", Weight: 0.5, Params: Params{Strategy: "hybrid_collaborative", AffinityBoost: 0.1, ColdStartViews: 3}},
+			{Name: "treatment", Weight: 0.5, Params: Params{Strategy: "hybrid_content_boosted", AffinityBoost: 0.3, ColdStartViews: 3}},
+		},
+	},
+}
+
+// Lookup returns the named experiment.
+func Lookup(name string) (*Experiment, error) {
+	e, exists := known[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown experiment %q", name)
+	}
+	if err := e.validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (e *Experiment) validate() error {
+	if len(e.Variants) == 0 {
+		return fmt.Errorf("experiment %s has no variants", e.Name)
+	}
+	total := 0.0
+	for _, v := range e.Variants {
+		if v.Weight < 0 {
+			return fmt.Errorf("experiment %s: variant %s has a negative weight", e.Name, v.Name)
+		}
+		total += v.Weight
+	}
+	if math.Abs(total-1) > 1e-9 {
+		return fmt.Errorf("experiment %s: variant weights sum to %g, not 1", e.Name, total)
+	}
+	return nil
+}
+
+// Bucket returns the user's bucket in the experiment, 0 to 99: the first
+// 32 bits of the MD5 of "<user>_<experiment>", modulo 100.
+func Bucket(userID, experiment string) int {
+	sum := md5.Sum([]byte(userID + "_" + experiment))
+	return int(binary.BigEndian.Uint32(sum[:4]) % 100)
+}
+
+// Assign returns the name of the user's variant. Variants take buckets in
+// order, each covering its weight's share of the 100; with a control and
+// a treatment this is the Python rule, treatment when the bucket is at
+// least the control weight times 100.
+func (e *Experiment) Assign(userID string) string {
+	bucket := float64(Bucket(userID, e.Name))
+	upper := 0.0
+	for _, v := range e.Variants {
+		upper += v.Weight * 100
+		if bucket < upper {
+			return v.Name
+		}
+	}
+	// Rounding can leave the last bucket uncovered
+	return e.Variants[len(e.Variants)-1].Name
+}
+
+// Variant returns the named variant.
+func (e *Experiment) Variant(name string) (Variant, bool) {
+	for _, v := range e.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
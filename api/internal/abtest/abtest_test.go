@@ -0,0 +1,55 @@
+package abtest
+
+import "testing"
+
+// Expected values come from assign_variant in
+// ab-testing/experiment_config.py.
+func TestAssignMatchesPython(t *testing.T) {
+	e, err := Lookup(DefaultExperiment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		userID  string
+		bucket  int
+		variant string
+	}{
+		{"alice", 50, "treatment"},
+		{"bob", 73, "treatment"},
+		{"user_123", 66, "treatment"},
+		{"charlie", 44, "control"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.userID, func(t *testing.T) {
+			if got := Bucket(tt.userID, e.Name); got != tt.bucket {
+				t.Errorf("bucket = %d, want %d", got, tt.bucket)
+			}
+			if got := e.Assign(tt.userID); got != tt.variant {
+				t.Errorf("variant = %s, want %s", got, tt.variant)
+			}
+		})
+	}
+}
+
+func TestLookupValidatesWeights(t *testing.T) {
+	tests := []struct {
+		name  string
+		e     Experiment
+		valid bool
+	}{
+		{"weights sum to one", Experiment{Name: "x", Variants: []Variant{{Name: "a", Weight: 0.3}, {Name: "b", Weight: 0.7}}}, true},
+		{"no variants", Experiment{Name: "x"}, false},
+		{"weights short of one", Experiment{Name: "x", Variants: []Variant{{Name: "a", Weight: 0.5}}}, false},
+		{"negative weight", Experiment{Name: "x", Variants: []Variant{{Name: "a", Weight: 1.5}, {Name: "b", Weight: -0.5}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.e.validate(); (err == nil) != tt.valid {
+				t.Errorf("validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+	if _, err := Lookup("no_such_experiment"); err == nil {
+		t.Error("Lookup of an unknown experiment succeeded")
+	}
+}
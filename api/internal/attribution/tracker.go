@@ -0,0 +1,230 @@
+package attribution
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+)
+
+// Attribution links an event back to the served list that produced it.
+type Attribution struct {
+	RequestID  string `json:"request_id"`
+	Position   int    `json:"position"`
+	Strategy   string `json:"strategy"`
+	Experiment string `json:"experiment,omitempty"`
+	Variant    string `json:"variant,omitempty"`
+}
+
+// Stats aggregates impressions and attributed clicks for one
+// strategy/variant/position combination.
+type Stats struct {
+	Strategy    string  `json:"strategy"`
+	Experiment  string  `json:"experiment,omitempty"`
+	Variant     string  `json:"variant,omitempty"`
+	Position    int     `json:"position"`
+	Impressions int     `json:"impressions"`
+	Clicks      int     `json:"clicks"`
+	CTR         float64 `json:"ctr"`
+}
+
+type statKey struct {
+	strategy   string
+	experiment string
+	variant    string
+	position   int
+}
+
+// clickKey is one served slot: an item in the list served under a request
+// ID.
+type clickKey struct {
+	requestID string
+	itemID    string
+}
+
+// Tracker keeps recently served lists in memory so /event can attribute
+// clicks without a database round-trip. Entries older than ttl, or beyond
+// maxEntries, are forgotten. Each served slot counts at most one click;
+// the slots clicked are remembered for ttl after the click.
+type Tracker struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	served     map[string]models.Impression
+	order      []string
+	stats      map[statKey]*Stats
+	clicked    map[clickKey]time.Time
+	clickOrder []clickKey
+}
+
+func NewTracker(ttl time.Duration, maxEntries int) *Tracker {
+	return &Tracker{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		served:     make(map[string]models.Impression),
+		stats:      make(map[statKey]*Stats),
+		clicked:    make(map[clickKey]time.Time),
+	}
+}
+
+// NewRequestID returns a random 128-bit hex identifier.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// Record remembers a served list and counts an impression for each
+// position in it.
+func (t *Tracker) Record(imp models.Impression) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.evict(imp.ServedAt)
+	if _, exists := t.served[imp.RequestID]; !exists {
+		t.order = append(t.order, imp.RequestID)
+	}
+	t.served[imp.RequestID] = imp
+
+	for _, item := range imp.Items {
+		t.stat(imp, item.Position).Impressions++
+	}
+}
+
+// Lookup returns a remembered served list.
+func (t *Tracker) Lookup(requestID string) (models.Impression, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	imp, ok := t.served[requestID]
+	return imp, ok
+}
+
+// Attribute matches an event against the served list imp. The first click
+// on each served item is counted towards the stats of the position it came
+// from; repeat clicks are attributed but not counted again.
+func (t *Tracker) Attribute(imp models.Impression, e models.UserEvent) (Attribution, bool) {
+	if imp.RequestID != e.RequestID || imp.UserID != e.UserID {
+		return Attribution{}, false
+	}
+
+	for _, item := range imp.Items {
+		if item.ItemID != e.ItemID {
+			continue
+		}
+		if e.EventType == "click" {
+			t.countClick(imp, item)
+		}
+		return Attribution{
+			RequestID:  imp.RequestID,
+			Position:   item.Position,
+			Strategy:   imp.Strategy,
+			Experiment: imp.Experiment,
+			Variant:    imp.Variant,
+		}, true
+	}
+	return Attribution{}, false
+}
+
+func (t *Tracker) countClick(imp models.Impression, item models.ServedItem) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.evictClicks(now)
+	key := clickKey{imp.RequestID, item.ItemID}
+	if _, seen := t.clicked[key]; seen {
+		return
+	}
+	t.clicked[key] = now
+	t.clickOrder = append(t.clickOrder, key)
+	t.stat(imp, item.Position).Clicks++
+}
+
+// Summary returns per-position stats ordered by strategy, variant and
+// position.
+func (t *Tracker) Summary() []Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summary := make([]Stats, 0, len(t.stats))
+	for _, s := range t.stats {
+		current := *s
+		if current.Impressions > 0 {
+			current.CTR = float64(current.Clicks) / float64(current.Impressions)
+		}
+		summary = append(summary, current)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		a, b := summary[i], summary[j]
+		if a.Strategy != b.Strategy {
+			return a.Strategy < b.Strategy
+		}
+		if a.Experiment != b.Experiment {
+			return a.Experiment < b.Experiment
+		}
+		if a.Variant != b.Variant {
+			return a.Variant < b.Variant
+		}
+		return a.Position < b.Position
+	})
+	return summary
+}
+
+// ForgetUser drops the user's remembered lists and returns how many were
+// dropped. Position stats are aggregates and are kept.
+func (t *Tracker) ForgetUser(userID string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := 0
+	for requestID, imp := range t.served {
+		if imp.UserID == userID {
+			// evict skips request IDs that are no longer in served
+			delete(t.served, requestID)
+			n++
+		}
+	}
+	return n
+}
+
+func (t *Tracker) stat(imp models.Impression, position int) *Stats {
+	key := statKey{imp.Strategy, imp.Experiment, imp.Variant, position}
+	s, exists := t.stats[key]
+	if !exists {
+		s = &Stats{
+			Strategy:   imp.Strategy,
+			Experiment: imp.Experiment,
+			Variant:    imp.Variant,
+			Position:   position,
+		}
+		t.stats[key] = s
+	}
+	return s
+}
+
+func (t *Tracker) evict(now time.Time) {
+	for len(t.order) > 0 {
+		oldest := t.served[t.order[0]]
+		if len(t.order) < t.maxEntries && now.Sub(oldest.ServedAt) < t.ttl {
+			return
+		}
+		delete(t.served, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+func (t *Tracker) evictClicks(now time.Time) {
+	for len(t.clickOrder) > 0 {
+		oldest := t.clickOrder[0]
+		if len(t.clickOrder) < t.maxEntries && now.Sub(t.clicked[oldest]) < t.ttl {
+			return
+		}
+		delete(t.clicked, oldest)
+		t.clickOrder = t.clickOrder[1:]
+	}
+}
@@ -0,0 +1,125 @@
+package attribution
+
+import (
+	"testing"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func impression(requestID, userID string, servedAt time.Time) models.Impression {
+	return models.Impression{
+		RequestID: requestID,
+		UserID:    userID,
+		Strategy:  "personalized",
+		Items: []models.ServedItem{
+			{ItemID: "item_tech_1", Position: 1},
+			{ItemID: "item_tech_2", Position: 2},
+		},
+		ServedAt: servedAt,
+	}
+}
+
+func TestAttribute(t *testing.T) {
+	imp := impression("req_1", "u1", testStart)
+	tests := []struct {
+		name     string
+		event    models.UserEvent
+		position int
+		ok       bool
+	}{
+		{"click on a served item", models.UserEvent{RequestID: "req_1", UserID: "u1", ItemID: "item_tech_2", EventType: "click"}, 2, true},
+		{"item not served", models.UserEvent{RequestID: "req_1", UserID: "u1", ItemID: "item_tech_3", EventType: "click"}, 0, false},
+		{"another user", models.UserEvent{RequestID: "req_1", UserID: "u2", ItemID: "item_tech_1", EventType: "click"}, 0, false},
+		{"another request", models.UserEvent{RequestID: "req_2", UserID: "u1", ItemID: "item_tech_1", EventType: "click"}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NewTracker(time.Hour, 10).Attribute(imp, tt.event)
+			if ok != tt.ok || got.Position != tt.position {
+				t.Errorf("Attribute = %+v, %v, want position %d, %v", got, ok, tt.position, tt.ok)
+			}
+		})
+	}
+}
+
+func TestClicksCountOncePerServedItem(t *testing.T) {
+	tr := NewTracker(time.Hour, 10)
+	imp := impression("req_1", "u1", testStart)
+	tr.Record(imp)
+
+	click := models.UserEvent{RequestID: "req_1", UserID: "u1", ItemID: "item_tech_1", EventType: "click"}
+	for i := 0; i < 3; i++ {
+		if _, ok := tr.Attribute(imp, click); !ok {
+			t.Fatal("repeat click was not attributed")
+		}
+	}
+	view := models.UserEvent{RequestID: "req_1", UserID: "u1", ItemID: "item_tech_2", EventType: "view"}
+	tr.Attribute(imp, view)
+
+	want := map[int]Stats{
+		1: {Impressions: 1, Clicks: 1, CTR: 1},
+		2: {Impressions: 1},
+	}
+	summary := tr.Summary()
+	if len(summary) != len(want) {
+		t.Fatalf("summary = %+v, want %d positions", summary, len(want))
+	}
+	for _, s := range summary {
+		w := want[s.Position]
+		if s.Impressions != w.Impressions || s.Clicks != w.Clicks || s.CTR != w.CTR {
+			t.Errorf("position %d = %+v, want %+v", s.Position, s, w)
+		}
+	}
+}
+
+func TestServedListsExpire(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEntries int
+		nextServed time.Time
+		kept       bool
+	}{
+		{"within ttl", 10, testStart.Add(59 * time.Minute), true},
+		{"past ttl", 10, testStart.Add(time.Hour), false},
+		{"beyond max entries", 1, testStart.Add(time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTracker(time.Hour, tt.maxEntries)
+			tr.Record(impression("req_1", "u1", testStart))
+			tr.Record(impression("req_2", "u1", tt.nextServed))
+			if _, kept := tr.Lookup("req_1"); kept != tt.kept {
+				t.Errorf("first list kept = %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestForgetUser(t *testing.T) {
+	tr := NewTracker(time.Hour, 10)
+	tr.Record(impression("req_1", "u1", testStart))
+	tr.Record(impression("req_2", "u2", testStart))
+	tr.Record(impression("req_3", "u1", testStart))
+
+	if n := tr.ForgetUser("u1"); n != 2 {
+		t.Errorf("forgot %d lists, want 2", n)
+	}
+	if _, ok := tr.Lookup("req_1"); ok {
+		t.Error("u1's list is still remembered")
+	}
+	if _, ok := tr.Lookup("req_2"); !ok {
+		t.Error("u2's list was forgotten")
+	}
+	// Stats are aggregates and stay
+	if summary := tr.Summary(); len(summary) != 2 || summary[0].Impressions != 3 {
+		t.Errorf("summary = %+v, want 3 impressions per position", summary)
+	}
+	// Recording after a forgotten list at the front of the order still works
+	tr.Record(impression("req_4", "u2", testStart.Add(time.Minute)))
+	if _, ok := tr.Lookup("req_4"); !ok {
+		t.Error("list recorded after ForgetUser is missing")
+	}
+}
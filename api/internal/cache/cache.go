@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Key prefixes shared by every implementation.
+const (
+	recsPrefix     = "recs:"
+	activityPrefix = "user_activity:"
+	tagPrefix      = "tag:"
+)
+
+// ItemTag tags cached lists that contain the item.
+func ItemTag(itemID string) string {
+	return "item:" + itemID
+}
+
+// StrategyTag tags cached lists produced by a strategy at a model version.
+func StrategyTag(strategy, modelVersion string) string {
+	return "strategy:" + strategy + ":" + modelVersion
+}
+
+// Cache is what the services need from a cache: per-user recommendation
+// lists, counters and plain key-values. RedisCache shares it across
+// replicas; LRU keeps it in process so the API runs without Redis; Tiered
+// puts an LRU in front of Redis. A TTL of zero means the entry does not
+// expire.
+type Cache interface {
+	// GetUserRecommendations decodes the user's cached list into dst and
+	// reports whether there was one.
+	GetUserRecommendations(ctx context.Context, userID string, dst interface{}) (bool, error)
+	// SetUserRecommendations caches the user's list under the given tags.
+	SetUserRecommendations(ctx context.Context, userID string, recommendations interface{}, ttl time.Duration, tags ...string) error
+	// InvalidateUserRecommendations deletes the user's cached list.
+	InvalidateUserRecommendations(ctx context.Context, userID string) error
+	// InvalidateAllRecommendations deletes every cached recommendation list.
+	InvalidateAllRecommendations(ctx context.Context) error
+	// InvalidateTags deletes every list cached under any of the tags and
+	// returns how many existed.
+	InvalidateTags(ctx context.Context, tags ...string) (int64, error)
+
+	IncrementUserActivity(ctx context.Context, userID string) error
+	// UserActivity returns the user's activity counter, or 0 if unset.
+	UserActivity(ctx context.Context, userID string) (int64, error)
+	// DeleteUser removes every key held for the user and returns how many
+	// existed.
+	DeleteUser(ctx context.Context, userID string) (int64, error)
+
+	// Get returns nil on a miss.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Incr adds one to the integer at key, starting from zero, and returns
+	// the new value. The key keeps any TTL it had.
+	Incr(ctx context.Context, key string) (int64, error)
+	// SetNX sets key only if it does not exist and reports whether it did.
+	// It serves as a short lock.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// DeleteIfEquals removes key only if it holds value and reports whether
+	// it did. It releases a SetNX lock without deleting one another holder
+	// took after it expired.
+	DeleteIfEquals(ctx context.Context, key string, value []byte) (bool, error)
+	// Delete removes keys and returns how many existed.
+	Delete(ctx context.Context, keys ...string) (int64, error)
+}
+
+// Updater is a cache that can change a key atomically. RedisCache and LRU
+// implement it; Tiered does not, since its local copies may be stale.
+type Updater interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Update replaces the value at key with fn's result, given the current
+	// value (nil if unset), and sets its TTL. fn may run more than once.
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(current []byte) ([]byte, error)) error
+	Delete(ctx context.Context, keys ...string) (int64, error)
+}
+
+// Clock tells caches and the stores built on them the time, so tests can
+// control expiry.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
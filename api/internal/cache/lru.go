@@ -0,0 +1,310 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	_ Cache   = (*LRU)(nil)
+	_ Updater = (*LRU)(nil)
+)
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time // zero for no expiry
+	tags    []string
+}
+
+// LRU is an in-process Cache holding at most maxEntries keys. The least
+// recently used key is evicted to make room, and expired keys are dropped
+// when they are next touched or reach the back of the list.
+type LRU struct {
+	mu         sync.Mutex
+	clock      Clock
+	maxEntries int
+	order      *list.List // front is most recently used
+	entries    map[string]*list.Element
+	tags       map[string]map[string]struct{} // tag -> keys
+	evictions  int64
+}
+
+func NewLRU(maxEntries int, clock Clock) *LRU {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &LRU{
+		clock:      clock,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		tags:       make(map[string]map[string]struct{}),
+	}
+}
+
+func (c *LRU) GetUserRecommendations(ctx context.Context, userID string, dst interface{}) (bool, error) {
+	val, err := c.Get(ctx, recsPrefix+userID)
+	if val == nil || err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(val, dst)
+}
+
+func (c *LRU) SetUserRecommendations(ctx context.Context, userID string, recommendations interface{}, ttl time.Duration, tags ...string) error {
+	jsonData, err := json.Marshal(recommendations)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := recsPrefix + userID
+	c.put(key, jsonData, c.expiry(ttl))
+	// The entry may have been evicted at once when maxEntries is tiny
+	if el, exists := c.entries[key]; exists {
+		// A replaced list keeps none of the old list's tags
+		entry := el.Value.(*lruEntry)
+		c.untag(entry)
+		for _, tag := range tags {
+			if c.tags[tag] == nil {
+				c.tags[tag] = make(map[string]struct{})
+			}
+			if _, tagged := c.tags[tag][key]; !tagged {
+				c.tags[tag][key] = struct{}{}
+				entry.tags = append(entry.tags, tag)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *LRU) InvalidateUserRecommendations(ctx context.Context, userID string) error {
+	_, err := c.Delete(ctx, recsPrefix+userID)
+	return err
+}
+
+func (c *LRU) InvalidateAllRecommendations(ctx context.Context) error {
+	c.deletePrefix(recsPrefix)
+	return nil
+}
+
+func (c *LRU) InvalidateTags(ctx context.Context, tags ...string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int64
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if el := c.live(key); el != nil {
+				c.remove(el)
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+func (c *LRU) IncrementUserActivity(ctx context.Context, userID string) error {
+	_, err := c.Incr(ctx, activityPrefix+userID)
+	return err
+}
+
+func (c *LRU) UserActivity(ctx context.Context, userID string) (int64, error) {
+	val, err := c.Get(ctx, activityPrefix+userID)
+	if val == nil || err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(val), 10, 64)
+}
+
+func (c *LRU) DeleteUser(ctx context.Context, userID string) (int64, error) {
+	return c.Delete(ctx, recsPrefix+userID, activityPrefix+userID)
+}
+
+func (c *LRU) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el := c.live(key)
+	if el == nil {
+		return nil, nil
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).value, nil
+}
+
+func (c *LRU) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.put(key, value, c.expiry(ttl))
+	return nil
+}
+
+func (c *LRU) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.live(key) != nil {
+		return false, nil
+	}
+	c.put(key, value, c.expiry(ttl))
+	return true, nil
+}
+
+func (c *LRU) DeleteIfEquals(ctx context.Context, key string, value []byte) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el := c.live(key)
+	if el == nil || !bytes.Equal(el.Value.(*lruEntry).value, value) {
+		return false, nil
+	}
+	c.remove(el)
+	return true, nil
+}
+
+// Update holds the lock while fn runs.
+func (c *LRU) Update(ctx context.Context, key string, ttl time.Duration, fn func(current []byte) ([]byte, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var current []byte
+	if el := c.live(key); el != nil {
+		current = el.Value.(*lruEntry).value
+	}
+	value, err := fn(current)
+	if err != nil {
+		return err
+	}
+	c.put(key, value, c.expiry(ttl))
+	return nil
+}
+
+func (c *LRU) Incr(ctx context.Context, key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int64
+	var expires time.Time
+	if el := c.live(key); el != nil {
+		entry := el.Value.(*lruEntry)
+		var err error
+		if n, err = strconv.ParseInt(string(entry.value), 10, 64); err != nil {
+			return 0, err
+		}
+		expires = entry.expires
+	}
+	n++
+	c.put(key, []byte(strconv.FormatInt(n, 10)), expires)
+	return n, nil
+}
+
+func (c *LRU) Delete(ctx context.Context, keys ...string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int64
+	for _, key := range keys {
+		if el := c.live(key); el != nil {
+			c.remove(el)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Len returns the number of keys held, including expired keys not yet
+// dropped.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Evictions returns how many keys were evicted to make room.
+func (c *LRU) Evictions() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.evictions
+}
+
+// deletePrefix removes every key starting with prefix.
+func (c *LRU) deletePrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, el := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(el)
+		}
+	}
+}
+
+// live returns the element for key, dropping it if it has expired.
+func (c *LRU) live(key string) *list.Element {
+	el, exists := c.entries[key]
+	if !exists {
+		return nil
+	}
+	if c.expired(el.Value.(*lruEntry)) {
+		c.remove(el)
+		return nil
+	}
+	return el
+}
+
+func (c *LRU) put(key string, value []byte, expires time.Time) {
+	if el, exists := c.entries[key]; exists {
+		entry := el.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		if !c.expired(oldest.Value.(*lruEntry)) {
+			c.evictions++
+		}
+		c.remove(oldest)
+	}
+}
+
+func (c *LRU) expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return c.clock.Now().Add(ttl)
+}
+
+func (c *LRU) expired(entry *lruEntry) bool {
+	return !entry.expires.IsZero() && !c.clock.Now().Before(entry.expires)
+}
+
+func (c *LRU) remove(el *list.Element) {
+	entry := el.Value.(*lruEntry)
+	c.order.Remove(el)
+	delete(c.entries, entry.key)
+	c.untag(entry)
+}
+
+// untag drops the entry from the index of every tag it carries.
+func (c *LRU) untag(entry *lruEntry) {
+	for _, tag := range entry.tags {
+		delete(c.tags[tag], entry.key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+	entry.tags = nil
+}
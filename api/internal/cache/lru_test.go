@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestLRUExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		advance time.Duration
+		found   bool
+	}{
+		{"no ttl never expires", 0, 24 * time.Hour, true},
+		{"before ttl", time.Minute, 59 * time.Second, true},
+		{"at ttl", time.Minute, time.Minute, false},
+		{"after ttl", time.Minute, 2 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := NewFakeClock(testStart)
+			c := NewLRU(10, clock)
+			if err := c.Set(ctx, "k", []byte("v"), tt.ttl); err != nil {
+				t.Fatal(err)
+			}
+
+			clock.Advance(tt.advance)
+			val, err := c.Get(ctx, "k")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found := val != nil; found != tt.found {
+				t.Errorf("found = %v, want %v", found, tt.found)
+			}
+		})
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		ops       func(c *LRU, clock *FakeClock)
+		keys      []string
+		evictions int64
+	}{
+		{
+			name: "least recently set is evicted",
+			ops: func(c *LRU, clock *FakeClock) {
+				c.Set(ctx, "a", []byte("1"), 0)
+				c.Set(ctx, "b", []byte("2"), 0)
+				c.Set(ctx, "c", []byte("3"), 0)
+			},
+			keys:      []string{"b", "c"},
+			evictions: 1,
+		},
+		{
+			name: "a read keeps a key",
+			ops: func(c *LRU, clock *FakeClock) {
+				c.Set(ctx, "a", []byte("1"), 0)
+				c.Set(ctx, "b", []byte("2"), 0)
+				c.Get(ctx, "a")
+				c.Set(ctx, "c", []byte("3"), 0)
+			},
+			keys:      []string{"a", "c"},
+			evictions: 1,
+		},
+		{
+			name: "expired keys are dropped without counting as evictions",
+			ops: func(c *LRU, clock *FakeClock) {
+				c.Set(ctx, "a", []byte("1"), time.Minute)
+				c.Set(ctx, "b", []byte("2"), 0)
+				clock.Advance(2 * time.Minute)
+				c.Set(ctx, "c", []byte("3"), 0)
+			},
+			keys:      []string{"b", "c"},
+			evictions: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewFakeClock(testStart)
+			c := NewLRU(2, clock)
+			tt.ops(c, clock)
+
+			var keys []string
+			for key := range c.entries {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("keys = %v, want %v", keys, tt.keys)
+			}
+			if n := c.Evictions(); n != tt.evictions {
+				t.Errorf("evictions = %d, want %d", n, tt.evictions)
+			}
+		})
+	}
+}
+
+func TestLRUDeleteIfEquals(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		deleted bool
+	}{
+		{"own token", "mine", true},
+		{"another holder's token", "theirs", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := NewLRU(10, NewFakeClock(testStart))
+			if _, err := c.SetNX(ctx, "lock", []byte("mine"), time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			deleted, err := c.DeleteIfEquals(ctx, "lock", []byte(tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			val, _ := c.Get(ctx, "lock")
+			if deleted != tt.deleted || (val == nil) != tt.deleted {
+				t.Errorf("deleted = %v with %q left, want deleted %v", deleted, val, tt.deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcome is how a cache lookup went.
+type Outcome string
+
+const (
+	Hit  Outcome = "hit"
+	Miss Outcome = "miss"
+	// StaleHit is a hit on an entry past its soft TTL, served while it is
+	// refreshed.
+	StaleHit Outcome = "stale_hit"
+	Error    Outcome = "error"
+)
+
+// RecsKeyspace is the keyspace of cached recommendation lists.
+const RecsKeyspace = "recs"
+
+// Keyspace returns the part of key before its first colon, which names the
+// kind of data it holds: recs, user_activity, features and so on.
+func Keyspace(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// latencyBucketsMs are the upper bounds of the latency histogram. Slower
+// lookups fall in a final +Inf bucket.
+var latencyBucketsMs = []struct {
+	label string
+	bound time.Duration
+}{
+	{"1", time.Millisecond},
+	{"5", 5 * time.Millisecond},
+	{"25", 25 * time.Millisecond},
+	{"100", 100 * time.Millisecond},
+}
+
+// LookupStats tallies the lookups in one keyspace or for one strategy.
+// HitRate counts stale hits as hits.
+type LookupStats struct {
+	Lookups      int64            `json:"lookups"`
+	Hits         int64            `json:"hits"`
+	StaleHits    int64            `json:"stale_hits"`
+	Misses       int64            `json:"misses"`
+	Errors       int64            `json:"errors"`
+	HitRate      float64          `json:"hit_rate"`
+	AvgLatencyMs float64          `json:"avg_latency_ms"`
+	MaxLatencyMs float64          `json:"max_latency_ms"`
+	LatencyMs    map[string]int64 `json:"latency_ms"` // lookups per bucket upper bound
+	total        time.Duration
+	max          time.Duration
+}
+
+func (s *LookupStats) add(outcome Outcome, latency time.Duration) {
+	s.Lookups++
+	switch outcome {
+	case Hit:
+		s.Hits++
+	case StaleHit:
+		s.StaleHits++
+	case Miss:
+		s.Misses++
+	case Error:
+		s.Errors++
+	}
+	s.total += latency
+	if latency > s.max {
+		s.max = latency
+	}
+
+	if s.LatencyMs == nil {
+		s.LatencyMs = make(map[string]int64, len(latencyBucketsMs)+1)
+	}
+	bucket := "+Inf"
+	for _, b := range latencyBucketsMs {
+		if latency <= b.bound {
+			bucket = b.label
+			break
+		}
+	}
+	s.LatencyMs[bucket]++
+}
+
+func (s LookupStats) snapshot() LookupStats {
+	if s.Lookups > 0 {
+		s.HitRate = float64(s.Hits+s.StaleHits) / float64(s.Lookups)
+		s.AvgLatencyMs = float64(s.total) / float64(s.Lookups) / float64(time.Millisecond)
+	}
+	s.MaxLatencyMs = float64(s.max) / float64(time.Millisecond)
+	buckets := make(map[string]int64, len(s.LatencyMs))
+	for label, n := range s.LatencyMs {
+		buckets[label] = n
+	}
+	s.LatencyMs = buckets
+	return s
+}
+
+// Metrics counts cache lookups per keyspace and, for recommendation lists,
+// per strategy. A nil *Metrics records nothing.
+type Metrics struct {
+	mu         sync.Mutex
+	keyspaces  map[string]*LookupStats
+	strategies map[string]*LookupStats
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		keyspaces:  make(map[string]*LookupStats),
+		strategies: make(map[string]*LookupStats),
+	}
+}
+
+// Observe records a lookup in keyspace and, unless strategy is empty,
+// against the strategy that produced the list.
+func (m *Metrics) Observe(keyspace, strategy string, outcome Outcome, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statsFor(m.keyspaces, keyspace).add(outcome, latency)
+	if strategy != "" {
+		statsFor(m.strategies, strategy).add(outcome, latency)
+	}
+}
+
+func statsFor(stats map[string]*LookupStats, name string) *LookupStats {
+	s, exists := stats[name]
+	if !exists {
+		s = &LookupStats{}
+		stats[name] = s
+	}
+	return s
+}
+
+// Keyspaces returns a copy of the stats for every keyspace seen so far.
+func (m *Metrics) Keyspaces() map[string]LookupStats {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return copyStats(m.keyspaces)
+}
+
+// Strategies returns a copy of the stats for every strategy seen so far.
+func (m *Metrics) Strategies() map[string]LookupStats {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return copyStats(m.strategies)
+}
+
+func copyStats(stats map[string]*LookupStats) map[string]LookupStats {
+	out := make(map[string]LookupStats, len(stats))
+	for name, s := range stats {
+		out[name] = s.snapshot()
+	}
+	return out
+}
+
+// Instrumented counts the lookups made through a Cache in metrics.
+// Recommendation lists pass through uncounted: whoever serves them knows
+// their strategy and staleness and records them with Observe.
+type Instrumented struct {
+	Cache
+	metrics *Metrics
+}
+
+// Instrument wraps c so its lookups are counted in metrics. It returns nil
+// for a nil c, so callers can keep treating nil as no cache.
+func Instrument(c Cache, metrics *Metrics) Cache {
+	if c == nil {
+		return nil
+	}
+	return &Instrumented{Cache: c, metrics: metrics}
+}
+
+func (c *Instrumented) Get(ctx context.Context, key string) ([]byte, error) {
+	start := time.Now()
+	val, err := c.Cache.Get(ctx, key)
+	c.metrics.Observe(Keyspace(key), "", lookupOutcome(val != nil, err), time.Since(start))
+	return val, err
+}
+
+func (c *Instrumented) UserActivity(ctx context.Context, userID string) (int64, error) {
+	start := time.Now()
+	n, err := c.Cache.UserActivity(ctx, userID)
+	c.metrics.Observe(Keyspace(activityPrefix), "", lookupOutcome(n != 0, err), time.Since(start))
+	return n, err
+}
+
+// instrumentedUpdater counts the lookups made through an Updater.
+type instrumentedUpdater struct {
+	Updater
+	metrics *Metrics
+}
+
+// InstrumentUpdater wraps u so its lookups are counted in metrics.
+func InstrumentUpdater(u Updater, metrics *Metrics) Updater {
+	return &instrumentedUpdater{Updater: u, metrics: metrics}
+}
+
+func (u *instrumentedUpdater) Get(ctx context.Context, key string) ([]byte, error) {
+	start := time.Now()
+	val, err := u.Updater.Get(ctx, key)
+	u.metrics.Observe(Keyspace(key), "", lookupOutcome(val != nil, err), time.Since(start))
+	return val, err
+}
+
+func lookupOutcome(found bool, err error) Outcome {
+	switch {
+	case err != nil:
+		return Error
+	case found:
+		return Hit
+	}
+	return Miss
+}
@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"recommendation-engine/api/internal/timeout"
+)
+
+const popularityPrefix = "pop:"
+
+// ItemScore is an item's weighted event count over a window.
+type ItemScore struct {
+	ItemID string  `json:"item_id"`
+	Score  float64 `json:"score"`
+}
+
+// Popularity counts weighted item events in per-minute buckets, overall
+// and per category, and answers "top N items in the last X minutes".
+// Buckets older than the retention are dropped, so windows are capped at
+// it. category "" means all items.
+type Popularity interface {
+	Record(ctx context.Context, itemID, category string, weight float64, at time.Time) error
+	Top(ctx context.Context, category string, window time.Duration, n int) ([]ItemScore, error)
+	Retention() time.Duration
+}
+
+// PopularityRetentionFromEnv returns POPULARITY_RETENTION, default 1h and
+// at least a minute.
+func PopularityRetentionFromEnv() (time.Duration, error) {
+	value := os.Getenv("POPULARITY_RETENTION")
+	if value == "" {
+		return time.Hour, nil
+	}
+	retention, err := time.ParseDuration(value)
+	if err != nil || retention < time.Minute {
+		return 0, fmt.Errorf("POPULARITY_RETENTION: invalid duration %q (minimum 1m)", value)
+	}
+	return retention, nil
+}
+
+func popularityScope(category string) string {
+	if category == "" {
+		return "all"
+	}
+	return "cat:" + category
+}
+
+// popularityScopes are the buckets an event counts towards.
+func popularityScopes(category string) []string {
+	if category == "" {
+		return []string{"all"}
+	}
+	return []string{"all", popularityScope(category)}
+}
+
+// windowMinutes returns the minutes covered by a window ending at now,
+// newest first, capped at the retention.
+func windowMinutes(now time.Time, window, retention time.Duration) []int64 {
+	if window > retention {
+		window = retention
+	}
+	current := now.Unix() / 60
+	n := int64((window + time.Minute - 1) / time.Minute)
+	minutes := make([]int64, 0, n)
+	for i := int64(0); i < n; i++ {
+		minutes = append(minutes, current-i)
+	}
+	return minutes
+}
+
+var _ Popularity = (*RedisPopularity)(nil)
+
+// RedisPopularity keeps each minute's counts in a sorted set that expires
+// once it leaves the retention, so every instance sees the same counts.
+type RedisPopularity struct {
+	client    *redis.Client
+	ops       *timeout.Tracker
+	retention time.Duration
+	clock     Clock
+}
+
+// Popularity returns counters stored alongside the cache.
+func (r *RedisCache) Popularity(retention time.Duration) *RedisPopularity {
+	return &RedisPopularity{client: r.client, ops: r.ops, retention: retention, clock: SystemClock}
+}
+
+func (p *RedisPopularity) Retention() time.Duration {
+	return p.retention
+}
+
+func (p *RedisPopularity) Record(ctx context.Context, itemID, category string, weight float64, at time.Time) (err error) {
+	minute := at.Unix() / 60
+	expireAt := time.Unix((minute+1)*60, 0).Add(p.retention)
+	if !expireAt.After(p.clock.Now()) {
+		return nil // Too old to count in any window
+	}
+
+	ctx, done := p.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	_, err = p.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, scope := range popularityScopes(category) {
+			key := popularityPrefix + scope + ":" + strconv.FormatInt(minute, 10)
+			pipe.ZIncrBy(ctx, key, weight, itemID)
+			pipe.ExpireAt(ctx, key, expireAt)
+		}
+		return nil
+	})
+	return err
+}
+
+// Top merges the window's buckets into a scratch set and reads the top n
+// from it in one transaction.
+func (p *RedisPopularity) Top(ctx context.Context, category string, window time.Duration, n int) (_ []ItemScore, err error) {
+	ctx, done := p.ops.Start(ctx, timeout.CacheRead)
+	defer done(&err)
+
+	scope := popularityScope(category)
+	var keys []string
+	for _, minute := range windowMinutes(p.clock.Now(), window, p.retention) {
+		keys = append(keys, popularityPrefix+scope+":"+strconv.FormatInt(minute, 10))
+	}
+	scratch := popularityPrefix + "top:" + scope + ":" + strconv.Itoa(len(keys))
+
+	var top *redis.ZSliceCmd
+	_, err = p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZUnionStore(ctx, scratch, &redis.ZStore{Keys: keys})
+		top = pipe.ZRevRangeWithScores(ctx, scratch, 0, int64(n-1))
+		pipe.Del(ctx, scratch)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([]ItemScore, 0, n)
+	for _, z := range top.Val() {
+		itemID, _ := z.Member.(string)
+		scores = append(scores, ItemScore{ItemID: itemID, Score: z.Score})
+	}
+	return scores, nil
+}
+
+var _ Popularity = (*LocalPopularity)(nil)
+
+// LocalPopularity is the in-process Popularity used without Redis.
+type LocalPopularity struct {
+	mu        sync.Mutex
+	retention time.Duration
+	clock     Clock
+	buckets   map[int64]map[string]map[string]float64 // minute -> scope -> item -> score
+	pruned    int64                                   // minute of the last prune
+}
+
+func NewLocalPopularity(retention time.Duration, clock Clock) *LocalPopularity {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &LocalPopularity{
+		retention: retention,
+		clock:     clock,
+		buckets:   make(map[int64]map[string]map[string]float64),
+	}
+}
+
+func (p *LocalPopularity) Retention() time.Duration {
+	return p.retention
+}
+
+func (p *LocalPopularity) Record(ctx context.Context, itemID, category string, weight float64, at time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.prune()
+	minute := at.Unix() / 60
+	if minute < p.oldestMinute() {
+		return nil // Too old to count in any window
+	}
+	bucket, exists := p.buckets[minute]
+	if !exists {
+		bucket = make(map[string]map[string]float64)
+		p.buckets[minute] = bucket
+	}
+	for _, scope := range popularityScopes(category) {
+		if bucket[scope] == nil {
+			bucket[scope] = make(map[string]float64)
+		}
+		bucket[scope][itemID] += weight
+	}
+	return nil
+}
+
+func (p *LocalPopularity) Top(ctx context.Context, category string, window time.Duration, n int) ([]ItemScore, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	scope := popularityScope(category)
+	totals := make(map[string]float64)
+	for _, minute := range windowMinutes(p.clock.Now(), window, p.retention) {
+		for itemID, score := range p.buckets[minute][scope] {
+			totals[itemID] += score
+		}
+	}
+
+	scores := make([]ItemScore, 0, len(totals))
+	for itemID, score := range totals {
+		scores = append(scores, ItemScore{ItemID: itemID, Score: score})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].ItemID < scores[j].ItemID
+	})
+	if len(scores) > n {
+		scores = scores[:n]
+	}
+	return scores, nil
+}
+
+func (p *LocalPopularity) oldestMinute() int64 {
+	return p.clock.Now().Add(-p.retention).Unix() / 60
+}
+
+// prune drops expired buckets, at most once a minute.
+func (p *LocalPopularity) prune() {
+	oldest := p.oldestMinute()
+	if oldest == p.pruned {
+		return
+	}
+	p.pruned = oldest
+	for minute := range p.buckets {
+		if minute < oldest {
+			delete(p.buckets, minute)
+		}
+	}
+}
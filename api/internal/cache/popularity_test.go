@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLocalPopularityWindows(t *testing.T) {
+	ctx := context.Background()
+	clock := NewFakeClock(testStart)
+	p := NewLocalPopularity(time.Hour, clock)
+	now := clock.Now()
+	for _, e := range []struct {
+		itemID   string
+		category string
+		weight   float64
+		ago      time.Duration
+	}{
+		{"a", "tech", 1, 0},
+		{"b", "science", 3, 5 * time.Minute},
+		{"a", "tech", 5, 30 * time.Minute},
+		{"c", "tech", 10, 2 * time.Hour}, // older than the retention
+	} {
+		if err := p.Record(ctx, e.itemID, e.category, e.weight, now.Add(-e.ago)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		category string
+		window   time.Duration
+		want     []ItemScore
+	}{
+		{"current minute", "", time.Minute, []ItemScore{{"a", 1}}},
+		{"last ten minutes", "", 10 * time.Minute, []ItemScore{{"b", 3}, {"a", 1}}},
+		{"whole retention", "", time.Hour, []ItemScore{{"a", 6}, {"b", 3}}},
+		{"window capped at retention", "", 2 * time.Hour, []ItemScore{{"a", 6}, {"b", 3}}},
+		{"one category", "science", time.Hour, []ItemScore{{"b", 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Top(ctx, tt.category, tt.window, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Top = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalPopularityPruning(t *testing.T) {
+	tests := []struct {
+		name    string
+		advance time.Duration
+		buckets int
+		want    []ItemScore
+	}{
+		{"within retention", 30 * time.Minute, 2, []ItemScore{{"a", 1}, {"b", 1}}},
+		{"past retention", 61 * time.Minute, 1, []ItemScore{{"b", 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := NewFakeClock(testStart)
+			p := NewLocalPopularity(time.Hour, clock)
+			p.Record(ctx, "a", "", 1, clock.Now())
+
+			// The next write prunes buckets that fell out of the retention
+			clock.Advance(tt.advance)
+			p.Record(ctx, "b", "", 1, clock.Now())
+
+			if n := len(p.buckets); n != tt.buckets {
+				t.Errorf("buckets = %d, want %d", n, tt.buckets)
+			}
+			got, err := p.Top(ctx, "", time.Hour, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Top = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
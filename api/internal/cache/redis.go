@@ -1,17 +1,29 @@
 package cache
 
 import (
+	"context"
 	"encoding/json"
 	"log"
+	"math/rand"
 	"time"
 
 	"github.com/redis/go-redis/v9"
-	"golang.org/x/net/context"
+
+	"recommendation-engine/api/internal/timeout"
+)
+
+var (
+	_ Cache   = (*RedisCache)(nil)
+	_ Updater = (*RedisCache)(nil)
 )
 
+// maxUpdateAttempts bounds how often a WATCH transaction retries after
+// another client changed its keys first.
+const maxUpdateAttempts = 10
+
 type RedisCache struct {
 	client *redis.Client
-	ctx    context.Context
+	ops    *timeout.Tracker
 }
 
 func NewRedisCache(redisURL string) (*RedisCache, error) {
@@ -21,40 +33,298 @@ func NewRedisCache(redisURL string) (*RedisCache, error) {
 	}
 
 	client := redis.NewClient(opts)
-	ctx := context.Background()
 
 	// Test connection
-	if err := client.Ping(ctx).Err(); err != nil {
+	if err := client.Ping(context.Background()).Err(); err != nil {
 		return nil, err
 	}
 
 	log.Println("✅ Connected to Redis")
-	return &RedisCache{client: client, ctx: ctx}, nil
+	return &RedisCache{client: client, ops: timeout.NewTracker(timeout.DefaultConfig())}, nil
+}
+
+// SetTimeouts replaces the tracker that bounds and counts Redis calls.
+func (r *RedisCache) SetTimeouts(ops *timeout.Tracker) {
+	r.ops = ops
 }
 
-func (r *RedisCache) SetUserRecommendations(userID string, recommendations interface{}, ttl time.Duration) error {
+func (r *RedisCache) SetUserRecommendations(ctx context.Context, userID string, recommendations interface{}, ttl time.Duration, tags ...string) (err error) {
 	jsonData, err := json.Marshal(recommendations)
 	if err != nil {
 		return err
 	}
+	return r.setTagged(ctx, recsPrefix+userID, jsonData, ttl, tags)
+}
+
+// setTagged sets key and adds it to each tag's set. A tag set lives as
+// long as the latest key added to it.
+func (r *RedisCache) setTagged(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string) (err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
 
-	return r.client.Set(r.ctx, "recs:"+userID, jsonData, ttl).Err()
+	if len(tags) == 0 {
+		return r.client.Set(ctx, key, value, ttl).Err()
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, value, ttl)
+		for _, tag := range tags {
+			pipe.SAdd(ctx, tagPrefix+tag, key)
+			if ttl > 0 {
+				pipe.Expire(ctx, tagPrefix+tag, ttl)
+			}
+		}
+		return nil
+	})
+	return err
 }
 
-func (r *RedisCache) GetUserRecommendations(userID string) ([]map[string]interface{}, error) {
-	val, err := r.client.Get(r.ctx, "recs:"+userID).Result()
+func (r *RedisCache) GetUserRecommendations(ctx context.Context, userID string, dst interface{}) (_ bool, err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheRead)
+	defer done(&err)
+
+	val, err := r.client.Get(ctx, recsPrefix+userID).Bytes()
 	if err == redis.Nil {
-		return nil, nil // Cache miss
+		return false, nil // Cache miss
 	} else if err != nil {
-		return nil, err
+		return false, err
+	}
+
+	return true, json.Unmarshal(val, dst)
+}
+
+func (r *RedisCache) IncrementUserActivity(ctx context.Context, userID string) (err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	return r.client.Incr(ctx, activityPrefix+userID).Err()
+}
+
+func (r *RedisCache) InvalidateUserRecommendations(ctx context.Context, userID string) (err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	return r.client.Del(ctx, recsPrefix+userID).Err()
+}
+
+// InvalidateAllRecommendations deletes every cached recommendation list.
+func (r *RedisCache) InvalidateAllRecommendations(ctx context.Context) (err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	iter := r.client.Scan(ctx, 0, recsPrefix+"*", 500).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == 500 {
+			if err := r.client.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return r.client.Del(ctx, keys...).Err()
+	}
+	return nil
+}
+
+// invalidateTagsScript deletes the keys in the given tag sets and the sets
+// themselves in one step, so a key tagged meanwhile is not lost. It
+// returns how many keys existed and the keys it deleted.
+var invalidateTagsScript = redis.NewScript(`
+local keys = redis.call('SUNION', unpack(KEYS))
+local n = 0
+for i = 1, #keys, 500 do
+	n = n + redis.call('DEL', unpack(keys, i, math.min(i + 499, #keys)))
+end
+redis.call('DEL', unpack(KEYS))
+return {n, keys}
+`)
+
+func (r *RedisCache) InvalidateTags(ctx context.Context, tags ...string) (int64, error) {
+	n, _, err := r.invalidateTags(ctx, tags)
+	return n, err
+}
+
+func (r *RedisCache) invalidateTags(ctx context.Context, tags []string) (_ int64, _ []string, err error) {
+	if len(tags) == 0 {
+		return 0, nil, nil
+	}
+	ctx, done := r.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	tagKeys := make([]string, len(tags))
+	for i, tag := range tags {
+		tagKeys[i] = tagPrefix + tag
+	}
+	res, err := invalidateTagsScript.Run(ctx, r.client, tagKeys).Slice()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, _ := res[0].(int64)
+	members, _ := res[1].([]interface{})
+	keys := make([]string, 0, len(members))
+	for _, m := range members {
+		if key, ok := m.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return n, keys, nil
+}
+
+// UserActivity returns the user's activity counter, or 0 if unset.
+func (r *RedisCache) UserActivity(ctx context.Context, userID string) (_ int64, err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheRead)
+	defer done(&err)
+
+	n, err := r.client.Get(ctx, activityPrefix+userID).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+// DeleteUser removes every key held for the user and returns how many
+// existed.
+func (r *RedisCache) DeleteUser(ctx context.Context, userID string) (_ int64, err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	return r.client.Del(ctx, recsPrefix+userID, activityPrefix+userID).Result()
+}
+
+func (r *RedisCache) Get(ctx context.Context, key string) (_ []byte, err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheRead)
+	defer done(&err)
+
+	val, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return val, err
+}
+
+func (r *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.setTagged(ctx, key, value, ttl, nil)
+}
+
+func (r *RedisCache) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (_ bool, err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	return r.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+// deleteIfEqualsScript deletes a key only if it holds the given value.
+var deleteIfEqualsScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func (r *RedisCache) DeleteIfEquals(ctx context.Context, key string, value []byte) (_ bool, err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	n, err := deleteIfEqualsScript.Run(ctx, r.client, []string{key}, value).Int64()
+	return n == 1, err
+}
+
+// Update reads and writes key under WATCH, retrying when another client
+// changed it in between.
+func (r *RedisCache) Update(ctx context.Context, key string, ttl time.Duration, fn func(current []byte) ([]byte, error)) (err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	update := func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, key).Bytes()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		value, err := fn(current)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, value, ttl)
+			return nil
+		})
+		return err
+	}
+
+	return watch(ctx, r.client, update, key)
+}
+
+// watch runs fn under WATCH on keys, retrying when another client changed
+// them first.
+func watch(ctx context.Context, client *redis.Client, fn func(tx *redis.Tx) error, keys ...string) (err error) {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		if attempt > 0 {
+			// Back off with jitter so contending writers spread out
+			time.Sleep(time.Duration(rand.Int63n(int64(attempt) * int64(time.Millisecond))))
+		}
+		err = client.Watch(ctx, fn, keys...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return err
+}
+
+func (r *RedisCache) Incr(ctx context.Context, key string) (_ int64, err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	return r.client.Incr(ctx, key).Result()
+}
+
+func (r *RedisCache) Delete(ctx context.Context, keys ...string) (_ int64, err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	if len(keys) == 0 {
+		return 0, nil
 	}
+	return r.client.Del(ctx, keys...).Result()
+}
 
-	var recommendations []map[string]interface{}
-	err = json.Unmarshal([]byte(val), &recommendations)
-	return recommendations, err
+// Publish sends payload to every subscriber of channel.
+func (r *RedisCache) Publish(ctx context.Context, channel string, payload []byte) (err error) {
+	ctx, done := r.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	return r.client.Publish(ctx, channel, payload).Err()
 }
 
-func (r *RedisCache) IncrementUserActivity(userID string) error {
-	key := "user_activity:" + userID
-	return r.client.Incr(r.ctx, key).Err()
-}
\ No newline at end of file
+// Subscribe calls handle with each message published on channel until ctx
+// is done. The client resubscribes after a lost connection; messages
+// published meanwhile are not delivered.
+func (r *RedisCache) Subscribe(ctx context.Context, channel string, handle func(payload []byte)) error {
+	sub := r.client.Subscribe(ctx, channel)
+	// Wait for the subscription to be confirmed
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return err
+	}
+
+	go func() {
+		defer sub.Close()
+		messages := sub.Channel()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				handle([]byte(msg.Payload))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,633 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"recommendation-engine/api/internal/timeout"
+)
+
+const (
+	sessionPrefix        = "session:"
+	sessionHistoryPrefix = "sessions:history:"
+	activeSessionsKey    = "sessions:active"
+	endedSessionsKey     = "sessions:ended"
+)
+
+// Session is one visit: a run of a user's events with no gap longer than
+// the inactivity gap. EndTime is set once the session has ended.
+type Session struct {
+	UserID      string     `json:"user_id"`
+	SessionID   string     `json:"session_id"`
+	StartTime   time.Time  `json:"start_time"`
+	LastActive  time.Time  `json:"last_active"`
+	EndTime     *time.Time `json:"end_time,omitempty"`
+	Events      int        `json:"events"`
+	PageViews   int        `json:"page_views"`
+	Clicks      int        `json:"clicks"`
+	SessionTime int        `json:"session_time"` // in seconds, start to last activity
+	Categories  []string   `json:"categories"`
+}
+
+// Status is "active" or "ended".
+func (s *Session) Status() string {
+	if s.EndTime != nil {
+		return "ended"
+	}
+	return "active"
+}
+
+func newSession(userID string, at time.Time) *Session {
+	return &Session{
+		UserID:     userID,
+		SessionID:  "session_" + userID + "_" + strconv.FormatInt(at.Unix(), 10),
+		StartTime:  at,
+		LastActive: at,
+		Categories: []string{},
+	}
+}
+
+// apply folds one event into the session.
+func (s *Session) apply(eventType, category string, at time.Time) {
+	if at.After(s.LastActive) {
+		s.LastActive = at
+	}
+	if at.Before(s.StartTime) {
+		s.StartTime = at
+	}
+	s.Events++
+	switch eventType {
+	case "view":
+		s.PageViews++
+		if category != "" && !containsString(s.Categories, category) {
+			s.Categories = append(s.Categories, category)
+		}
+	case "click":
+		s.Clicks++
+	}
+	s.SessionTime = int(s.LastActive.Sub(s.StartTime).Seconds())
+}
+
+// end returns a copy of the session ended at its last activity.
+func (s *Session) end() Session {
+	ended := *s
+	endTime := s.LastActive
+	ended.EndTime = &endTime
+	return ended
+}
+
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionConfig controls session boundaries and how much history is kept.
+type SessionConfig struct {
+	// Gap is how long a user may be inactive before their session ends.
+	Gap time.Duration
+	// HistoryPerUser is how many ended sessions are kept per user.
+	HistoryPerUser int
+	// HistoryTTL drops a user's history once they have been inactive this
+	// long.
+	HistoryTTL time.Duration
+	// MaxEnded is how many recently ended sessions are kept across users.
+	MaxEnded int
+}
+
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{Gap: 30 * time.Minute, HistoryPerUser: 20, HistoryTTL: 30 * 24 * time.Hour, MaxEnded: 1000}
+}
+
+// SessionConfigFromEnv returns DefaultSessionConfig overridden by
+// SESSION_GAP, SESSION_HISTORY, SESSION_HISTORY_TTL and SESSION_MAX_ENDED.
+func SessionConfigFromEnv() (SessionConfig, error) {
+	config := DefaultSessionConfig()
+	for _, setting := range []struct {
+		name string
+		dst  *int
+	}{
+		{"SESSION_HISTORY", &config.HistoryPerUser},
+		{"SESSION_MAX_ENDED", &config.MaxEnded},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return config, fmt.Errorf("%s: invalid count %q", setting.name, value)
+		}
+		*setting.dst = n
+	}
+	for _, setting := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"SESSION_GAP", &config.Gap},
+		{"SESSION_HISTORY_TTL", &config.HistoryTTL},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return config, fmt.Errorf("%s: invalid duration %q", setting.name, value)
+		}
+		*setting.dst = d
+	}
+	return config, nil
+}
+
+// Sessions tracks each user's current session and keeps ended sessions
+// with their final stats. An event more than Gap after the previous one
+// starts a new session; EndIdle ends sessions nobody has returned to.
+type Sessions interface {
+	// Track folds an event into the user's current session, ending it
+	// first when the event is more than Gap after its last activity.
+	// Events too old to belong to the current session are ignored.
+	Track(ctx context.Context, userID, eventType, category string, at time.Time) error
+	// User returns the user's current session, nil if they have none, and
+	// their ended sessions, newest first. A current session idle past Gap
+	// is reported as ended.
+	User(ctx context.Context, userID string) (*Session, []Session, error)
+	// Active returns up to n sessions active within Gap, most recent first.
+	Active(ctx context.Context, n int) ([]Session, error)
+	// Ended returns up to n ended sessions across users, newest first.
+	Ended(ctx context.Context, n int) ([]Session, error)
+	// EndIdle ends sessions idle longer than Gap and reports how many.
+	EndIdle(ctx context.Context) (int, error)
+	// DeleteUser removes the user's sessions and history and reports how
+	// many records were removed.
+	DeleteUser(ctx context.Context, userID string) (int64, error)
+	Config() SessionConfig
+}
+
+// track applies an event to current, returning the session to store and
+// the one it ended, if any. It returns nil, nil for events too old to
+// belong to current.
+func track(current *Session, config SessionConfig, userID, eventType, category string, at time.Time) (*Session, *Session) {
+	var ended *Session
+	switch {
+	case current == nil:
+		current = newSession(userID, at)
+	case at.Sub(current.LastActive) > config.Gap:
+		e := current.end()
+		ended = &e
+		current = newSession(userID, at)
+	case current.StartTime.Sub(at) > config.Gap:
+		return nil, nil
+	}
+	current.apply(eventType, category, at)
+	return current, ended
+}
+
+func idle(s *Session, config SessionConfig, now time.Time) bool {
+	return now.Sub(s.LastActive) > config.Gap
+}
+
+var _ Sessions = (*RedisSessions)(nil)
+
+// RedisSessions keeps each user's current session under its own key, with
+// a sorted set of users by last activity, a capped list of ended sessions
+// per user and a capped sorted set of recently ended sessions.
+type RedisSessions struct {
+	client *redis.Client
+	ops    *timeout.Tracker
+	config SessionConfig
+	clock  Clock
+}
+
+// Sessions returns a session store kept alongside the cache.
+func (r *RedisCache) Sessions(config SessionConfig) *RedisSessions {
+	return &RedisSessions{client: r.client, ops: r.ops, config: config, clock: SystemClock}
+}
+
+func (s *RedisSessions) Config() SessionConfig {
+	return s.config
+}
+
+func (s *RedisSessions) Track(ctx context.Context, userID, eventType, category string, at time.Time) (err error) {
+	ctx, done := s.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	key := sessionPrefix + userID
+	return watch(ctx, s.client, func(tx *redis.Tx) error {
+		current, err := s.load(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		current, ended := track(current, s.config, userID, eventType, category, at)
+		if current == nil {
+			return nil
+		}
+		value, err := json.Marshal(current)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if ended != nil {
+				if err := s.archive(ctx, pipe, *ended); err != nil {
+					return err
+				}
+			}
+			pipe.Set(ctx, key, value, s.config.HistoryTTL)
+			pipe.ZAdd(ctx, activeSessionsKey, redis.Z{Score: float64(current.LastActive.Unix()), Member: userID})
+			return nil
+		})
+		return err
+	}, key)
+}
+
+func (s *RedisSessions) User(ctx context.Context, userID string) (_ *Session, _ []Session, err error) {
+	ctx, done := s.ops.Start(ctx, timeout.CacheRead)
+	defer done(&err)
+
+	var current *redis.StringCmd
+	var history *redis.StringSliceCmd
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		current = pipe.Get(ctx, sessionPrefix+userID)
+		history = pipe.LRange(ctx, sessionHistoryPrefix+userID, 0, -1)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, nil, err
+	}
+
+	sessions, err := decodeSessions(history.Val())
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := current.Bytes()
+	if err == redis.Nil {
+		return nil, sessions, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	session := &Session{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, nil, err
+	}
+	if idle(session, s.config, s.clock.Now()) {
+		return nil, append([]Session{session.end()}, sessions...), nil
+	}
+	return session, sessions, nil
+}
+
+func (s *RedisSessions) Active(ctx context.Context, n int) (_ []Session, err error) {
+	ctx, done := s.ops.Start(ctx, timeout.CacheRead)
+	defer done(&err)
+
+	since := s.clock.Now().Add(-s.config.Gap).Unix()
+	users, err := s.client.ZRevRangeByScore(ctx, activeSessionsKey, &redis.ZRangeBy{
+		Min:   strconv.FormatInt(since, 10),
+		Max:   "+inf",
+		Count: int64(n),
+	}).Result()
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, len(users))
+	for i, userID := range users {
+		keys[i] = sessionPrefix + userID
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]Session, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue // Ended or deleted since the range was read
+		}
+		var session Session
+		if err := json.Unmarshal([]byte(data), &session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (s *RedisSessions) Ended(ctx context.Context, n int) (_ []Session, err error) {
+	ctx, done := s.ops.Start(ctx, timeout.CacheRead)
+	defer done(&err)
+
+	members, err := s.client.ZRevRange(ctx, endedSessionsKey, 0, int64(n-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeSessions(members)
+}
+
+// EndIdle moves each idle session to history under WATCH, so an event
+// arriving at the same time either lands in the old session before it is
+// archived or starts a new one.
+func (s *RedisSessions) EndIdle(ctx context.Context) (int, error) {
+	now := s.clock.Now()
+	users, err := s.idleUsers(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, userID := range users {
+		ended, err := s.endIdle(ctx, userID, now)
+		if err != nil {
+			return n, err
+		}
+		if ended {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *RedisSessions) idleUsers(ctx context.Context, now time.Time) (_ []string, err error) {
+	ctx, done := s.ops.Start(ctx, timeout.CacheRead)
+	defer done(&err)
+
+	cutoff := now.Add(-s.config.Gap).Unix()
+	return s.client.ZRangeByScore(ctx, activeSessionsKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(cutoff, 10),
+	}).Result()
+}
+
+func (s *RedisSessions) endIdle(ctx context.Context, userID string, now time.Time) (ended bool, err error) {
+	ctx, done := s.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	key := sessionPrefix + userID
+	err = watch(ctx, s.client, func(tx *redis.Tx) error {
+		current, err := s.load(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if current != nil && !idle(current, s.config, now) {
+			return nil // Active again
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if current != nil {
+				if err := s.archive(ctx, pipe, current.end()); err != nil {
+					return err
+				}
+				pipe.Del(ctx, key)
+			}
+			pipe.ZRem(ctx, activeSessionsKey, userID)
+			return nil
+		})
+		ended = err == nil && current != nil
+		return err
+	}, key)
+	return ended, err
+}
+
+func (s *RedisSessions) DeleteUser(ctx context.Context, userID string) (_ int64, err error) {
+	ctx, done := s.ops.Start(ctx, timeout.CacheWrite)
+	defer done(&err)
+
+	members, err := s.client.ZRange(ctx, endedSessionsKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	var theirs []interface{}
+	for _, member := range members {
+		var session Session
+		if json.Unmarshal([]byte(member), &session) == nil && session.UserID == userID {
+			theirs = append(theirs, member)
+		}
+	}
+
+	var deleted, history *redis.IntCmd
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.Del(ctx, sessionPrefix+userID)
+		history = pipe.LLen(ctx, sessionHistoryPrefix+userID)
+		pipe.Del(ctx, sessionHistoryPrefix+userID)
+		pipe.ZRem(ctx, activeSessionsKey, userID)
+		if len(theirs) > 0 {
+			pipe.ZRem(ctx, endedSessionsKey, theirs...)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// Ended sessions are counted once though they are also in the
+	// cross-user set
+	return deleted.Val() + history.Val(), nil
+}
+
+func (s *RedisSessions) load(ctx context.Context, tx *redis.Tx, key string) (*Session, error) {
+	data, err := tx.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	session := &Session{}
+	if err := json.Unmarshal(data, session); err != nil {
+		// Start over rather than fail every event for the user
+		return nil, nil
+	}
+	return session, nil
+}
+
+// archive queues an ended session onto the user's history and the
+// cross-user set, trimming both.
+func (s *RedisSessions) archive(ctx context.Context, pipe redis.Pipeliner, ended Session) error {
+	value, err := json.Marshal(ended)
+	if err != nil {
+		return err
+	}
+	historyKey := sessionHistoryPrefix + ended.UserID
+	pipe.LPush(ctx, historyKey, value)
+	pipe.LTrim(ctx, historyKey, 0, int64(s.config.HistoryPerUser-1))
+	pipe.Expire(ctx, historyKey, s.config.HistoryTTL)
+	pipe.ZAdd(ctx, endedSessionsKey, redis.Z{Score: float64(ended.EndTime.Unix()), Member: value})
+	pipe.ZRemRangeByRank(ctx, endedSessionsKey, 0, int64(-s.config.MaxEnded-1))
+	return nil
+}
+
+func decodeSessions(values []string) ([]Session, error) {
+	sessions := make([]Session, 0, len(values))
+	for _, value := range values {
+		var session Session
+		if err := json.Unmarshal([]byte(value), &session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+var _ Sessions = (*LocalSessions)(nil)
+
+// LocalSessions is the in-process Sessions used without Redis.
+type LocalSessions struct {
+	mu      sync.Mutex
+	config  SessionConfig
+	clock   Clock
+	current map[string]*Session
+	history map[string][]Session // newest first
+	ended   []Session            // newest first
+}
+
+func NewLocalSessions(config SessionConfig, clock Clock) *LocalSessions {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &LocalSessions{
+		config:  config,
+		clock:   clock,
+		current: make(map[string]*Session),
+		history: make(map[string][]Session),
+	}
+}
+
+func (s *LocalSessions) Config() SessionConfig {
+	return s.config
+}
+
+func (s *LocalSessions) Track(ctx context.Context, userID, eventType, category string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ended := track(s.current[userID], s.config, userID, eventType, category, at)
+	if current == nil {
+		return nil
+	}
+	if ended != nil {
+		s.archive(*ended)
+	}
+	s.current[userID] = current
+	return nil
+}
+
+func (s *LocalSessions) User(ctx context.Context, userID string) (*Session, []Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := append([]Session(nil), s.history[userID]...)
+	current, exists := s.current[userID]
+	if !exists {
+		return nil, history, nil
+	}
+	if idle(current, s.config, s.clock.Now()) {
+		return nil, append([]Session{current.end()}, history...), nil
+	}
+	copied := *current
+	copied.Categories = append([]string(nil), current.Categories...)
+	return &copied, history, nil
+}
+
+func (s *LocalSessions) Active(ctx context.Context, n int) ([]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	sessions := make([]Session, 0, len(s.current))
+	for _, session := range s.current {
+		if !idle(session, s.config, now) {
+			copied := *session
+			copied.Categories = append([]string(nil), session.Categories...)
+			sessions = append(sessions, copied)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastActive.After(sessions[j].LastActive)
+	})
+	if len(sessions) > n {
+		sessions = sessions[:n]
+	}
+	return sessions, nil
+}
+
+func (s *LocalSessions) Ended(ctx context.Context, n int) ([]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n > len(s.ended) {
+		n = len(s.ended)
+	}
+	return append([]Session(nil), s.ended[:n]...), nil
+}
+
+func (s *LocalSessions) EndIdle(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	n := 0
+	for userID, session := range s.current {
+		if idle(session, s.config, now) {
+			s.archive(session.end())
+			delete(s.current, userID)
+			n++
+		}
+	}
+	for userID, history := range s.history {
+		if _, active := s.current[userID]; !active && now.Sub(*history[0].EndTime) > s.config.HistoryTTL {
+			delete(s.history, userID)
+		}
+	}
+	return n, nil
+}
+
+func (s *LocalSessions) DeleteUser(ctx context.Context, userID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	if _, exists := s.current[userID]; exists {
+		delete(s.current, userID)
+		n++
+	}
+	n += int64(len(s.history[userID]))
+	delete(s.history, userID)
+
+	kept := s.ended[:0]
+	for _, session := range s.ended {
+		if session.UserID != userID {
+			kept = append(kept, session)
+		}
+	}
+	s.ended = kept
+	return n, nil
+}
+
+// archive keeps an ended session in the user's history and the
+// cross-user list, newest first.
+func (s *LocalSessions) archive(ended Session) {
+	history := append([]Session{ended}, s.history[ended.UserID]...)
+	if len(history) > s.config.HistoryPerUser {
+		history = history[:s.config.HistoryPerUser]
+	}
+	s.history[ended.UserID] = history
+
+	// Sessions usually end in order; insert by end time for those that
+	// do not
+	i := sort.Search(len(s.ended), func(i int) bool {
+		return !s.ended[i].EndTime.After(*ended.EndTime)
+	})
+	s.ended = append(s.ended, Session{})
+	copy(s.ended[i+1:], s.ended[i:])
+	s.ended[i] = ended
+	if len(s.ended) > s.config.MaxEnded {
+		s.ended = s.ended[:s.config.MaxEnded]
+	}
+}
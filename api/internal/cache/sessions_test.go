@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocalSessionsBoundaries(t *testing.T) {
+	gap := DefaultSessionConfig().Gap
+	tests := []struct {
+		name          string
+		events        []time.Duration // event times after testStart, in arrival order
+		sessionEvents int             // events in the current session
+		start         time.Duration   // start of the current session
+		history       int
+	}{
+		{"event at the gap continues the session", []time.Duration{0, gap}, 2, 0, 0},
+		{"event past the gap starts a new session", []time.Duration{0, gap + time.Second}, 1, gap + time.Second, 1},
+		{"late event within the gap moves the start back", []time.Duration{40 * time.Minute, 15 * time.Minute}, 2, 15 * time.Minute, 0},
+		{"event more than the gap before the start is ignored", []time.Duration{40 * time.Minute, 5 * time.Minute}, 1, 40 * time.Minute, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := NewFakeClock(testStart.Add(gap))
+			s := NewLocalSessions(DefaultSessionConfig(), clock)
+			for _, at := range tt.events {
+				if err := s.Track(ctx, "u1", "view", "tech", testStart.Add(at)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			current, history, err := s.User(ctx, "u1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current == nil {
+				t.Fatal("no current session")
+			}
+			if current.Events != tt.sessionEvents {
+				t.Errorf("events = %d, want %d", current.Events, tt.sessionEvents)
+			}
+			if want := testStart.Add(tt.start); !current.StartTime.Equal(want) {
+				t.Errorf("start = %s, want %s", current.StartTime, want)
+			}
+			if len(history) != tt.history {
+				t.Errorf("history = %d sessions, want %d", len(history), tt.history)
+			}
+		})
+	}
+}
+
+func TestLocalSessionsIdle(t *testing.T) {
+	gap := DefaultSessionConfig().Gap
+	tests := []struct {
+		name   string
+		idle   time.Duration
+		active bool
+	}{
+		{"idle for less than the gap", gap - time.Second, true},
+		{"idle for the gap", gap, true},
+		{"idle past the gap", gap + time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := NewFakeClock(testStart)
+			s := NewLocalSessions(DefaultSessionConfig(), clock)
+			s.Track(ctx, "u1", "view", "tech", clock.Now())
+			clock.Advance(tt.idle)
+
+			current, history, err := s.User(ctx, "u1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if active := current != nil; active != tt.active {
+				t.Errorf("User reports active = %v, want %v", active, tt.active)
+			}
+			if !tt.active && (len(history) != 1 || !history[0].EndTime.Equal(testStart)) {
+				t.Errorf("history = %+v, want one session ended at its last activity", history)
+			}
+
+			ended, err := s.EndIdle(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			if !tt.active {
+				want = 1
+			}
+			if ended != want {
+				t.Errorf("EndIdle ended %d, want %d", ended, want)
+			}
+			active, err := s.Active(ctx, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(active) == 1; got != tt.active {
+				t.Errorf("Active lists the session = %v, want %v", got, tt.active)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+)
+
+// InvalidationChannel is the Redis pub/sub channel Tiered caches use to
+// tell each other which keys changed.
+const InvalidationChannel = "cache:invalidate"
+
+var _ Cache = (*Tiered)(nil)
+
+// generationStripes is how many generation counters guard local refills.
+// Keys share counters, so an invalidation can also skip the refill of an
+// unrelated key; that only costs a Redis read later.
+const generationStripes = 256
+
+// invalidation names the keys another instance must drop from its local
+// tier: the listed keys and, if set, every key under Prefix.
+type invalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+}
+
+// Tiered is a near cache: reads are served from an in-process LRU when it
+// holds the key and from Redis otherwise. Every write goes to Redis and is
+// broadcast on InvalidationChannel, so other instances drop their local
+// copy. Local copies live at most localTTL, which bounds staleness when an
+// invalidation is missed. Counters are always read from Redis.
+//
+// A read that misses locally copies the Redis value into the local tier
+// only if no write or invalidation touched the key meanwhile, so a value
+// deleted while it was being read is not put back.
+type Tiered struct {
+	remote   *RedisCache
+	local    *LRU
+	localTTL time.Duration
+	origin   string
+	stop     context.CancelFunc
+
+	mu          sync.Mutex // orders local writes against refills
+	generations [generationStripes]uint64
+}
+
+// NewTiered subscribes to invalidations from other instances and returns
+// the cache. Close stops the subscription.
+func NewTiered(remote *RedisCache, local *LRU, localTTL time.Duration) (*Tiered, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	t := &Tiered{remote: remote, local: local, localTTL: localTTL, origin: hex.EncodeToString(id)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := remote.Subscribe(ctx, InvalidationChannel, t.handleInvalidation); err != nil {
+		cancel()
+		return nil, err
+	}
+	t.stop = cancel
+	return t, nil
+}
+
+// Remote returns the Redis tier.
+func (t *Tiered) Remote() *RedisCache {
+	return t.remote
+}
+
+// Close stops listening for invalidations.
+func (t *Tiered) Close() {
+	t.stop()
+}
+
+func (t *Tiered) GetUserRecommendations(ctx context.Context, userID string, dst interface{}) (bool, error) {
+	val, err := t.Get(ctx, recsPrefix+userID)
+	if val == nil || err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(val, dst)
+}
+
+func (t *Tiered) SetUserRecommendations(ctx context.Context, userID string, recommendations interface{}, ttl time.Duration, tags ...string) error {
+	jsonData, err := json.Marshal(recommendations)
+	if err != nil {
+		return err
+	}
+	return t.set(ctx, recsPrefix+userID, jsonData, ttl, tags)
+}
+
+func (t *Tiered) InvalidateUserRecommendations(ctx context.Context, userID string) error {
+	_, err := t.Delete(ctx, recsPrefix+userID)
+	return err
+}
+
+func (t *Tiered) InvalidateAllRecommendations(ctx context.Context) error {
+	err := t.remote.InvalidateAllRecommendations(ctx)
+	// Redis may have applied the delete even when the call failed
+	t.dropLocalPrefix(recsPrefix)
+	t.publish(ctx, invalidation{Prefix: recsPrefix})
+	return err
+}
+
+// InvalidateTags finds the tagged keys in Redis, so local copies are
+// dropped on every instance even though only Redis holds the tags.
+func (t *Tiered) InvalidateTags(ctx context.Context, tags ...string) (int64, error) {
+	n, keys, err := t.remote.invalidateTags(ctx, tags)
+	if err != nil {
+		return 0, err
+	}
+	if len(keys) > 0 {
+		t.dropLocal(keys...)
+		t.publish(ctx, invalidation{Keys: keys})
+	}
+	return n, nil
+}
+
+func (t *Tiered) IncrementUserActivity(ctx context.Context, userID string) error {
+	return t.remote.IncrementUserActivity(ctx, userID)
+}
+
+func (t *Tiered) UserActivity(ctx context.Context, userID string) (int64, error) {
+	return t.remote.UserActivity(ctx, userID)
+}
+
+func (t *Tiered) DeleteUser(ctx context.Context, userID string) (int64, error) {
+	return t.Delete(ctx, recsPrefix+userID, activityPrefix+userID)
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) ([]byte, error) {
+	if val, _ := t.local.Get(ctx, key); val != nil {
+		return val, nil
+	}
+	generation := t.generation(key)
+	val, err := t.remote.Get(ctx, key)
+	if val == nil || err != nil {
+		return nil, err
+	}
+	t.refill(key, val, generation)
+	return val, nil
+}
+
+func (t *Tiered) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return t.set(ctx, key, value, ttl, nil)
+}
+
+func (t *Tiered) set(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string) error {
+	if err := t.remote.setTagged(ctx, key, value, ttl, tags); err != nil {
+		return err
+	}
+	localTTL := t.localTTL
+	if ttl > 0 && ttl < localTTL {
+		localTTL = ttl
+	}
+	t.mu.Lock()
+	t.generations[stripe(key)]++
+	t.local.Set(ctx, key, value, localTTL)
+	t.mu.Unlock()
+	t.publish(ctx, invalidation{Keys: []string{key}})
+	return nil
+}
+
+// SetNX goes straight to Redis so the lock holds across instances.
+func (t *Tiered) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return t.remote.SetNX(ctx, key, value, ttl)
+}
+
+// DeleteIfEquals goes straight to Redis, like SetNX.
+func (t *Tiered) DeleteIfEquals(ctx context.Context, key string, value []byte) (bool, error) {
+	return t.remote.DeleteIfEquals(ctx, key, value)
+}
+
+func (t *Tiered) Incr(ctx context.Context, key string) (int64, error) {
+	n, err := t.remote.Incr(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	t.dropLocal(key)
+	t.publish(ctx, invalidation{Keys: []string{key}})
+	return n, nil
+}
+
+// Delete removes keys from Redis before the local tiers, so a concurrent
+// read cannot copy the old value back. Local copies are dropped and other
+// instances told even when Redis fails, since it may have applied the
+// delete.
+func (t *Tiered) Delete(ctx context.Context, keys ...string) (int64, error) {
+	n, err := t.remote.Delete(ctx, keys...)
+	t.dropLocal(keys...)
+	t.publish(ctx, invalidation{Keys: keys})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func stripe(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % generationStripes)
+}
+
+// generation is read before a Redis read that may refill key locally.
+func (t *Tiered) generation(key string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.generations[stripe(key)]
+}
+
+// refill copies a value read from Redis into the local tier unless key was
+// written or invalidated since generation was read.
+func (t *Tiered) refill(key string, value []byte, generation uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.generations[stripe(key)] != generation {
+		return
+	}
+	t.local.Set(context.Background(), key, value, t.localTTL)
+}
+
+// dropLocal removes keys from the local tier and stops reads in flight
+// from putting them back.
+func (t *Tiered) dropLocal(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		t.generations[stripe(key)]++
+	}
+	t.local.Delete(context.Background(), keys...)
+}
+
+// dropLocalPrefix removes every local key under prefix and stops reads in
+// flight from putting any back.
+func (t *Tiered) dropLocalPrefix(prefix string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.generations {
+		t.generations[i]++
+	}
+	t.local.deletePrefix(prefix)
+}
+
+// publish tells other instances to drop keys from their local tier. A
+// failed publish leaves their copies to expire after localTTL.
+func (t *Tiered) publish(ctx context.Context, msg invalidation) {
+	msg.Origin = t.origin
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	if err := t.remote.Publish(ctx, InvalidationChannel, payload); err != nil {
+		log.Printf("Warning: failed to broadcast cache invalidation: %v", err)
+	}
+}
+
+func (t *Tiered) handleInvalidation(payload []byte) {
+	var msg invalidation
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Printf("Warning: ignoring malformed cache invalidation: %v", err)
+		return
+	}
+	if msg.Origin == t.origin {
+		return
+	}
+	if len(msg.Keys) > 0 {
+		t.dropLocal(msg.Keys...)
+	}
+	if msg.Prefix != "" {
+		t.dropLocalPrefix(msg.Prefix)
+	}
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// A Redis read that races with a delete or write must not put its value
+// back into the local tier.
+func TestTieredRefillAfterInvalidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(tc *Tiered)
+		refilled   bool
+	}{
+		{"no invalidation", func(tc *Tiered) {}, true},
+		{"key deleted", func(tc *Tiered) { tc.dropLocal("recs:u1") }, false},
+		{"prefix deleted", func(tc *Tiered) { tc.dropLocalPrefix(recsPrefix) }, false},
+		{"other instance deleted it", func(tc *Tiered) {
+			tc.handleInvalidation([]byte(`{"origin":"other","keys":["recs:u1"]}`))
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := &Tiered{local: NewLRU(10, NewFakeClock(testStart)), localTTL: 30 * time.Second, origin: "self"}
+			generation := tc.generation("recs:u1")
+			tt.invalidate(tc)
+			tc.refill("recs:u1", []byte("stale"), generation)
+
+			val, _ := tc.local.Get(context.Background(), "recs:u1")
+			if refilled := val != nil; refilled != tt.refilled {
+				t.Errorf("refilled = %v, want %v", refilled, tt.refilled)
+			}
+		})
+	}
+}
@@ -1,15 +1,33 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
+	"recommendation-engine/api/internal/timeout"
 )
 
+var _ storage.Store = (*DB)(nil)
+
+// recentViewsWindow bounds how far back GetUserRecentViews looks.
+const recentViewsWindow = 30 * 24 * time.Hour
+
+// DB is the Postgres store. Writes and reads that must see them use the
+// primary pool; lag-tolerant reads may go to replicas added with
+// AddReplicas.
 type DB struct {
 	*sql.DB
+	ops      *timeout.Tracker
+	replicas *replicaSet
 }
 
 func NewPostgresDB(connectionString string) (*DB, error) {
@@ -29,26 +47,132 @@ func NewPostgresDB(connectionString string) (*DB, error) {
 	db.SetConnMaxLifetime(5 * time.Minute)
 
 	log.Println("✅ Connected to PostgreSQL")
-	return &DB{db}, nil
+	return &DB{DB: db, ops: timeout.NewTracker(timeout.DefaultConfig())}, nil
+}
+
+// SetTimeouts replaces the tracker that bounds and counts queries, so the
+// database and cache can share one set of timeouts and counters.
+func (db *DB) SetTimeouts(ops *timeout.Tracker) {
+	db.ops = ops
+}
+
+func (db *DB) LogUserEvent(ctx context.Context, e models.UserEvent) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	var flags []byte
+	if len(e.Flags) > 0 {
+		if flags, err = json.Marshal(e.Flags); err != nil {
+			return err
+		}
+	}
+
+	// user_events.user_id references users(id). last_active is maintained
+	// in batches through TouchUsers, so existing users are left alone here.
+	if _, err := db.ExecContext(ctx, `INSERT INTO users (id, last_active) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`,
+		e.UserID, e.Timestamp); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO user_events (user_id, item_id, event_type, duration_seconds, request_id, event_time, quality_flags) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err = db.ExecContext(ctx, query, e.UserID, e.ItemID, e.EventType, e.Duration, nullString(e.RequestID), e.Timestamp, flags)
+	if isForeignKeyViolation(err, "user_events_item_id_fkey") {
+		return storage.ErrUnknownItem
+	}
+	return err
+}
+
+// LogQuarantinedEvent stores an event rejected by the event-quality filter
+// in quarantined_events for later review.
+func (db *DB) LogQuarantinedEvent(ctx context.Context, e models.UserEvent, userAgent string, reasons []string) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	reasonsJSON, err := json.Marshal(reasons)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO quarantined_events
+			(user_id, item_id, event_type, duration_seconds, event_time, received_at, request_id, user_agent, reasons)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err = db.ExecContext(ctx, query, e.UserID, e.ItemID, e.EventType, e.Duration, e.Timestamp, e.ReceivedAt,
+		nullString(e.RequestID), nullString(userAgent), reasonsJSON)
+	return err
 }
 
-func (db *DB) LogUserEvent(userID, itemID, eventType string, duration *int) error {
+// LogRecommendationsServed records a served list in recommendations_served
+// so later events carrying its request ID can be attributed.
+func (db *DB) LogRecommendationsServed(ctx context.Context, imp models.Impression) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	items, err := json.Marshal(imp.Items)
+	if err != nil {
+		return err
+	}
+
+	// recommendations_served.user_id references users(id)
+	if _, err := db.ExecContext(ctx, `INSERT INTO users (id) VALUES ($1) ON CONFLICT (id) DO NOTHING`, imp.UserID); err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO user_events (user_id, item_id, event_type, duration_seconds) 
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO recommendations_served
+			(request_id, user_id, recommended_items, strategy, experiment_name, ab_test_variant, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
-	_, err := db.Exec(query, userID, itemID, eventType, duration)
+	_, err = db.ExecContext(ctx, query, imp.RequestID, imp.UserID, items, imp.Strategy,
+		nullString(imp.Experiment), nullString(imp.Variant), imp.ServedAt)
 	return err
 }
 
-func (db *DB) GetUserRecentViews(userID string, limit int) ([]string, error) {
+// GetRecommendationsServed loads a served list by request ID. It returns
+// nil if no list was logged under that ID.
+func (db *DB) GetRecommendationsServed(ctx context.Context, requestID string) (_ *models.Impression, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	query := `
+		SELECT request_id, user_id, recommended_items, strategy,
+			COALESCE(experiment_name, ''), COALESCE(ab_test_variant, ''), created_at
+		FROM recommendations_served
+		WHERE request_id = $1
+	`
+	var imp models.Impression
+	var items []byte
+	err = db.QueryRowContext(ctx, query, requestID).Scan(&imp.RequestID, &imp.UserID, &items, &imp.Strategy,
+		&imp.Experiment, &imp.Variant, &imp.ServedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(items, &imp.Items); err != nil {
+		return nil, err
+	}
+	return &imp, nil
+}
+
+// GetUserRecentViews only looks back recentViewsWindow, which keeps the
+// query to the newest user_events partitions.
+func (db *DB) GetUserRecentViews(ctx context.Context, userID string, limit int) (_ []string, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
 	query := `
 		SELECT item_id FROM user_events 
-		WHERE user_id = $1 AND event_type = 'view' 
-		ORDER BY created_at DESC 
+		WHERE user_id = $1 AND event_type = 'view' AND event_time >= $3
+		ORDER BY event_time DESC 
 		LIMIT $2
 	`
-	rows, err := db.Query(query, userID, limit)
+	rows, err := db.queryReplica(ctx, query, userID, limit, time.Now().UTC().Add(-recentViewsWindow))
 	if err != nil {
 		return nil, err
 	}
@@ -63,5 +187,79 @@ func (db *DB) GetUserRecentViews(userID string, limit int) ([]string, error) {
 		items = append(items, itemID)
 	}
 
-	return items, nil
-}
\ No newline at end of file
+	return items, rows.Err()
+}
+
+// ForEachUserEvent streams events whose event time falls in [from, to),
+// in the order they were received so late-event handling replays exactly.
+// A zero bound is open. Bounds are only added to the query when set, so
+// Postgres reads just the partitions that overlap the range.
+func (db *DB) ForEachUserEvent(ctx context.Context, from, to time.Time, fn func(models.UserEvent) error) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBScan)
+	defer done(&err)
+
+	query := `SELECT ` + eventColumns + ` FROM user_events WHERE TRUE`
+	var args []interface{}
+	if !from.IsZero() {
+		args = append(args, from)
+		query += fmt.Sprintf(` AND event_time >= $%d`, len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to)
+		query += fmt.Sprintf(` AND event_time < $%d`, len(args))
+	}
+	query += ` ORDER BY created_at, id`
+
+	rows, err := db.queryReplica(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+const eventColumns = `user_id, item_id, event_type, duration_seconds, event_time, created_at,
+	COALESCE(request_id, ''), quality_flags`
+
+func scanEvent(row scanner) (models.UserEvent, error) {
+	var e models.UserEvent
+	var duration sql.NullInt32
+	var flags []byte
+	if err := row.Scan(&e.UserID, &e.ItemID, &e.EventType, &duration, &e.Timestamp, &e.ReceivedAt, &e.RequestID, &flags); err != nil {
+		return e, err
+	}
+	if duration.Valid {
+		d := int(duration.Int32)
+		e.Duration = &d
+	}
+	if len(flags) > 0 {
+		if err := json.Unmarshal(flags, &e.Flags); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+func isForeignKeyViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503" && pqErr.Constraint == constraint
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lib/pq"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
+	"recommendation-engine/api/internal/timeout"
+)
+
+const itemColumns = `id, title, COALESCE(description, ''), COALESCE(category, ''), tags, embedding_vector, created_at, updated_at`
+
+func (db *DB) GetItem(ctx context.Context, id string) (_ *models.ContentItem, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	row := db.QueryRowContext(ctx, `SELECT `+itemColumns+` FROM content_items WHERE id = $1 AND deleted_at IS NULL`, id)
+	item, err := scanItem(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (db *DB) ListItems(ctx context.Context, category string, limit int) (_ []models.ContentItem, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	query := `
+		SELECT ` + itemColumns + `
+		FROM content_items
+		WHERE deleted_at IS NULL AND ($1 = '' OR category = $1)
+		ORDER BY created_at DESC, id
+		LIMIT $2
+	`
+	rows, err := db.QueryContext(ctx, query, category, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.ContentItem
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	return items, rows.Err()
+}
+
+func (db *DB) CreateItem(ctx context.Context, item models.ContentItem) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	tags, err := marshalTags(item.Tags)
+	if err != nil {
+		return err
+	}
+
+	// A soft-deleted row with the same ID is restored rather than rejected
+	query := `
+		INSERT INTO content_items (id, title, description, category, tags, embedding_vector)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			title = EXCLUDED.title,
+			description = EXCLUDED.description,
+			category = EXCLUDED.category,
+			tags = EXCLUDED.tags,
+			embedding_vector = EXCLUDED.embedding_vector,
+			created_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP,
+			deleted_at = NULL
+		WHERE content_items.deleted_at IS NOT NULL
+	`
+	result, err := db.ExecContext(ctx, query, item.ID, item.Title, nullString(item.Description), nullString(item.Category),
+		tags, pq.Array(item.Embedding))
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result, storage.ErrAlreadyExists)
+}
+
+func (db *DB) UpdateItem(ctx context.Context, item models.ContentItem) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	tags, err := marshalTags(item.Tags)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE content_items SET
+			title = $2,
+			description = $3,
+			category = $4,
+			tags = $5,
+			embedding_vector = $6,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	result, err := db.ExecContext(ctx, query, item.ID, item.Title, nullString(item.Description), nullString(item.Category),
+		tags, pq.Array(item.Embedding))
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result, storage.ErrNotFound)
+}
+
+func (db *DB) UpsertItems(ctx context.Context, items []models.ContentItem) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBBatch)
+	defer done(&err)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO content_items (id, title, description, category, tags, embedding_vector)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			title = EXCLUDED.title,
+			description = EXCLUDED.description,
+			category = EXCLUDED.category,
+			tags = EXCLUDED.tags,
+			embedding_vector = EXCLUDED.embedding_vector,
+			updated_at = CURRENT_TIMESTAMP,
+			deleted_at = NULL
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, item := range items {
+		tags, err := marshalTags(item.Tags)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, item.ID, item.Title, nullString(item.Description), nullString(item.Category),
+			tags, pq.Array(item.Embedding)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *DB) DeleteItem(ctx context.Context, id string) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE content_items SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result, storage.ErrNotFound)
+}
+
+func (db *DB) EnsureItems(ctx context.Context, items []models.ContentItem) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBBatch)
+	defer done(&err)
+
+	for _, item := range items {
+		tags, err := marshalTags(item.Tags)
+		if err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx, `
+			INSERT INTO content_items (id, title, description, category, tags, embedding_vector)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (id) DO NOTHING
+		`, item.ID, item.Title, nullString(item.Description), nullString(item.Category), tags, pq.Array(item.Embedding))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanItem(row scanner) (*models.ContentItem, error) {
+	var item models.ContentItem
+	var tags []byte
+	err := row.Scan(&item.ID, &item.Title, &item.Description, &item.Category, &tags,
+		pq.Array(&item.Embedding), &item.CreatedAt, &item.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) > 0 {
+		if err := json.Unmarshal(tags, &item.Tags); err != nil {
+			return nil, err
+		}
+	}
+	return &item, nil
+}
+
+func marshalTags(tags []string) ([]byte, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	return json.Marshal(tags)
+}
+
+func expectOneRow(result sql.Result, errNone error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNone
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package database
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"recommendation-engine/api/internal/timeout"
+)
+
+// PartitionInterval is the span of event time covered by one user_events
+// partition.
+type PartitionInterval string
+
+const (
+	Monthly PartitionInterval = "month"
+	Daily   PartitionInterval = "day"
+)
+
+const (
+	partitionPrefix  = "user_events_p"
+	defaultPartition = "user_events_default"
+)
+
+// PartitionPolicy controls how user_events partitions are created and
+// retired.
+type PartitionPolicy struct {
+	Interval PartitionInterval
+	// Ahead is how many partitions after the current one are kept created.
+	Ahead int
+	// Retention removes partitions that end more than Retention ago. Zero
+	// keeps everything.
+	Retention time.Duration
+	// ArchiveDir, if set, receives a gzipped NDJSON copy of each partition
+	// before it is dropped. The files can be read by cmd/replay.
+	ArchiveDir string
+}
+
+func DefaultPartitionPolicy() PartitionPolicy {
+	return PartitionPolicy{Interval: Monthly, Ahead: 2}
+}
+
+// PartitionPolicyFromEnv returns DefaultPartitionPolicy overridden by
+// EVENT_PARTITION_INTERVAL (month or day), EVENT_PARTITIONS_AHEAD,
+// EVENT_RETENTION_DAYS and EVENT_ARCHIVE_DIR.
+func PartitionPolicyFromEnv() (PartitionPolicy, error) {
+	p := DefaultPartitionPolicy()
+	if value := os.Getenv("EVENT_PARTITION_INTERVAL"); value != "" {
+		switch PartitionInterval(value) {
+		case Monthly, Daily:
+			p.Interval = PartitionInterval(value)
+		default:
+			return p, fmt.Errorf("EVENT_PARTITION_INTERVAL: want month or day, got %q", value)
+		}
+	}
+	if value := os.Getenv("EVENT_PARTITIONS_AHEAD"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("EVENT_PARTITIONS_AHEAD: invalid count %q", value)
+		}
+		p.Ahead = n
+	}
+	if value := os.Getenv("EVENT_RETENTION_DAYS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("EVENT_RETENTION_DAYS: invalid count %q", value)
+		}
+		p.Retention = time.Duration(n) * 24 * time.Hour
+	}
+	p.ArchiveDir = os.Getenv("EVENT_ARCHIVE_DIR")
+	return p, nil
+}
+
+// Partition is one range partition of user_events covering event times in
+// [From, To).
+type Partition struct {
+	Name string    `json:"name"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+func (p Partition) overlaps(other Partition) bool {
+	return p.From.Before(other.To) && other.From.Before(p.To)
+}
+
+// partitionFor returns the partition of the given interval containing t.
+func partitionFor(t time.Time, interval PartitionInterval) Partition {
+	t = t.UTC()
+	if interval == Daily {
+		from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return Partition{Name: partitionPrefix + from.Format("20060102"), From: from, To: from.AddDate(0, 0, 1)}
+	}
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return Partition{Name: partitionPrefix + from.Format("200601"), From: from, To: from.AddDate(0, 1, 0)}
+}
+
+// parsePartition recovers a partition's range from its name, so monthly
+// and daily partitions can coexist after the interval is changed.
+func parsePartition(name string) (Partition, bool) {
+	suffix := strings.TrimPrefix(name, partitionPrefix)
+	if suffix == name {
+		return Partition{}, false
+	}
+	switch len(suffix) {
+	case 6:
+		if from, err := time.Parse("200601", suffix); err == nil {
+			return partitionFor(from, Monthly), true
+		}
+	case 8:
+		if from, err := time.Parse("20060102", suffix); err == nil {
+			return partitionFor(from, Daily), true
+		}
+	}
+	return Partition{}, false
+}
+
+// Partitions lists the range partitions of user_events, oldest first. The
+// default partition is not included.
+func (db *DB) Partitions(ctx context.Context) (_ []Partition, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT child.relname
+		FROM pg_inherits
+		JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+		JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		WHERE parent.relname = 'user_events'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []Partition
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if p, ok := parsePartition(name); ok {
+			partitions = append(partitions, p)
+		}
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].From.Before(partitions[j].From)
+	})
+	return partitions, rows.Err()
+}
+
+// EnsurePartitions creates the partition containing now, policy.Ahead
+// partitions after it, and partitions for any rows waiting in the default
+// partition. Periods already covered by a partition of either interval are
+// skipped. It returns the partitions created.
+func (db *DB) EnsurePartitions(ctx context.Context, policy PartitionPolicy, now time.Time) ([]Partition, error) {
+	existing, err := db.Partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := []Partition{partitionFor(now, policy.Interval)}
+	for i := 0; i < policy.Ahead; i++ {
+		wanted = append(wanted, partitionFor(wanted[len(wanted)-1].To, policy.Interval))
+	}
+	stranded, err := db.defaultPartitionPeriods(ctx, policy.Interval)
+	if err != nil {
+		return nil, err
+	}
+	wanted = append(wanted, stranded...)
+
+	var created []Partition
+	for _, p := range wanted {
+		covered := false
+		for _, e := range existing {
+			if e.overlaps(p) {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+		if err := db.createPartition(ctx, p); err != nil {
+			return created, fmt.Errorf("create %s: %w", p.Name, err)
+		}
+		existing = append(existing, p)
+		created = append(created, p)
+	}
+	return created, nil
+}
+
+// defaultPartitionPeriods returns the partitions needed for rows that fell
+// into the default partition because nothing covered them yet.
+func (db *DB) defaultPartitionPeriods(ctx context.Context, interval PartitionInterval) (_ []Partition, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBScan)
+	defer done(&err)
+
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT date_trunc($1, event_time) FROM `+defaultPartition, string(interval))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []Partition
+	for rows.Next() {
+		var start time.Time
+		if err := rows.Scan(&start); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, partitionFor(start, interval))
+	}
+	return partitions, rows.Err()
+}
+
+// createPartition builds the partition as a plain table, moves any of its
+// rows out of the default partition, then attaches it. Attaching a range
+// that still has rows in the default partition would fail.
+func (db *DB) createPartition(ctx context.Context, p Partition) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBBatch)
+	defer done(&err)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	name := pq.QuoteIdentifier(p.Name)
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE `+name+` (LIKE user_events INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		WITH moved AS (
+			DELETE FROM `+defaultPartition+` WHERE event_time >= $1 AND event_time < $2 RETURNING *
+		)
+		INSERT INTO `+name+` SELECT * FROM moved
+	`, p.From, p.To)
+	if err != nil {
+		return err
+	}
+	// Partition bounds cannot be bind parameters
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE user_events ATTACH PARTITION %s FOR VALUES FROM (%s) TO (%s)`,
+		name, pq.QuoteLiteral(p.From.Format(time.DateTime)), pq.QuoteLiteral(p.To.Format(time.DateTime))))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ApplyRetention removes partitions that ended more than policy.Retention
+// before now, archiving each to policy.ArchiveDir first when it is set. It
+// returns the partitions removed.
+func (db *DB) ApplyRetention(ctx context.Context, policy PartitionPolicy, now time.Time) ([]Partition, error) {
+	if policy.Retention <= 0 {
+		return nil, nil
+	}
+	partitions, err := db.Partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := now.Add(-policy.Retention)
+	var removed []Partition
+	for _, p := range partitions {
+		if p.To.After(cutoff) {
+			break
+		}
+		if policy.ArchiveDir != "" {
+			path, err := db.archivePartition(ctx, p, policy.ArchiveDir)
+			if err != nil {
+				return removed, fmt.Errorf("archive %s: %w", p.Name, err)
+			}
+			log.Printf("🗄️  Archived %s to %s", p.Name, path)
+		}
+		if err := db.dropPartition(ctx, p); err != nil {
+			return removed, fmt.Errorf("drop %s: %w", p.Name, err)
+		}
+		removed = append(removed, p)
+	}
+	return removed, nil
+}
+
+// archivePartition writes a partition's events to dir/<name>.ndjson.gz in
+// the event log format. The file is written under a temporary name and
+// renamed once synced, so a crash never leaves a partial archive behind a
+// dropped partition.
+func (db *DB) archivePartition(ctx context.Context, p Partition, dir string) (_ string, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBScan)
+	defer done(&err)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, p.Name+".ndjson.gz")
+	tmp, err := os.CreateTemp(dir, p.Name+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gz := gzip.NewWriter(tmp)
+	enc := json.NewEncoder(gz)
+
+	rows, err := db.QueryContext(ctx, `SELECT `+eventColumns+` FROM `+pq.QuoteIdentifier(p.Name)+` ORDER BY created_at, id`)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return "", err
+		}
+		if err := enc.Encode(e); err != nil {
+			return "", err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+func (db *DB) dropPartition(ctx context.Context, p Partition) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBBatch)
+	defer done(&err)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	name := pq.QuoteIdentifier(p.Name)
+	if _, err := tx.ExecContext(ctx, `ALTER TABLE user_events DETACH PARTITION `+name); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DROP TABLE `+name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,304 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaPolicy controls when a read replica is used.
+type ReplicaPolicy struct {
+	// MaxLag is the replication lag above which a replica is skipped.
+	MaxLag time.Duration
+	// CheckInterval is how often replica health and lag are measured.
+	CheckInterval time.Duration
+}
+
+func DefaultReplicaPolicy() ReplicaPolicy {
+	return ReplicaPolicy{MaxLag: 10 * time.Second, CheckInterval: 5 * time.Second}
+}
+
+// ReplicaPolicyFromEnv returns the replica DSNs in DATABASE_REPLICA_URLS
+// (comma separated) and DefaultReplicaPolicy overridden by REPLICA_MAX_LAG
+// and REPLICA_CHECK_INTERVAL.
+func ReplicaPolicyFromEnv() ([]string, ReplicaPolicy, error) {
+	var dsns []string
+	for _, dsn := range strings.Split(os.Getenv("DATABASE_REPLICA_URLS"), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			dsns = append(dsns, dsn)
+		}
+	}
+
+	p := DefaultReplicaPolicy()
+	for name, dst := range map[string]*time.Duration{
+		"REPLICA_MAX_LAG":        &p.MaxLag,
+		"REPLICA_CHECK_INTERVAL": &p.CheckInterval,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, p, fmt.Errorf("%s: invalid duration %q", name, value)
+		}
+		*dst = d
+	}
+	return dsns, p, nil
+}
+
+// ReplicaStatus is the last health check of one replica, reported by
+// /metrics.
+type ReplicaStatus struct {
+	Name      string    `json:"name"`
+	Healthy   bool      `json:"healthy"`
+	LagMs     int64     `json:"lag_ms"`
+	Usable    bool      `json:"usable"`
+	LastCheck time.Time `json:"last_check"`
+	Error     string    `json:"error,omitempty"`
+	Reads     int64     `json:"reads"`
+}
+
+type replica struct {
+	name string
+	db   *sql.DB
+
+	mu        sync.Mutex
+	healthy   bool
+	lag       time.Duration
+	lastCheck time.Time
+	lastErr   error
+	reads     atomic.Int64
+}
+
+// replicaSet routes lag-tolerant reads across replicas. A replica is used
+// only while its last check succeeded and its lag is within MaxLag; a
+// failed read marks it down until the next successful check.
+type replicaSet struct {
+	policy   ReplicaPolicy
+	replicas []*replica
+	next     atomic.Uint64
+	// fallbacks counts reads sent to the primary because no replica was
+	// usable or a replica failed.
+	fallbacks atomic.Int64
+	stop      chan struct{}
+}
+
+// AddReplicas opens the replica pools and starts checking them every
+// policy.CheckInterval. A replica that is down at startup is skipped until
+// a check succeeds. Writes and reads that must see them stay on the
+// primary.
+func (db *DB) AddReplicas(dsns []string, policy ReplicaPolicy) error {
+	if len(dsns) == 0 {
+		return nil
+	}
+	set := &replicaSet{policy: policy, stop: make(chan struct{})}
+	for i, dsn := range dsns {
+		pool, err := sql.Open("postgres", dsn)
+		if err != nil {
+			set.close()
+			return fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		pool.SetMaxOpenConns(25)
+		pool.SetMaxIdleConns(25)
+		pool.SetConnMaxLifetime(5 * time.Minute)
+		set.replicas = append(set.replicas, &replica{name: replicaName(dsn, i), db: pool})
+	}
+
+	set.checkAll()
+	for _, r := range set.replicas {
+		status := r.status(policy.MaxLag)
+		if status.Healthy {
+			log.Printf("✅ Connected to read replica %s (lag %dms)", r.name, status.LagMs)
+		} else {
+			log.Printf("Warning: read replica %s unavailable: %s", r.name, status.Error)
+		}
+	}
+	db.replicas = set
+	go set.monitor()
+	return nil
+}
+
+// Replicas reports the state of each replica and how many reads fell back
+// to the primary.
+func (db *DB) Replicas() (statuses []ReplicaStatus, fallbacks int64) {
+	if db.replicas == nil {
+		return nil, 0
+	}
+	for _, r := range db.replicas.replicas {
+		statuses = append(statuses, r.status(db.replicas.policy.MaxLag))
+	}
+	return statuses, db.replicas.fallbacks.Load()
+}
+
+// Close closes the replica pools and the primary.
+func (db *DB) Close() error {
+	if db.replicas != nil {
+		db.replicas.close()
+	}
+	return db.DB.Close()
+}
+
+// queryReplica runs a read-only query that tolerates replication lag. It
+// goes to a usable replica when there is one and falls back to the
+// primary when there is none or the replica fails.
+func (db *DB) queryReplica(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if db.replicas == nil {
+		return db.QueryContext(ctx, query, args...)
+	}
+	if r := db.replicas.pick(); r != nil {
+		rows, err := r.db.QueryContext(ctx, query, args...)
+		if err == nil {
+			r.reads.Add(1)
+			return rows, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		r.markDown(err)
+		log.Printf("Warning: read replica %s failed, reading from primary: %v", r.name, err)
+	}
+	db.replicas.fallbacks.Add(1)
+	return db.QueryContext(ctx, query, args...)
+}
+
+// pick returns the next usable replica in turn, or nil.
+func (s *replicaSet) pick() *replica {
+	n := len(s.replicas)
+	start := int(s.next.Add(1) % uint64(n))
+	for i := 0; i < n; i++ {
+		r := s.replicas[(start+i)%n]
+		if r.status(s.policy.MaxLag).Usable {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *replicaSet) monitor() {
+	ticker := time.NewTicker(s.policy.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkAll()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// checkAll checks every replica concurrently, giving each one check
+// interval to answer.
+func (s *replicaSet) checkAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.policy.CheckInterval)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, r := range s.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			r.check(ctx, s.policy.MaxLag)
+		}(r)
+	}
+	wg.Wait()
+}
+
+func (s *replicaSet) close() {
+	close(s.stop)
+	for _, r := range s.replicas {
+		r.db.Close()
+	}
+}
+
+// check measures replication lag. A replica streaming from the primary
+// that has replayed everything it received reports no lag, since the last
+// replay timestamp only moves when the primary commits. Without a
+// streaming WAL receiver the received and replayed positions stay equal
+// however far behind the replica falls, so lag is then the time since the
+// last replayed commit, and a replica past maxLag is marked unhealthy.
+func (r *replica) check(ctx context.Context, maxLag time.Duration) {
+	var (
+		lagSeconds sql.NullFloat64
+		streaming  bool
+	)
+	err := r.db.QueryRowContext(ctx, `
+		WITH receiver AS (
+			SELECT EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE status = 'streaming') AS streaming
+		)
+		SELECT CASE
+			WHEN NOT pg_is_in_recovery() THEN 0
+			WHEN receiver.streaming AND pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+		END,
+		receiver.streaming OR NOT pg_is_in_recovery()
+		FROM receiver
+	`).Scan(&lagSeconds, &streaming)
+	if err == nil && !streaming {
+		if !lagSeconds.Valid {
+			err = errors.New("no WAL receiver streaming and nothing replayed")
+		} else if lag := time.Duration(lagSeconds.Float64 * float64(time.Second)); lag > maxLag {
+			err = fmt.Errorf("no WAL receiver streaming and last replayed commit %s ago", lag.Round(time.Second))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	firstCheck := r.lastCheck.IsZero()
+	wasUsable := r.healthy && r.lag <= maxLag
+	r.lastCheck = time.Now().UTC()
+	r.lastErr = err
+	r.healthy = err == nil
+	if err == nil {
+		r.lag = time.Duration(lagSeconds.Float64 * float64(time.Second))
+	}
+	usable := r.healthy && r.lag <= maxLag
+	if wasUsable && !usable {
+		log.Printf("Warning: read replica %s out of rotation (healthy=%t lag=%s)", r.name, r.healthy, r.lag)
+	} else if !wasUsable && usable && !firstCheck {
+		log.Printf("✅ Read replica %s back in rotation (lag %s)", r.name, r.lag)
+	}
+}
+
+func (r *replica) markDown(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.healthy = false
+	r.lastErr = err
+}
+
+func (r *replica) status(maxLag time.Duration) ReplicaStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := ReplicaStatus{
+		Name:      r.name,
+		Healthy:   r.healthy,
+		LagMs:     r.lag.Milliseconds(),
+		Usable:    r.healthy && r.lag <= maxLag,
+		LastCheck: r.lastCheck,
+		Reads:     r.reads.Load(),
+	}
+	if r.lastErr != nil {
+		status.Error = r.lastErr.Error()
+	}
+	return status
+}
+
+// replicaName identifies a replica in logs and metrics without its
+// credentials.
+func replicaName(dsn string, i int) string {
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "replica-" + strconv.Itoa(i+1)
+}
@@ -0,0 +1,251 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
+	"recommendation-engine/api/internal/timeout"
+)
+
+// rollupTables names the counter and seen-user tables for one kind of
+// rollup key.
+type rollupTables struct {
+	counts string
+	users  string
+	key    string
+}
+
+var (
+	itemRollupTables     = rollupTables{counts: "item_hourly_rollups", users: "item_rollup_users", key: "item_id"}
+	categoryRollupTables = rollupTables{counts: "category_hourly_rollups", users: "category_rollup_users", key: "category"}
+)
+
+const rollupColumns = `impressions, clicks, recommended, dwell_seconds, dwell_events, unique_users`
+
+func (db *DB) ApplyRollups(ctx context.Context, deltas []models.RollupDelta) (err error) {
+	if len(deltas) == 0 {
+		return nil
+	}
+	ctx, done := db.ops.Start(ctx, timeout.DBBatch)
+	defer done(&err)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	itemIDs := make([]string, 0, len(deltas))
+	for _, d := range deltas {
+		itemIDs = append(itemIDs, d.ItemID)
+	}
+	catalog, err := itemCategories(ctx, tx, itemIDs)
+	if err != nil {
+		return err
+	}
+
+	// Rows are written in key order so concurrent flushes lock them in the
+	// same order
+	items := make([]models.RollupDelta, len(deltas))
+	copy(items, deltas)
+	sortDeltas(items)
+
+	byCategory := make(map[string]*models.RollupDelta)
+	for _, d := range items {
+		if err := applyRollup(ctx, tx, itemRollupTables, d); err != nil {
+			return err
+		}
+
+		category := storage.CategoryOf(d.ItemID, catalog[d.ItemID])
+		key := category + "\x00" + d.Hour.String()
+		c, exists := byCategory[key]
+		if !exists {
+			c = &models.RollupDelta{ItemID: category, Hour: d.Hour}
+			byCategory[key] = c
+		}
+		c.Counts.Add(d.Counts)
+		c.Users = append(c.Users, d.Users...)
+	}
+
+	categories := make([]models.RollupDelta, 0, len(byCategory))
+	for _, c := range byCategory {
+		categories = append(categories, *c)
+	}
+	sortDeltas(categories)
+	for _, c := range categories {
+		if err := applyRollup(ctx, tx, categoryRollupTables, c); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// applyRollup records the delta's users and adds its counters, counting
+// only users not yet seen for the key and hour as unique.
+func applyRollup(ctx context.Context, tx *sql.Tx, tables rollupTables, d models.RollupDelta) error {
+	counts := d.Counts
+	counts.UniqueUsers = 0
+	if len(d.Users) > 0 {
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO %s (%s, hour, user_id)
+			SELECT $1, $2, unnest($3::varchar[])
+			ON CONFLICT DO NOTHING
+		`, tables.users, tables.key), d.ItemID, d.Hour, pq.Array(uniqueStrings(d.Users)))
+		if err != nil {
+			return err
+		}
+		if counts.UniqueUsers, err = result.RowsAffected(); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %[1]s (%[2]s, hour, %[3]s)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (%[2]s, hour) DO UPDATE SET
+			impressions = %[1]s.impressions + EXCLUDED.impressions,
+			clicks = %[1]s.clicks + EXCLUDED.clicks,
+			recommended = %[1]s.recommended + EXCLUDED.recommended,
+			dwell_seconds = %[1]s.dwell_seconds + EXCLUDED.dwell_seconds,
+			dwell_events = %[1]s.dwell_events + EXCLUDED.dwell_events,
+			unique_users = %[1]s.unique_users + EXCLUDED.unique_users,
+			updated_at = CURRENT_TIMESTAMP
+	`, tables.counts, tables.key, rollupColumns), d.ItemID, d.Hour, counts.Impressions, counts.Clicks,
+		counts.Recommended, counts.DwellSeconds, counts.DwellEvents, counts.UniqueUsers)
+	return err
+}
+
+func itemCategories(ctx context.Context, tx *sql.Tx, itemIDs []string) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, COALESCE(category, '') FROM content_items WHERE id = ANY($1)`,
+		pq.Array(itemIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make(map[string]string)
+	for rows.Next() {
+		var id, category string
+		if err := rows.Scan(&id, &category); err != nil {
+			return nil, err
+		}
+		categories[id] = category
+	}
+	return categories, rows.Err()
+}
+
+func (db *DB) ItemRollups(ctx context.Context, from, to time.Time) ([]models.Rollup, error) {
+	rollups, err := db.sumRollups(ctx, `
+		SELECT r.item_id, COALESCE(MAX(c.title), ''), COALESCE(MAX(c.category), ''),
+			SUM(r.impressions), SUM(r.clicks), SUM(r.recommended),
+			SUM(r.dwell_seconds), SUM(r.dwell_events), SUM(r.unique_users)
+		FROM item_hourly_rollups r
+		LEFT JOIN content_items c ON c.id = r.item_id
+		WHERE r.hour >= $1 AND r.hour < $2
+		GROUP BY r.item_id
+	`, from, to)
+	for i := range rollups {
+		rollups[i].Category = storage.CategoryOf(rollups[i].Key, rollups[i].Category)
+	}
+	return rollups, err
+}
+
+func (db *DB) CategoryRollups(ctx context.Context, from, to time.Time) ([]models.Rollup, error) {
+	return db.sumRollups(ctx, `
+		SELECT category, '', '',
+			SUM(impressions), SUM(clicks), SUM(recommended),
+			SUM(dwell_seconds), SUM(dwell_events), SUM(unique_users)
+		FROM category_hourly_rollups
+		WHERE hour >= $1 AND hour < $2
+		GROUP BY category
+	`, from, to)
+}
+
+func (db *DB) sumRollups(ctx context.Context, query string, from, to time.Time) (_ []models.Rollup, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	rows, err := db.queryReplica(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollups []models.Rollup
+	for rows.Next() {
+		var r models.Rollup
+		if err := rows.Scan(&r.Key, &r.Title, &r.Category, &r.Impressions, &r.Clicks, &r.Recommended,
+			&r.DwellSeconds, &r.DwellEvents, &r.UniqueUsers); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+func (db *DB) HourlyItemRollups(ctx context.Context, itemID string, from, to time.Time) (_ []models.Rollup, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	rows, err := db.queryReplica(ctx, `
+		SELECT item_id, hour, `+rollupColumns+`
+		FROM item_hourly_rollups
+		WHERE item_id = $1 AND hour >= $2 AND hour < $3
+		ORDER BY hour
+	`, itemID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollups []models.Rollup
+	for rows.Next() {
+		var r models.Rollup
+		if err := rows.Scan(&r.Key, &r.Hour, &r.Impressions, &r.Clicks, &r.Recommended,
+			&r.DwellSeconds, &r.DwellEvents, &r.UniqueUsers); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+func (db *DB) PruneRollupUsers(ctx context.Context, before time.Time) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBBatch)
+	defer done(&err)
+
+	for _, tables := range []rollupTables{itemRollupTables, categoryRollupTables} {
+		if _, err := db.ExecContext(ctx, `DELETE FROM `+tables.users+` WHERE hour < $1`, before); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortDeltas(deltas []models.RollupDelta) {
+	sort.Slice(deltas, func(i, j int) bool {
+		if deltas[i].ItemID != deltas[j].ItemID {
+			return deltas[i].ItemID < deltas[j].ItemID
+		}
+		return deltas[i].Hour.Before(deltas[j].Hour)
+	})
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/timeout"
+)
+
+func (db *DB) GetUser(ctx context.Context, id string) (_ *models.User, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	var user models.User
+	err = db.QueryRowContext(ctx, `SELECT id, created_at, last_active FROM users WHERE id = $1`, id).
+		Scan(&user.ID, &user.CreatedAt, &user.LastActive)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (db *DB) UpsertUser(ctx context.Context, user models.User) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	query := `
+		INSERT INTO users (id, last_active)
+		VALUES ($1, COALESCE($2, CURRENT_TIMESTAMP))
+		ON CONFLICT (id) DO UPDATE SET last_active = EXCLUDED.last_active
+	`
+	_, err = db.ExecContext(ctx, query, user.ID, nullTime(user.LastActive))
+	return err
+}
+
+// TouchUsers writes a batch of last_active times in one statement. IDs are
+// sorted so concurrent batches lock rows in the same order.
+func (db *DB) TouchUsers(ctx context.Context, lastActive map[string]time.Time) (err error) {
+	if len(lastActive) == 0 {
+		return nil
+	}
+	ctx, done := db.ops.Start(ctx, timeout.DBBatch)
+	defer done(&err)
+
+	ids := make([]string, 0, len(lastActive))
+	for id := range lastActive {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	times := make([]string, len(ids))
+	for i, id := range ids {
+		times[i] = lastActive[id].UTC().Format(time.RFC3339Nano)
+	}
+
+	query := `
+		INSERT INTO users (id, last_active)
+		SELECT * FROM unnest($1::varchar[], $2::timestamp[])
+		ON CONFLICT (id) DO UPDATE SET last_active = GREATEST(users.last_active, EXCLUDED.last_active)
+	`
+	_, err = db.ExecContext(ctx, query, pq.Array(ids), pq.Array(times))
+	return err
+}
+
+// RecentlyActiveUsers reads from a replica when one is usable; a user who
+// became active within the replication lag can be missed.
+func (db *DB) RecentlyActiveUsers(ctx context.Context, since time.Time, limit int) (_ []string, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	query := `
+		SELECT id FROM users
+		WHERE last_active >= $1
+		ORDER BY last_active DESC
+		LIMIT $2
+	`
+	rows, err := db.queryReplica(ctx, query, since.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (db *DB) GetAssignment(ctx context.Context, userID string) (_ *models.Assignment, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	query := `
+		SELECT user_id, experiment_name, variant, assigned_at
+		FROM ab_test_assignments
+		WHERE user_id = $1
+	`
+	var a models.Assignment
+	err = db.QueryRowContext(ctx, query, userID).Scan(&a.UserID, &a.Experiment, &a.Variant, &a.AssignedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// SaveAssignment stores a user's variant, replacing any earlier assignment
+// the same way ab-testing/experiment_config.py does.
+func (db *DB) SaveAssignment(ctx context.Context, a models.Assignment) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	query := `
+		INSERT INTO ab_test_assignments (user_id, experiment_name, variant)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET
+			experiment_name = EXCLUDED.experiment_name,
+			variant = EXCLUDED.variant,
+			assigned_at = CURRENT_TIMESTAMP
+	`
+	_, err = db.ExecContext(ctx, query, a.UserID, a.Experiment, a.Variant)
+	return err
+}
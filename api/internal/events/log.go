@@ -0,0 +1,264 @@
+package events
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+)
+
+// Log appends accepted events to a newline-delimited JSON file so derived
+// state can be rebuilt later with cmd/replay.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	enc  *json.Encoder
+	// rewriting serializes rewrites, which run mostly outside mu
+	rewriting sync.Mutex
+}
+
+func OpenLog(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path, f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (l *Log) Append(e models.UserEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(e)
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Rewrite passes every logged event through fn, which may edit it in place
+// and reports whether it did, and replaces the log with the result. It
+// returns the number of events changed. The log as it stood when Rewrite
+// was called is copied without blocking appends; only the events appended
+// since are copied with appends held, just before the new log is renamed
+// over the old one. A crash leaves one or the other intact.
+func (l *Log) Rewrite(fn func(*models.UserEvent) bool) (int, error) {
+	l.rewriting.Lock()
+	defer l.rewriting.Unlock()
+
+	l.mu.Lock()
+	info, err := l.f.Stat()
+	l.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	src, err := os.Open(l.path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Appends write whole lines under mu, so the size read above ends on a
+	// line boundary
+	changed, err := rewriteLines(l.path, io.LimitReader(src, info.Size()), tmp, fn)
+	if err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tail, err := rewriteLines(l.path, src, tmp, fn)
+	if err != nil {
+		return 0, err
+	}
+	changed += tail
+	if changed == 0 {
+		return 0, nil
+	}
+	if err := tmp.Sync(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return 0, err
+	}
+
+	// Appends must go to the new file
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return changed, err
+	}
+	l.f.Close()
+	l.f, l.enc = f, json.NewEncoder(f)
+	return changed, nil
+}
+
+// RewriteArchives passes every event in the gzipped NDJSON archives in dir
+// (*.ndjson.gz, as written when event partitions are dropped) through fn,
+// like Log.Rewrite, and rewrites the archives it changed. It returns the
+// number of events changed. A missing dir holds no archives.
+func RewriteArchives(dir string, fn func(*models.UserEvent) bool) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.ndjson.gz"))
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, path := range paths {
+		n, err := rewriteArchive(path, fn)
+		changed += n
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// rewriteArchive rewrites one archive under a temporary name and renames
+// it over the original if fn changed anything.
+func rewriteArchive(path string, fn func(*models.UserEvent) bool) (int, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	gr, err := gzip.NewReader(src)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	defer gr.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gw := gzip.NewWriter(tmp)
+	changed, err := rewriteLines(path, gr, gw, fn)
+	if err != nil || changed == 0 {
+		return 0, err
+	}
+	if err := gw.Close(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return changed, os.Rename(tmp.Name(), path)
+}
+
+// rewriteLines copies the events read from r (the log at path) to w,
+// re-encoding the events fn changes and copying every other line as is.
+func rewriteLines(path string, r io.Reader, w io.Writer, fn func(*models.UserEvent) bool) (int, error) {
+	bw := bufio.NewWriter(w)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	changed, line := 0, 0
+	for scanner.Scan() {
+		line++
+		raw := scanner.Bytes()
+		if len(raw) == 0 {
+			continue
+		}
+		var e models.UserEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return 0, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if fn(&e) {
+			changed++
+			var err error
+			if raw, err = json.Marshal(e); err != nil {
+				return 0, err
+			}
+		}
+		bw.Write(raw)
+		bw.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return changed, bw.Flush()
+}
+
+// InRange reports whether ts falls in [from, to). A zero bound is open.
+func InRange(ts, from, to time.Time) bool {
+	if !from.IsZero() && ts.Before(from) {
+		return false
+	}
+	if !to.IsZero() && !ts.Before(to) {
+		return false
+	}
+	return true
+}
+
+// ReadLog calls fn for every event in the NDJSON log at path whose
+// timestamp falls in [from, to). Paths ending in .gz, such as archived
+// event partitions, are decompressed. Reading stops at the first error
+// from fn.
+func ReadLog(path string, from, to time.Time, fn func(models.UserEvent) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var e models.UserEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if !InRange(e.Timestamp, from, to) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
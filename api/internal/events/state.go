@@ -0,0 +1,268 @@
+package events
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+)
+
+// trendHalfLife controls how quickly an item's trend score decays.
+const trendHalfLife = time.Hour
+
+// ItemStats holds running engagement counters for a single item.
+type ItemStats struct {
+	ItemID        string    `json:"item_id"`
+	Views         int       `json:"views"`
+	Clicks        int       `json:"clicks"`
+	TotalDuration int       `json:"total_duration"`
+	TrendScore    float64   `json:"trend_score"`
+	LastEvent     time.Time `json:"last_event"`
+}
+
+// State is everything derived from the event stream: global counters,
+// user/item interactions for similarity, item trend scores and per-minute
+// event-time buckets. Live ingestion and cmd/replay both feed it through
+// Apply, so a replayed state is identical to one built from live traffic.
+// Sessions are kept separately by cache.Sessions.
+type State struct {
+	sync.Mutex
+	Policy Policy `json:"-"`
+
+	Interactions map[string][]string   `json:"interactions"`
+	Items        map[string]*ItemStats `json:"items"`
+	Buckets      map[int64]*Bucket     `json:"buckets"`
+	Impressions  int                   `json:"impressions"`
+	Clicks       int                   `json:"clicks"`
+	Processed    int64                 `json:"processed"`
+	LateEvents   int64                 `json:"late_events"`
+	DroppedLate  int64                 `json:"dropped_late"`
+	LastEvent    time.Time             `json:"last_event"` // largest event time seen
+}
+
+func NewState() *State {
+	return &State{
+		Policy:       DefaultPolicy(),
+		Interactions: make(map[string][]string),
+		Items:        make(map[string]*ItemStats),
+		Buckets:      make(map[int64]*Bucket),
+	}
+}
+
+// Apply folds a single event into the derived state by event time and
+// reports how late it was. TooLate events leave the state unchanged.
+func (s *State) Apply(e models.UserEvent) Lateness {
+	s.Lock()
+	defer s.Unlock()
+
+	ts := e.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	lateness := s.classify(ts)
+	switch lateness {
+	case TooLate:
+		s.DroppedLate++
+		return lateness
+	case Late:
+		s.LateEvents++
+	}
+
+	s.applyItem(e, ts)
+
+	bucket := s.bucket(ts)
+	switch e.EventType {
+	case "view":
+		s.Impressions++
+		bucket.Impressions++
+	case "click":
+		s.Clicks++
+		bucket.Clicks++
+	}
+	if e.Duration != nil {
+		bucket.Duration += *e.Duration
+	}
+	if lateness == Late {
+		bucket.Late++
+	}
+
+	if !containsString(s.Interactions[e.UserID], e.ItemID) {
+		s.Interactions[e.UserID] = append(s.Interactions[e.UserID], e.ItemID)
+	}
+
+	s.Processed++
+	if ts.After(s.LastEvent) {
+		s.LastEvent = ts
+	}
+	if s.Processed%1000 == 0 {
+		s.pruneBuckets()
+	}
+	return lateness
+}
+
+func (s *State) applyItem(e models.UserEvent, ts time.Time) {
+	item, exists := s.Items[e.ItemID]
+	if !exists {
+		item = &ItemStats{ItemID: e.ItemID, LastEvent: ts}
+		s.Items[e.ItemID] = item
+	}
+
+	weight := Weight(e.EventType)
+	switch e.EventType {
+	case "view":
+		item.Views++
+	case "click":
+		item.Clicks++
+	}
+	if e.Duration != nil {
+		item.TotalDuration += *e.Duration
+	}
+
+	// Scores are kept as of LastEvent; out-of-order events contribute
+	// their weight decayed to that point instead of moving it back.
+	if ts.After(item.LastEvent) {
+		item.TrendScore = decay(item.TrendScore, item.LastEvent, ts) + weight
+		item.LastEvent = ts
+	} else {
+		item.TrendScore += decay(weight, ts, item.LastEvent)
+	}
+}
+
+// ForgetUser removes the user's interactions. Item counters and buckets
+// are aggregates and are kept. It reports whether anything was held for
+// the user.
+func (s *State) ForgetUser(userID string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	_, hadInteractions := s.Interactions[userID]
+	delete(s.Interactions, userID)
+	return hadInteractions
+}
+
+// Trending returns up to n items ordered by trend score as of now.
+func (s *State) Trending(n int, now time.Time) []ItemStats {
+	s.Lock()
+	defer s.Unlock()
+
+	items := make([]ItemStats, 0, len(s.Items))
+	for _, item := range s.Items {
+		current := *item
+		current.TrendScore = decay(item.TrendScore, item.LastEvent, now)
+		items = append(items, current)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].TrendScore > items[j].TrendScore
+	})
+	if len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
+
+// TrendScores returns every item's trend score decayed to now.
+func (s *State) TrendScores(now time.Time) map[string]float64 {
+	s.Lock()
+	defer s.Unlock()
+
+	scores := make(map[string]float64, len(s.Items))
+	for id, item := range s.Items {
+		scores[id] = decay(item.TrendScore, item.LastEvent, now)
+	}
+	return scores
+}
+
+// Save writes a JSON snapshot of the state, replacing path atomically.
+func (s *State) Save(path string) error {
+	s.Lock()
+	data, err := json.Marshal(s)
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadState reads a snapshot written by Save. A missing file yields an
+// empty state.
+func LoadState(path string) (*State, error) {
+	s := NewState()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Buckets == nil {
+		s.Buckets = make(map[int64]*Bucket)
+	}
+	return s, nil
+}
+
+// Weight is how much an event type says about interest in an item. It
+// feeds trend scores, item popularity and user category affinities.
+func Weight(eventType string) float64 {
+	switch eventType {
+	case "view":
+		return 1
+	case "click":
+		return 3
+	case "like", "share":
+		return 5
+	}
+	return 0
+}
+
+// Category extracts the category prefix from item IDs of the form
+// "category_content" or "item_category_n", as the recommender serves them.
+func Category(itemID string) string {
+	parts := strings.Split(itemID, "_")
+	if len(parts) > 2 && parts[0] == "item" {
+		return parts[1]
+	}
+	if len(parts) > 1 {
+		return parts[0]
+	}
+	return ""
+}
+
+func decay(score float64, from, to time.Time) float64 {
+	if !to.After(from) {
+		return score
+	}
+	return score * math.Pow(0.5, to.Sub(from).Seconds()/trendHalfLife.Seconds())
+}
+
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
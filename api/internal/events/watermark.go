@@ -0,0 +1,153 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Lateness classifies an event against the current watermark.
+type Lateness string
+
+const (
+	// OnTime events are at or after the watermark.
+	OnTime Lateness = "on_time"
+	// Late events are behind the watermark but within the allowed
+	// lateness; they are still folded into the buckets they belong to.
+	Late Lateness = "late"
+	// TooLate events are beyond the allowed lateness and are not applied
+	// to derived state. They are still logged.
+	TooLate Lateness = "too_late"
+)
+
+var ErrClockSkew = errors.New("event timestamp is too far in the future")
+
+// Policy controls event-time processing. The watermark trails the largest
+// event time seen by MaxOutOfOrder; events older than the watermark by
+// more than AllowedLateness are dropped from aggregates.
+type Policy struct {
+	MaxOutOfOrder   time.Duration
+	AllowedLateness time.Duration
+	MaxClockSkew    time.Duration
+	BucketSize      time.Duration
+	BucketRetention time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxOutOfOrder:   30 * time.Second,
+		AllowedLateness: 24 * time.Hour,
+		MaxClockSkew:    5 * time.Minute,
+		BucketSize:      time.Minute,
+		BucketRetention: 48 * time.Hour,
+	}
+}
+
+// PolicyFromEnv returns DefaultPolicy overridden by EVENT_MAX_OUT_OF_ORDER,
+// EVENT_ALLOWED_LATENESS and EVENT_MAX_CLOCK_SKEW (Go duration strings).
+func PolicyFromEnv() (Policy, error) {
+	p := DefaultPolicy()
+	for key, field := range map[string]*time.Duration{
+		"EVENT_MAX_OUT_OF_ORDER": &p.MaxOutOfOrder,
+		"EVENT_ALLOWED_LATENESS": &p.AllowedLateness,
+		"EVENT_MAX_CLOCK_SKEW":   &p.MaxClockSkew,
+	} {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return p, fmt.Errorf("%s: %w", key, err)
+		}
+		*field = d
+	}
+	return p, nil
+}
+
+// ValidateTimestamp checks a client-supplied event time against the
+// server clock. A zero timestamp means the client did not send one and
+// the receive time is used.
+func (p Policy) ValidateTimestamp(ts, received time.Time) (time.Time, error) {
+	if ts.IsZero() {
+		return received, nil
+	}
+	if ts.Sub(received) > p.MaxClockSkew {
+		return time.Time{}, ErrClockSkew
+	}
+	return ts.UTC(), nil
+}
+
+// Bucket holds event-time aggregates for one BucketSize interval.
+type Bucket struct {
+	Start       time.Time `json:"start"`
+	Impressions int       `json:"impressions"`
+	Clicks      int       `json:"clicks"`
+	Duration    int       `json:"duration"`
+	Late        int       `json:"late"`
+}
+
+// Watermark returns the point in event time before which the state
+// considers input complete.
+func (s *State) Watermark() time.Time {
+	s.Lock()
+	defer s.Unlock()
+	return s.watermark()
+}
+
+func (s *State) watermark() time.Time {
+	if s.LastEvent.IsZero() {
+		return time.Time{}
+	}
+	return s.LastEvent.Add(-s.Policy.MaxOutOfOrder)
+}
+
+func (s *State) classify(ts time.Time) Lateness {
+	watermark := s.watermark()
+	switch {
+	case watermark.IsZero() || !ts.Before(watermark):
+		return OnTime
+	case watermark.Sub(ts) <= s.Policy.AllowedLateness:
+		return Late
+	default:
+		return TooLate
+	}
+}
+
+func (s *State) bucket(ts time.Time) *Bucket {
+	start := ts.Truncate(s.Policy.BucketSize)
+	key := start.Unix()
+	b, exists := s.Buckets[key]
+	if !exists {
+		b = &Bucket{Start: start}
+		s.Buckets[key] = b
+	}
+	return b
+}
+
+func (s *State) pruneBuckets() {
+	horizon := s.watermark().Add(-s.Policy.BucketRetention)
+	for key, b := range s.Buckets {
+		if b.Start.Before(horizon) {
+			delete(s.Buckets, key)
+		}
+	}
+}
+
+// Trend returns the event-time buckets covering [from, to) in order.
+// Buckets with no events are included with zero counts.
+func (s *State) Trend(from, to time.Time) []Bucket {
+	s.Lock()
+	defer s.Unlock()
+
+	var trend []Bucket
+	for start := from.Truncate(s.Policy.BucketSize); start.Before(to); start = start.Add(s.Policy.BucketSize) {
+		if b, exists := s.Buckets[start.Unix()]; exists {
+			trend = append(trend, *b)
+		} else {
+			trend = append(trend, Bucket{Start: start})
+		}
+	}
+	return trend
+}
@@ -0,0 +1,72 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestWatermarkClassification(t *testing.T) {
+	policy := DefaultPolicy()
+	tests := []struct {
+		name     string
+		behind   time.Duration // how far the event is behind the newest one
+		lateness Lateness
+	}{
+		{"newest event", 0, OnTime},
+		{"within max out of order", policy.MaxOutOfOrder, OnTime},
+		{"behind the watermark", policy.MaxOutOfOrder + time.Second, Late},
+		{"at the allowed lateness", policy.MaxOutOfOrder + policy.AllowedLateness, Late},
+		{"past the allowed lateness", policy.MaxOutOfOrder + policy.AllowedLateness + time.Second, TooLate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewState()
+			s.Policy = policy
+			s.Apply(models.UserEvent{UserID: "u1", ItemID: "tech_1", EventType: "view", Timestamp: testStart})
+
+			got := s.Apply(models.UserEvent{UserID: "u2", ItemID: "tech_1", EventType: "click", Timestamp: testStart.Add(-tt.behind)})
+			if got != tt.lateness {
+				t.Errorf("lateness = %s, want %s", got, tt.lateness)
+			}
+
+			wantClicks, wantDropped := 1, int64(0)
+			if tt.lateness == TooLate {
+				wantClicks, wantDropped = 0, 1
+			}
+			if s.Clicks != wantClicks || s.DroppedLate != wantDropped {
+				t.Errorf("clicks = %d, dropped = %d, want %d and %d", s.Clicks, s.DroppedLate, wantClicks, wantDropped)
+			}
+		})
+	}
+}
+
+func TestValidateTimestamp(t *testing.T) {
+	policy := DefaultPolicy()
+	received := testStart
+	tests := []struct {
+		name  string
+		ts    time.Time
+		want  time.Time
+		isErr bool
+	}{
+		{"no timestamp uses the receive time", time.Time{}, received, false},
+		{"past timestamp is kept", received.Add(-time.Hour), received.Add(-time.Hour), false},
+		{"at the allowed skew", received.Add(policy.MaxClockSkew), received.Add(policy.MaxClockSkew), false},
+		{"past the allowed skew", received.Add(policy.MaxClockSkew + time.Second), time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.ValidateTimestamp(tt.ts, received)
+			if (err != nil) != tt.isErr {
+				t.Fatalf("err = %v, want error %v", err, tt.isErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("timestamp = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
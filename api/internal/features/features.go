@@ -0,0 +1,266 @@
+// Package features keeps per-user features for recommendation strategies,
+// updated incrementally from each tracked event.
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"recommendation-engine/api/internal/cache"
+	"recommendation-engine/api/internal/events"
+	"recommendation-engine/api/internal/models"
+)
+
+const keyPrefix = "features:"
+
+// Config controls how features are kept.
+type Config struct {
+	// LastN is how many recent items are kept per user.
+	LastN int
+	// AffinityHalfLife is how quickly category affinities decay.
+	AffinityHalfLife time.Duration
+	// TTL drops the features of users inactive for this long.
+	TTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{LastN: 20, AffinityHalfLife: 7 * 24 * time.Hour, TTL: 30 * 24 * time.Hour}
+}
+
+// ConfigFromEnv returns DefaultConfig overridden by FEATURE_LAST_N,
+// FEATURE_HALF_LIFE and FEATURE_TTL.
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+	if value := os.Getenv("FEATURE_LAST_N"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return config, fmt.Errorf("FEATURE_LAST_N: invalid count %q", value)
+		}
+		config.LastN = n
+	}
+	for _, setting := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"FEATURE_HALF_LIFE", &config.AffinityHalfLife},
+		{"FEATURE_TTL", &config.TTL},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return config, fmt.Errorf("%s: invalid duration %q", setting.name, value)
+		}
+		*setting.dst = d
+	}
+	return config, nil
+}
+
+// UserFeatures is what is stored per user. Affinities are kept as of
+// AffinityAsOf and decayed when read.
+type UserFeatures struct {
+	UserID           string             `json:"user_id"`
+	CategoryAffinity map[string]float64 `json:"category_affinity"`
+	AffinityAsOf     time.Time          `json:"affinity_as_of"`
+	LastItems        []string           `json:"last_items"` // newest first
+	Events           int64              `json:"events"`
+	Views            int64              `json:"views"`
+	Engagements      int64              `json:"engagements"` // clicks, likes and shares
+	FirstEventAt     time.Time          `json:"first_event_at"`
+	LastEventAt      time.Time          `json:"last_event_at"`
+	UpdatedAt        time.Time          `json:"updated_at"`
+}
+
+// Freshness says how current a snapshot is and where it came from.
+type Freshness struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	AgeMs     int64     `json:"age_ms"`
+	Source    string    `json:"source"`
+}
+
+// Snapshot is a user's features as read at one moment, with the derived
+// values strategies use.
+type Snapshot struct {
+	UserID string `json:"user_id"`
+	// CategoryAffinity is decayed to the time of the read.
+	CategoryAffinity map[string]float64 `json:"category_affinity"`
+	TopCategories    []string           `json:"top_categories"`
+	LastItems        []string           `json:"last_items"`
+	Events           int64              `json:"events"`
+	Views            int64              `json:"views"`
+	EngagementRate   float64            `json:"engagement_rate"`
+	LastEventAt      time.Time          `json:"last_event_at"`
+	// SinceLastEventMs is the user's recency.
+	SinceLastEventMs int64     `json:"since_last_event_ms"`
+	Freshness        Freshness `json:"freshness"`
+}
+
+// Affinity returns the user's share of affinity for the category, 0 to 1.
+func (s *Snapshot) Affinity(category string) float64 {
+	total := 0.0
+	for _, a := range s.CategoryAffinity {
+		total += a
+	}
+	if total == 0 {
+		return 0
+	}
+	return s.CategoryAffinity[category] / total
+}
+
+// Store keeps features in Redis or in process, through a cache.Updater so
+// concurrent events for one user do not lose updates.
+type Store struct {
+	backend cache.Updater
+	source  string
+	config  Config
+	clock   cache.Clock
+}
+
+// NewStore keeps features in backend; source names it in Freshness.
+func NewStore(backend cache.Updater, source string, config Config) *Store {
+	return &Store{backend: backend, source: source, config: config, clock: cache.SystemClock}
+}
+
+// Update applies one event for an item in category to the user's
+// features.
+func (s *Store) Update(ctx context.Context, e models.UserEvent, category string) error {
+	now := s.clock.Now()
+	return s.backend.Update(ctx, keyPrefix+e.UserID, s.config.TTL, func(current []byte) ([]byte, error) {
+		f := &UserFeatures{UserID: e.UserID}
+		if current != nil {
+			if err := json.Unmarshal(current, f); err != nil {
+				// Start over rather than fail every event for the user
+				f = &UserFeatures{UserID: e.UserID}
+			}
+		}
+		s.apply(f, e, category)
+		f.UpdatedAt = now.UTC()
+		return json.Marshal(f)
+	})
+}
+
+// Get returns the user's features, or nil if none are held.
+func (s *Store) Get(ctx context.Context, userID string) (*Snapshot, error) {
+	val, err := s.backend.Get(ctx, keyPrefix+userID)
+	if val == nil || err != nil {
+		return nil, err
+	}
+	var f UserFeatures
+	if err := json.Unmarshal(val, &f); err != nil {
+		return nil, err
+	}
+	return s.snapshot(&f, s.clock.Now()), nil
+}
+
+// Delete removes the user's features and returns how many keys existed.
+func (s *Store) Delete(ctx context.Context, userID string) (int64, error) {
+	return s.backend.Delete(ctx, keyPrefix+userID)
+}
+
+func (s *Store) apply(f *UserFeatures, e models.UserEvent, category string) {
+	ts := e.Timestamp
+	if f.CategoryAffinity == nil {
+		f.CategoryAffinity = make(map[string]float64)
+	}
+
+	// Affinities are kept as of the latest event; earlier events add
+	// their weight decayed to that point.
+	if category != "" {
+		weight := events.Weight(e.EventType)
+		if ts.After(f.AffinityAsOf) {
+			s.decay(f.CategoryAffinity, f.AffinityAsOf, ts)
+			f.AffinityAsOf = ts
+		} else {
+			weight = s.decayed(weight, ts, f.AffinityAsOf)
+		}
+		if weight > 0 {
+			f.CategoryAffinity[category] += weight
+		}
+	}
+
+	if !ts.Before(f.LastEventAt) {
+		f.LastItems = pushFront(f.LastItems, e.ItemID, s.config.LastN)
+		f.LastEventAt = ts
+	}
+	if f.FirstEventAt.IsZero() || ts.Before(f.FirstEventAt) {
+		f.FirstEventAt = ts
+	}
+
+	f.Events++
+	switch e.EventType {
+	case "view":
+		f.Views++
+	case "click", "like", "share":
+		f.Engagements++
+	}
+}
+
+func (s *Store) snapshot(f *UserFeatures, now time.Time) *Snapshot {
+	affinity := make(map[string]float64, len(f.CategoryAffinity))
+	for category, a := range f.CategoryAffinity {
+		affinity[category] = s.decayed(a, f.AffinityAsOf, now)
+	}
+	top := make([]string, 0, len(affinity))
+	for category := range affinity {
+		top = append(top, category)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if affinity[top[i]] != affinity[top[j]] {
+			return affinity[top[i]] > affinity[top[j]]
+		}
+		return top[i] < top[j]
+	})
+
+	snap := &Snapshot{
+		UserID:           f.UserID,
+		CategoryAffinity: affinity,
+		TopCategories:    top,
+		LastItems:        f.LastItems,
+		Events:           f.Events,
+		Views:            f.Views,
+		LastEventAt:      f.LastEventAt,
+		SinceLastEventMs: now.Sub(f.LastEventAt).Milliseconds(),
+		Freshness: Freshness{
+			UpdatedAt: f.UpdatedAt,
+			AgeMs:     now.Sub(f.UpdatedAt).Milliseconds(),
+			Source:    s.source,
+		},
+	}
+	if f.Views > 0 {
+		snap.EngagementRate = float64(f.Engagements) / float64(f.Views)
+	}
+	return snap
+}
+
+func (s *Store) decay(affinity map[string]float64, from, to time.Time) {
+	for category, a := range affinity {
+		affinity[category] = s.decayed(a, from, to)
+	}
+}
+
+func (s *Store) decayed(value float64, from, to time.Time) float64 {
+	if from.IsZero() || !to.After(from) {
+		return value
+	}
+	return value * math.Pow(0.5, to.Sub(from).Seconds()/s.config.AffinityHalfLife.Seconds())
+}
+
+// pushFront moves item to the front of items, keeping at most n.
+func pushFront(items []string, item string, n int) []string {
+	out := make([]string, 0, n)
+	out = append(out, item)
+	for _, existing := range items {
+		if existing != item && len(out) < n {
+			out = append(out, existing)
+		}
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package features
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"recommendation-engine/api/internal/cache"
+	"recommendation-engine/api/internal/models"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestStore(config Config) (*Store, *cache.FakeClock) {
+	clock := cache.NewFakeClock(testStart)
+	s := NewStore(cache.NewLRU(100, clock), "memory", config)
+	s.clock = clock
+	return s, clock
+}
+
+func update(t *testing.T, s *Store, itemID, category, eventType string, at time.Time) {
+	t.Helper()
+	e := models.UserEvent{UserID: "u1", ItemID: itemID, EventType: eventType, Timestamp: at}
+	if err := s.Update(context.Background(), e, category); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(t *testing.T, s *Store) *Snapshot {
+	t.Helper()
+	snap, err := s.Get(context.Background(), "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snap
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestAffinityDecay(t *testing.T) {
+	halfLife := DefaultConfig().AffinityHalfLife
+	tests := []struct {
+		name  string
+		event time.Time
+		read  time.Duration
+		want  float64
+	}{
+		{"read at the event", testStart, 0, 3},
+		{"one half-life later", testStart, halfLife, 1.5},
+		{"two half-lives later", testStart, 2 * halfLife, 0.75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, clock := newTestStore(DefaultConfig())
+			update(t, s, "item_tech_1", "tech", "click", tt.event)
+			clock.Advance(tt.read)
+			if got := get(t, s).CategoryAffinity["tech"]; !near(got, tt.want) {
+				t.Errorf("affinity = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// An event older than the latest adds its weight decayed to that point.
+func TestLateEventAffinity(t *testing.T) {
+	halfLife := DefaultConfig().AffinityHalfLife
+	s, clock := newTestStore(DefaultConfig())
+	clock.Advance(halfLife)
+	update(t, s, "item_tech_1", "tech", "view", testStart.Add(halfLife))
+	update(t, s, "item_news_1", "news", "click", testStart)
+
+	snap := get(t, s)
+	if !near(snap.CategoryAffinity["tech"], 1) || !near(snap.CategoryAffinity["news"], 1.5) {
+		t.Errorf("affinity = %v, want tech 1 and news 1.5", snap.CategoryAffinity)
+	}
+	if !reflect.DeepEqual(snap.TopCategories, []string{"news", "tech"}) {
+		t.Errorf("top categories = %v, want [news tech]", snap.TopCategories)
+	}
+	// The late event is not the user's latest item
+	if !reflect.DeepEqual(snap.LastItems, []string{"item_tech_1"}) {
+		t.Errorf("last items = %v, want [item_tech_1]", snap.LastItems)
+	}
+}
+
+func TestCountsAndLastItems(t *testing.T) {
+	config := DefaultConfig()
+	config.LastN = 3
+	s, _ := newTestStore(config)
+	for i, e := range []struct{ item, eventType string }{
+		{"item_tech_1", "view"},
+		{"item_tech_2", "view"},
+		{"item_tech_1", "click"},
+		{"item_tech_3", "view"},
+		{"item_tech_4", "view"},
+		{"item_tech_4", "share"},
+	} {
+		update(t, s, e.item, "tech", e.eventType, testStart.Add(time.Duration(i)*time.Minute))
+	}
+
+	snap := get(t, s)
+	if want := []string{"item_tech_4", "item_tech_3", "item_tech_1"}; !reflect.DeepEqual(snap.LastItems, want) {
+		t.Errorf("last items = %v, want %v", snap.LastItems, want)
+	}
+	if snap.Events != 6 || snap.Views != 4 || snap.EngagementRate != 0.5 {
+		t.Errorf("events %d, views %d, engagement %v, want 6, 4 and 0.5", snap.Events, snap.Views, snap.EngagementRate)
+	}
+	if !snap.LastEventAt.Equal(testStart.Add(5 * time.Minute)) {
+		t.Errorf("last event at %v", snap.LastEventAt)
+	}
+}
+
+func TestInactiveUsersExpireAndDelete(t *testing.T) {
+	config := DefaultConfig()
+	s, clock := newTestStore(config)
+	update(t, s, "item_tech_1", "tech", "view", testStart)
+
+	clock.Advance(config.TTL - time.Second)
+	if get(t, s) == nil {
+		t.Fatal("features expired before the TTL")
+	}
+	clock.Advance(time.Second)
+	if snap := get(t, s); snap != nil {
+		t.Errorf("features after the TTL = %+v, want none", snap)
+	}
+
+	update(t, s, "item_tech_1", "tech", "view", clock.Now())
+	if n, err := s.Delete(context.Background(), "u1"); err != nil || n != 1 {
+		t.Errorf("Delete = %d, %v, want 1", n, err)
+	}
+	if snap := get(t, s); snap != nil {
+		t.Errorf("features after Delete = %+v, want none", snap)
+	}
+}
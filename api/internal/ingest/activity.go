@@ -0,0 +1,89 @@
+package ingest
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"recommendation-engine/api/internal/storage"
+)
+
+// ActivityTracker batches users.last_active updates. Ingestion records the
+// latest event time per user and Flush writes them in one call, so a busy
+// user costs one write per flush rather than one per event.
+type ActivityTracker struct {
+	store   storage.UserStore
+	mu      sync.Mutex
+	pending map[string]time.Time
+	flushed int64
+}
+
+func NewActivityTracker(store storage.UserStore) *ActivityTracker {
+	return &ActivityTracker{
+		store:   store,
+		pending: make(map[string]time.Time),
+	}
+}
+
+// Touch records that userID was active at t.
+func (a *ActivityTracker) Touch(userID string, t time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if t.After(a.pending[userID]) {
+		a.pending[userID] = t
+	}
+}
+
+// Flush writes pending activity. On failure the batch is merged back so it
+// is retried on the next flush.
+func (a *ActivityTracker) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	batch := a.pending
+	a.pending = make(map[string]time.Time)
+	a.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := a.store.TouchUsers(ctx, batch); err != nil {
+		a.mu.Lock()
+		for userID, t := range batch {
+			if t.After(a.pending[userID]) {
+				a.pending[userID] = t
+			}
+		}
+		a.mu.Unlock()
+		return err
+	}
+
+	a.mu.Lock()
+	a.flushed += int64(len(batch))
+	a.mu.Unlock()
+	return nil
+}
+
+// Forget drops pending activity for userID so a flush does not recreate
+// an erased user.
+func (a *ActivityTracker) Forget(userID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.pending, userID)
+}
+
+// FlushPeriodically flushes every interval until the process exits.
+func (a *ActivityTracker) FlushPeriodically(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := a.Flush(context.Background()); err != nil {
+			log.Printf("Warning: failed to update user activity: %v", err)
+		}
+	}
+}
+
+// Stats reports users waiting to be written and users written so far.
+func (a *ActivityTracker) Stats() (pending int, flushed int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending), a.flushed
+}
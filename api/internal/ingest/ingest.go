@@ -0,0 +1,76 @@
+// Package ingest applies accepted events to everything derived from them.
+// The API runs each event it stores through a Pipeline, and cmd/replay
+// runs stored events through one to rebuild the same state.
+package ingest
+
+import (
+	"context"
+	"log"
+
+	"recommendation-engine/api/internal/cache"
+	"recommendation-engine/api/internal/events"
+	"recommendation-engine/api/internal/features"
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/rollup"
+	"recommendation-engine/api/internal/storage"
+)
+
+// Pipeline holds the stores an event updates after it has been logged.
+// Nil stores are skipped.
+type Pipeline struct {
+	// State holds counters, interactions and trending.
+	State *events.State
+	// Rollups buffers the hourly per-item counters.
+	Rollups *rollup.Aggregator
+	// Features holds per-user features.
+	Features *features.Store
+	// Popularity holds windowed item counters.
+	Popularity cache.Popularity
+	// Sessions holds each user's current and ended sessions.
+	Sessions cache.Sessions
+	// Activity batches users.last_active updates.
+	Activity *ActivityTracker
+	// Categories gives the category features, popularity and sessions
+	// record items under.
+	Categories *storage.Categories
+}
+
+// Apply folds e into every store and returns how late it was. Events too
+// late for the event-time aggregates are left out of State and Rollups but
+// still update the rest. Failures to update the cache-backed stores are
+// logged rather than returned, so they never fail ingestion.
+func (p *Pipeline) Apply(ctx context.Context, e models.UserEvent) events.Lateness {
+	category := p.Categories.Of(ctx, e.ItemID)
+	if p.Features != nil {
+		if err := p.Features.Update(ctx, e, category); err != nil {
+			log.Printf("Warning: failed to update user features: %v", err)
+		}
+	}
+
+	if p.Popularity != nil {
+		if weight := events.Weight(e.EventType); weight > 0 {
+			if err := p.Popularity.Record(ctx, e.ItemID, category, weight, e.Timestamp); err != nil {
+				log.Printf("Warning: failed to update item popularity: %v", err)
+			}
+		}
+	}
+
+	if p.Activity != nil {
+		p.Activity.Touch(e.UserID, e.Timestamp)
+	}
+
+	lateness := events.OnTime
+	if p.State != nil {
+		lateness = p.State.Apply(e)
+	}
+	if p.Rollups != nil && lateness != events.TooLate {
+		p.Rollups.Add(e)
+	}
+
+	if p.Sessions != nil {
+		if err := p.Sessions.Track(ctx, e.UserID, e.EventType, category, e.Timestamp); err != nil {
+			log.Printf("Warning: failed to update session for %s: %v", e.UserID, err)
+		}
+	}
+	return lateness
+}
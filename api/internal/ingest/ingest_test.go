@@ -0,0 +1,70 @@
+package ingest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"recommendation-engine/api/internal/cache"
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
+	"recommendation-engine/api/internal/storage/memory"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestPopularityCategories(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	if err := store.UpsertItems(ctx, []models.ContentItem{{ID: "article_42", Title: "Chips", Category: "tech"}}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		itemID   string
+		category string
+	}{
+		{"served item ID", "item_tech_2", "tech"},
+		{"category prefix", "science_space", "science"},
+		{"catalog category", "article_42", "tech"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := cache.NewFakeClock(testStart)
+			p := &Pipeline{
+				Popularity: cache.NewLocalPopularity(time.Hour, clock),
+				Categories: storage.NewCategories(store),
+			}
+			p.Apply(ctx, models.UserEvent{UserID: "u1", ItemID: tt.itemID, EventType: "click", Timestamp: clock.Now()})
+
+			top, err := p.Popularity.Top(ctx, tt.category, time.Hour, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(top) != 1 || top[0].ItemID != tt.itemID {
+				t.Errorf("top %s items = %v, want %s", tt.category, top, tt.itemID)
+			}
+		})
+	}
+}
+
+func TestSessionCategories(t *testing.T) {
+	ctx := context.Background()
+	clock := cache.NewFakeClock(testStart)
+	p := &Pipeline{
+		Sessions:   cache.NewLocalSessions(cache.DefaultSessionConfig(), clock),
+		Categories: storage.NewCategories(memory.New()),
+	}
+	for _, itemID := range []string{"item_tech_1", "item_news_1", "item_tech_2"} {
+		p.Apply(ctx, models.UserEvent{UserID: "u1", ItemID: itemID, EventType: "view", Timestamp: clock.Now()})
+	}
+
+	session, _, err := p.Sessions.User(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session == nil || !reflect.DeepEqual(session.Categories, []string{"tech", "news"}) {
+		t.Errorf("session = %+v, want categories [tech news]", session)
+	}
+}
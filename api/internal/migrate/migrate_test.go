@@ -0,0 +1,145 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func writeMigrations(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		versions []int
+		valid    bool
+	}{
+		{
+			name: "ordered by version",
+			files: map[string]string{
+				"002_b.sql": "B", "002_b.down.sql": "undo B",
+				"001_a.sql": "A",
+				"010_c.sql": "C",
+			},
+			versions: []int{1, 2, 10},
+			valid:    true,
+		},
+		{"missing version", map[string]string{"a.sql": "A"}, nil, false},
+		{"bad version", map[string]string{"x1_a.sql": "A"}, nil, false},
+		{"version used twice", map[string]string{"001_a.sql": "A", "001_b.sql": "B"}, nil, false},
+		{"down without up", map[string]string{"001_a.down.sql": "undo A"}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Load(writeMigrations(t, tt.files))
+			if (err == nil) != tt.valid {
+				t.Fatalf("err = %v, want valid %v", err, tt.valid)
+			}
+			if len(migrations) != len(tt.versions) {
+				t.Fatalf("loaded %d migrations, want %d", len(migrations), len(tt.versions))
+			}
+			for i, m := range migrations {
+				if m.Version != tt.versions[i] {
+					t.Errorf("migration %d is version %d, want %d", i, m.Version, tt.versions[i])
+				}
+			}
+		})
+	}
+}
+
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUpDownBaseline(t *testing.T) {
+	ctx := context.Background()
+	migrations, err := Load(writeMigrations(t, map[string]string{
+		"001_items.sql":      "CREATE TABLE items (id TEXT PRIMARY KEY);",
+		"001_items.down.sql": "DROP TABLE items;",
+		"002_users.sql":      "CREATE TABLE users (id TEXT PRIMARY KEY);",
+		"002_users.down.sql": "DROP TABLE users;",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := openSQLite(t)
+	m := NewSQLite(db, migrations)
+	if applied, err := m.Up(ctx); err != nil || len(applied) != 2 {
+		t.Fatalf("Up applied %d, err %v, want 2", len(applied), err)
+	}
+	if applied, err := m.Up(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("second Up applied %d, err %v, want 0", len(applied), err)
+	}
+	if v, err := Version(ctx, db); err != nil || v != 2 {
+		t.Fatalf("version = %d, err %v, want 2", v, err)
+	}
+
+	reverted, err := m.Down(ctx, 1)
+	if err != nil || len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Fatalf("Down reverted %+v, err %v, want version 2", reverted, err)
+	}
+	if _, err := db.ExecContext(ctx, `SELECT 1 FROM users`); err == nil {
+		t.Error("users table still exists after Down")
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Errorf("status = %+v, want only version 1 applied", statuses)
+	}
+
+	// A baselined migration is recorded without running
+	if err := m.Baseline(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, `SELECT 1 FROM users`); err == nil {
+		t.Error("Baseline ran the users migration")
+	}
+	if v, err := Version(ctx, db); err != nil || v != 2 {
+		t.Errorf("version after Baseline = %d, err %v, want 2", v, err)
+	}
+}
+
+func TestFailedMigrationIsNotRecorded(t *testing.T) {
+	ctx := context.Background()
+	migrations, err := Load(writeMigrations(t, map[string]string{
+		"001_items.sql":  "CREATE TABLE items (id TEXT PRIMARY KEY);",
+		"002_broken.sql": "CREATE TABLE broken (id TEXT PRIMARY KEY); SELECT * FROM missing;",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := openSQLite(t)
+	if _, err := NewSQLite(db, migrations).Up(ctx); err == nil {
+		t.Fatal("Up succeeded with a broken migration")
+	}
+	if v, err := Version(ctx, db); err != nil || v != 1 {
+		t.Errorf("version = %d, err %v, want 1", v, err)
+	}
+	if _, err := db.ExecContext(ctx, `SELECT 1 FROM broken`); err == nil {
+		t.Error("broken migration was not rolled back")
+	}
+}
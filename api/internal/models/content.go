@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type ContentItem struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	Category    string     `json:"category"`
+	Tags        []string   `json:"tags,omitempty"`
+	Embedding   []float64  `json:"embedding,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// UserEvent is a single interaction as accepted by /event and stored in
+// user_events. The same shape is written to the NDJSON event log.
+//
+// Timestamp is the event time reported by the client (or the receive time
+// if it sent none); ReceivedAt is when the server accepted it.
+type UserEvent struct {
+	UserID     string    `json:"user_id"`
+	ItemID     string    `json:"item_id"`
+	EventType  string    `json:"event_type"`
+	Duration   *int      `json:"duration_seconds,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+	ReceivedAt time.Time `json:"received_at,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Flags      []string  `json:"flags,omitempty"` // event-quality rules that fired
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// ServedItem is one entry of a served recommendation list. Positions are
+// 1-based.
+type ServedItem struct {
+	ItemID   string  `json:"item_id"`
+	Position int     `json:"position"`
+	Score    float64 `json:"score"`
+}
+
+// Impression is a recommendation list as returned by /recommend, logged to
+// recommendations_served under its request ID.
+type Impression struct {
+	RequestID  string       `json:"request_id"`
+	UserID     string       `json:"user_id"`
+	Items      []ServedItem `json:"items"`
+	Strategy   string       `json:"strategy"`
+	Experiment string       `json:"experiment,omitempty"`
+	Variant    string       `json:"variant,omitempty"`
+	ServedAt   time.Time    `json:"served_at"`
+}
+
+// Position returns the 1-based position of itemID in the served list, or 0
+// if it was not served.
+func (imp Impression) Position(itemID string) int {
+	for _, item := range imp.Items {
+		if item.ItemID == itemID {
+			return item.Position
+		}
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// QuarantinedEvent is an event held back by the event-quality filter, with
+// the reasons it was held.
+type QuarantinedEvent struct {
+	Event         UserEvent `json:"event"`
+	UserAgent     string    `json:"user_agent,omitempty"`
+	Reasons       []string  `json:"reasons"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// UserExport is everything storage holds about one user, returned for data
+// access requests.
+type UserExport struct {
+	User              *User              `json:"user"`
+	Events            []UserEvent        `json:"events"`
+	QuarantinedEvents []QuarantinedEvent `json:"quarantined_events"`
+	Assignment        *Assignment        `json:"assignment"`
+	Recommendations   []Impression       `json:"recommendations_served"`
+}
+
+// Empty reports whether the export holds no data.
+func (e *UserExport) Empty() bool {
+	return e.User == nil && len(e.Events) == 0 && len(e.QuarantinedEvents) == 0 &&
+		e.Assignment == nil && len(e.Recommendations) == 0
+}
+
+// ErasureRecord is the audit entry left by a user erasure. The user is
+// identified only by a hash of their ID, so the record can confirm that a
+// known ID was erased without retaining it.
+type ErasureRecord struct {
+	ID          int64             `json:"id,omitempty"`
+	SubjectHash string            `json:"subject_hash"`
+	RequestedBy string            `json:"requested_by,omitempty"`
+	Status      string            `json:"status"` // "completed" or "partial"
+	Removed     map[string]int64  `json:"removed"`
+	Errors      map[string]string `json:"errors,omitempty"`
+	RequestedAt time.Time         `json:"requested_at"`
+	CompletedAt time.Time         `json:"completed_at"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// RollupCounts are the engagement counters kept per item and per category
+// for each hour of event time. Impressions are view events; Recommended
+// counts appearances in served recommendation lists.
+type RollupCounts struct {
+	Impressions  int64 `json:"impressions"`
+	Clicks       int64 `json:"clicks"`
+	Recommended  int64 `json:"recommended"`
+	DwellSeconds int64 `json:"dwell_seconds"`
+	DwellEvents  int64 `json:"dwell_events"`
+	UniqueUsers  int64 `json:"unique_users"`
+}
+
+func (c *RollupCounts) Add(other RollupCounts) {
+	c.Impressions += other.Impressions
+	c.Clicks += other.Clicks
+	c.Recommended += other.Recommended
+	c.DwellSeconds += other.DwellSeconds
+	c.DwellEvents += other.DwellEvents
+	c.UniqueUsers += other.UniqueUsers
+}
+
+func (c RollupCounts) CTR() float64 {
+	if c.Impressions == 0 {
+		return 0
+	}
+	return float64(c.Clicks) / float64(c.Impressions)
+}
+
+func (c RollupCounts) AvgDwell() float64 {
+	if c.DwellEvents == 0 {
+		return 0
+	}
+	return float64(c.DwellSeconds) / float64(c.DwellEvents)
+}
+
+// Rollup is the counts for one item or category, either for a single hour
+// or summed over a range of hours. Summed UniqueUsers is the sum of the
+// hourly counts, so a user active in several hours is counted in each.
+// Item rollups carry the item's catalog title and category when it has
+// them.
+type Rollup struct {
+	Key      string    `json:"key"`
+	Hour     time.Time `json:"hour,omitempty"`
+	Title    string    `json:"title,omitempty"`
+	Category string    `json:"category,omitempty"`
+	RollupCounts
+}
+
+// RollupDelta is an increment to one item's counters for one hour. Users
+// lists the users seen in the increment; only those not already counted
+// for the hour add to UniqueUsers.
+type RollupDelta struct {
+	ItemID string
+	Hour   time.Time
+	Counts RollupCounts
+	Users  []string
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type User struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastActive time.Time `json:"last_active"`
+}
+
+// Assignment records which experiment variant a user was bucketed into.
+// ab_test_assignments holds one assignment per user.
+type Assignment struct {
+	UserID     string    `json:"user_id"`
+	Experiment string    `json:"experiment"`
+	Variant    string    `json:"variant"`
+	AssignedAt time.Time `json:"assigned_at"`
+}
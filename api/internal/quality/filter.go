@@ -0,0 +1,247 @@
+package quality
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+)
+
+// Action is what the filter does with an event that trips a rule.
+type Action string
+
+const (
+	Accept Action = "accept"
+	// Flag accepts the event but records the rule that fired on it.
+	Flag Action = "flag"
+	// Quarantine keeps the event out of derived state and storage; it is
+	// held separately for review.
+	Quarantine Action = "quarantine"
+)
+
+// Rule names, as reported in Verdict.Reasons.
+const (
+	RuleRate              = "rate_limit"
+	RuleImpossibleDwell   = "impossible_dwell"
+	RuleClickNoImpression = "click_without_impression"
+	RuleBotUserAgent      = "bot_user_agent"
+)
+
+// Config sets thresholds and the action taken for each rule.
+type Config struct {
+	MaxEventsPerMinute int
+	MaxDwell           time.Duration
+	ImpressionWindow   time.Duration
+	// MaxViewsPerUser caps the views kept per user to match clicks to.
+	MaxViewsPerUser int
+	BotUserAgents   []string
+	Actions         map[string]Action
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxEventsPerMinute: 120,
+		MaxDwell:           4 * time.Hour,
+		ImpressionWindow:   30 * time.Minute,
+		MaxViewsPerUser:    1000,
+		BotUserAgents: []string{
+			"bot", "crawler", "spider", "slurp", "scrapy",
+			"headlesschrome", "phantomjs", "facebookexternalhit",
+		},
+		Actions: map[string]Action{
+			RuleRate:              Quarantine,
+			RuleImpossibleDwell:   Quarantine,
+			RuleClickNoImpression: Flag,
+			RuleBotUserAgent:      Quarantine,
+		},
+	}
+}
+
+// Verdict is the outcome of checking one event.
+type Verdict struct {
+	Action  Action   `json:"action"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+type userActivity struct {
+	perSecond [60]rateBucket       // receive counts over the last minute
+	seen      map[string]time.Time // item ID -> last view
+	last      time.Time
+}
+
+// rateBucket counts the events received in one second.
+type rateBucket struct {
+	second int64
+	count  int
+}
+
+// countEvent counts an event received at now and returns how many were
+// received in the minute up to it. Memory and work are fixed however fast
+// the user sends.
+func (a *userActivity) countEvent(now time.Time) int {
+	second := now.Unix()
+	b := &a.perSecond[second%int64(len(a.perSecond))]
+	if b.second != second {
+		b.second, b.count = second, 0
+	}
+	b.count++
+
+	total := 0
+	for _, b := range a.perSecond {
+		if second-b.second < int64(len(a.perSecond)) {
+			total += b.count
+		}
+	}
+	return total
+}
+
+// recordView remembers a view of itemID at ts. At the cap, views older
+// than window are expired first, then the oldest view if none were.
+func (a *userActivity) recordView(itemID string, ts time.Time, window time.Duration, max int) {
+	if _, exists := a.seen[itemID]; !exists && len(a.seen) >= max {
+		var oldestID string
+		var oldest time.Time
+		for id, viewed := range a.seen {
+			if ts.Sub(viewed) > window {
+				delete(a.seen, id)
+			} else if oldestID == "" || viewed.Before(oldest) {
+				oldestID, oldest = id, viewed
+			}
+		}
+		if len(a.seen) >= max {
+			delete(a.seen, oldestID)
+		}
+	}
+	a.seen[itemID] = ts
+}
+
+// Filter applies event-quality rules to incoming events. It keeps a small
+// amount of per-user history to judge rates and click/impression order.
+type Filter struct {
+	mu     sync.Mutex
+	config Config
+	users  map[string]*userActivity
+	counts map[string]int64
+	checks int64
+}
+
+func NewFilter(config Config) *Filter {
+	patterns := make([]string, len(config.BotUserAgents))
+	for i, ua := range config.BotUserAgents {
+		patterns[i] = strings.ToLower(ua)
+	}
+	config.BotUserAgents = patterns
+
+	return &Filter{
+		config: config,
+		users:  make(map[string]*userActivity),
+		counts: make(map[string]int64),
+	}
+}
+
+// Check judges an event. served reports whether the item was part of a
+// recommendation list shown to the user, which counts as an impression.
+func (f *Filter) Check(e models.UserEvent, userAgent string, served bool) Verdict {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := e.ReceivedAt
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	activity := f.activity(e.UserID)
+	activity.last = now
+
+	var reasons []string
+
+	// Per-user rate over the last minute, in one-second buckets
+	if activity.countEvent(now) > f.config.MaxEventsPerMinute {
+		reasons = append(reasons, RuleRate)
+	}
+
+	if e.Duration != nil && (*e.Duration < 0 || time.Duration(*e.Duration)*time.Second > f.config.MaxDwell) {
+		reasons = append(reasons, RuleImpossibleDwell)
+	}
+
+	switch e.EventType {
+	case "view":
+		activity.recordView(e.ItemID, e.Timestamp, f.config.ImpressionWindow, f.config.MaxViewsPerUser)
+	case "click":
+		viewed, ok := activity.seen[e.ItemID]
+		if !served && (!ok || e.Timestamp.Sub(viewed) > f.config.ImpressionWindow) {
+			reasons = append(reasons, RuleClickNoImpression)
+		}
+	}
+
+	if isBot(strings.ToLower(userAgent), f.config.BotUserAgents) {
+		reasons = append(reasons, RuleBotUserAgent)
+	}
+
+	verdict := Verdict{Action: Accept, Reasons: reasons}
+	for _, reason := range reasons {
+		f.counts[reason]++
+		switch f.config.Actions[reason] {
+		case Quarantine:
+			verdict.Action = Quarantine
+		case Flag:
+			if verdict.Action == Accept {
+				verdict.Action = Flag
+			}
+		}
+	}
+
+	f.checks++
+	if f.checks%1000 == 0 {
+		f.prune(now)
+	}
+	return verdict
+}
+
+// Counts returns how often each rule has fired.
+func (f *Filter) Counts() map[string]int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	counts := make(map[string]int64, len(f.counts))
+	for rule, n := range f.counts {
+		counts[rule] = n
+	}
+	return counts
+}
+
+// Forget drops the history kept for userID.
+func (f *Filter) Forget(userID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.users, userID)
+}
+
+func (f *Filter) activity(userID string) *userActivity {
+	activity, exists := f.users[userID]
+	if !exists {
+		activity = &userActivity{seen: make(map[string]time.Time)}
+		f.users[userID] = activity
+	}
+	return activity
+}
+
+// prune forgets users that have been idle for longer than the impression
+// window.
+func (f *Filter) prune(now time.Time) {
+	for userID, activity := range f.users {
+		if now.Sub(activity.last) > f.config.ImpressionWindow {
+			delete(f.users, userID)
+		}
+	}
+}
+
+func isBot(userAgent string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.Contains(userAgent, pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package quality
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func event(eventType, itemID string, at time.Time) models.UserEvent {
+	return models.UserEvent{UserID: "u1", ItemID: itemID, EventType: eventType, Timestamp: at, ReceivedAt: at}
+}
+
+func TestFilterRules(t *testing.T) {
+	dwell := func(seconds int) *int { return &seconds }
+	tests := []struct {
+		name      string
+		before    []models.UserEvent
+		event     models.UserEvent
+		userAgent string
+		served    bool
+		want      Verdict
+	}{
+		{
+			name:  "plain view",
+			event: event("view", "item_tech_1", testStart),
+			want:  Verdict{Action: Accept},
+		},
+		{
+			name:   "click after a view",
+			before: []models.UserEvent{event("view", "item_tech_1", testStart)},
+			event:  event("click", "item_tech_1", testStart.Add(time.Minute)),
+			want:   Verdict{Action: Accept},
+		},
+		{
+			name:   "click on a served item",
+			event:  event("click", "item_tech_1", testStart),
+			served: true,
+			want:   Verdict{Action: Accept},
+		},
+		{
+			name:  "click without an impression",
+			event: event("click", "item_tech_1", testStart),
+			want:  Verdict{Action: Flag, Reasons: []string{RuleClickNoImpression}},
+		},
+		{
+			name:   "click after the impression window",
+			before: []models.UserEvent{event("view", "item_tech_1", testStart)},
+			event:  event("click", "item_tech_1", testStart.Add(31*time.Minute)),
+			want:   Verdict{Action: Flag, Reasons: []string{RuleClickNoImpression}},
+		},
+		{
+			name: "impossible dwell",
+			event: func() models.UserEvent {
+				e := event("view", "item_tech_1", testStart)
+				e.Duration = dwell(5 * 3600)
+				return e
+			}(),
+			want: Verdict{Action: Quarantine, Reasons: []string{RuleImpossibleDwell}},
+		},
+		{
+			name:      "bot user agent",
+			event:     event("view", "item_tech_1", testStart),
+			userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1)",
+			want:      Verdict{Action: Quarantine, Reasons: []string{RuleBotUserAgent}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFilter(DefaultConfig())
+			for _, e := range tt.before {
+				f.Check(e, "", false)
+			}
+			got := f.Check(tt.event, tt.userAgent, tt.served)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("verdict = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterRateLimit(t *testing.T) {
+	limit := DefaultConfig().MaxEventsPerMinute
+	tests := []struct {
+		name    string
+		events  int
+		spacing time.Duration
+		limited bool
+	}{
+		{"at the limit", limit, 100 * time.Millisecond, false},
+		{"over the limit", limit + 1, 100 * time.Millisecond, true},
+		{"spread over more than a minute", 2 * limit, time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFilter(DefaultConfig())
+			var last Verdict
+			for i := 0; i < tt.events; i++ {
+				last = f.Check(event("view", "item_tech_1", testStart.Add(time.Duration(i)*tt.spacing)), "", false)
+			}
+			limited := len(last.Reasons) == 1 && last.Reasons[0] == RuleRate
+			if limited != tt.limited {
+				t.Errorf("last verdict = %+v, want rate limited %v", last, tt.limited)
+			}
+		})
+	}
+}
+
+func TestFilterCapsViewsPerUser(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxViewsPerUser = 10
+	f := NewFilter(config)
+	for i := 0; i < 100; i++ {
+		f.Check(event("view", "item_"+strconv.Itoa(i), testStart.Add(time.Duration(i)*time.Second)), "", false)
+	}
+
+	if n := len(f.users["u1"].seen); n != config.MaxViewsPerUser {
+		t.Errorf("views kept = %d, want %d", n, config.MaxViewsPerUser)
+	}
+	// The newest views are kept to match clicks to
+	if v := f.Check(event("click", "item_99", testStart.Add(2*time.Minute)), "", false); v.Action != Accept {
+		t.Errorf("click on a recent view = %+v, want accepted", v)
+	}
+}
+
+func TestQuarantineStore(t *testing.T) {
+	q := NewQuarantineStore(3)
+	for i, user := range []string{"u1", "u2", "u1", "u3"} {
+		q.Add(QuarantinedEvent{Event: models.UserEvent{UserID: user, ItemID: "item_" + strconv.Itoa(i)}})
+	}
+
+	recent := q.Recent(10)
+	var items []string
+	for _, e := range recent {
+		items = append(items, e.Event.ItemID)
+	}
+	if want := []string{"item_3", "item_2", "item_1"}; !reflect.DeepEqual(items, want) {
+		t.Errorf("recent = %v, want %v", items, want)
+	}
+	if n := q.RemoveUser("u1"); n != 1 {
+		t.Errorf("removed %d events for u1, want 1", n)
+	}
+	if n := len(q.Recent(10)); n != 2 || q.Total() != 4 {
+		t.Errorf("held %d events, total %d, want 2 and 4", n, q.Total())
+	}
+}
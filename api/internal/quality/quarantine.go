@@ -0,0 +1,74 @@
+package quality
+
+import (
+	"sync"
+
+	"recommendation-engine/api/internal/models"
+)
+
+// QuarantinedEvent is an event held back by the filter, with the reasons
+// it was held.
+type QuarantinedEvent = models.QuarantinedEvent
+
+// QuarantineStore keeps the most recent quarantined events in memory for
+// review. Durable storage is the quarantined_events table.
+type QuarantineStore struct {
+	mu     sync.Mutex
+	events []QuarantinedEvent
+	max    int
+	total  int64
+}
+
+func NewQuarantineStore(max int) *QuarantineStore {
+	return &QuarantineStore{max: max}
+}
+
+func (q *QuarantineStore) Add(event QuarantinedEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.events = append(q.events, event)
+	if len(q.events) > q.max {
+		q.events = q.events[len(q.events)-q.max:]
+	}
+	q.total++
+}
+
+// Recent returns up to limit quarantined events, newest first.
+func (q *QuarantineStore) Recent(limit int) []QuarantinedEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if limit > len(q.events) {
+		limit = len(q.events)
+	}
+	recent := make([]QuarantinedEvent, 0, limit)
+	for i := len(q.events) - 1; i >= 0 && len(recent) < limit; i-- {
+		recent = append(recent, q.events[i])
+	}
+	return recent
+}
+
+// RemoveUser drops the user's quarantined events and returns how many
+// were dropped.
+func (q *QuarantineStore) RemoveUser(userID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	kept := q.events[:0]
+	for _, event := range q.events {
+		if event.Event.UserID != userID {
+			kept = append(kept, event)
+		}
+	}
+	n := len(q.events) - len(kept)
+	q.events = kept
+	return n
+}
+
+// Total is the number of events quarantined since startup.
+func (q *QuarantineStore) Total() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.total
+}
@@ -0,0 +1,166 @@
+package rollup
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
+)
+
+type key struct {
+	itemID string
+	hour   time.Time
+}
+
+type pending struct {
+	counts models.RollupCounts
+	users  map[string]bool
+}
+
+// Aggregator buffers hourly per-item counters in memory and adds them to
+// the rollup tables on Flush, so the tables are updated incrementally
+// without a write per event.
+type Aggregator struct {
+	store storage.RollupStore
+	// userRetention is how long the seen-user sets behind unique_users are
+	// kept; it should cover the allowed event lateness.
+	userRetention time.Duration
+	lastPrune     time.Time
+
+	mu      sync.Mutex
+	pending map[key]*pending
+	flushed int64
+}
+
+func NewAggregator(store storage.RollupStore, userRetention time.Duration) *Aggregator {
+	return &Aggregator{
+		store:         store,
+		userRetention: userRetention,
+		pending:       make(map[key]*pending),
+	}
+}
+
+// Add counts an accepted event in the hour of its event time.
+func (a *Aggregator) Add(e models.UserEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p := a.get(e.ItemID, e.Timestamp)
+	switch e.EventType {
+	case "view":
+		p.counts.Impressions++
+	case "click":
+		p.counts.Clicks++
+	}
+	if e.Duration != nil {
+		p.counts.DwellSeconds += int64(*e.Duration)
+		p.counts.DwellEvents++
+	}
+	p.users[e.UserID] = true
+}
+
+// AddServed counts each item of a served recommendation list.
+func (a *Aggregator) AddServed(imp models.Impression) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, item := range imp.Items {
+		a.get(item.ItemID, imp.ServedAt).counts.Recommended++
+	}
+}
+
+func (a *Aggregator) get(itemID string, ts time.Time) *pending {
+	k := key{itemID: itemID, hour: ts.UTC().Truncate(time.Hour)}
+	p, exists := a.pending[k]
+	if !exists {
+		p = &pending{users: make(map[string]bool)}
+		a.pending[k] = p
+	}
+	return p
+}
+
+// Flush writes buffered counters. On failure they are merged back so the
+// next flush retries them.
+func (a *Aggregator) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	batch := a.pending
+	a.pending = make(map[key]*pending)
+	a.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	deltas := make([]models.RollupDelta, 0, len(batch))
+	for k, p := range batch {
+		d := models.RollupDelta{ItemID: k.itemID, Hour: k.hour, Counts: p.counts}
+		for user := range p.users {
+			d.Users = append(d.Users, user)
+		}
+		deltas = append(deltas, d)
+	}
+
+	if err := a.store.ApplyRollups(ctx, deltas); err != nil {
+		a.mu.Lock()
+		for k, p := range batch {
+			current, exists := a.pending[k]
+			if !exists {
+				a.pending[k] = p
+				continue
+			}
+			current.counts.Add(p.counts)
+			for user := range p.users {
+				current.users[user] = true
+			}
+		}
+		a.mu.Unlock()
+		return err
+	}
+
+	a.mu.Lock()
+	a.flushed += int64(len(deltas))
+	a.mu.Unlock()
+	return nil
+}
+
+// ForgetUser removes userID from the buffered seen-user sets. Counters
+// are kept; the user is no longer counted towards unique_users.
+func (a *Aggregator) ForgetUser(userID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, p := range a.pending {
+		delete(p.users, userID)
+	}
+}
+
+// FlushPeriodically flushes every interval and prunes seen-user sets once
+// an hour, until the process exits.
+func (a *Aggregator) FlushPeriodically(interval time.Duration) {
+	for range time.Tick(interval) {
+		ctx := context.Background()
+		if err := a.Flush(ctx); err != nil {
+			log.Printf("Warning: failed to flush rollups: %v", err)
+		}
+
+		now := time.Now().UTC()
+		if now.Sub(a.lastPrune) < time.Hour {
+			continue
+		}
+		if err := a.store.PruneRollupUsers(ctx, now.Add(-a.userRetention)); err != nil {
+			log.Printf("Warning: failed to prune rollup users: %v", err)
+			continue
+		}
+		a.lastPrune = now
+	}
+}
+
+// Stats reports buffered item-hours and item-hours written so far.
+func (a *Aggregator) Stats() (pending int, flushed int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending), a.flushed
+}
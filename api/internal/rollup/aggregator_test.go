@@ -0,0 +1,123 @@
+package rollup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
+	"recommendation-engine/api/internal/storage/memory"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// flakyStore fails ApplyRollups while fail is set.
+type flakyStore struct {
+	storage.RollupStore
+	fail bool
+}
+
+func (s *flakyStore) ApplyRollups(ctx context.Context, deltas []models.RollupDelta) error {
+	if s.fail {
+		return errors.New("database unavailable")
+	}
+	return s.RollupStore.ApplyRollups(ctx, deltas)
+}
+
+func event(userID, eventType string, at time.Time) models.UserEvent {
+	return models.UserEvent{UserID: userID, ItemID: "item_tech_1", EventType: eventType, Timestamp: at}
+}
+
+func hourly(t *testing.T, store storage.RollupStore) map[time.Time]models.RollupCounts {
+	t.Helper()
+	rollups, err := store.HourlyItemRollups(context.Background(), "item_tech_1", testStart.Add(-24*time.Hour), testStart.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[time.Time]models.RollupCounts)
+	for _, r := range rollups {
+		counts[r.Hour] = r.RollupCounts
+	}
+	return counts
+}
+
+func TestAggregatorCountsByEventHour(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	a := NewAggregator(store, time.Hour)
+	dwell := 30
+
+	a.Add(event("u1", "view", testStart.Add(10*time.Minute)))
+	click := event("u1", "click", testStart.Add(20*time.Minute))
+	click.Duration = &dwell
+	a.Add(click)
+	a.Add(event("u2", "view", testStart.Add(30*time.Minute)))
+	// A late event counts in the hour it happened
+	a.Add(event("u3", "view", testStart.Add(-30*time.Minute)))
+	a.AddServed(models.Impression{Items: []models.ServedItem{{ItemID: "item_tech_1", Position: 1}}, ServedAt: testStart})
+	if err := a.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Users already counted in the hour do not add to unique_users again
+	a.Add(event("u1", "view", testStart.Add(40*time.Minute)))
+	if err := a.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[time.Time]models.RollupCounts{
+		testStart:                 {Impressions: 3, Clicks: 1, Recommended: 1, DwellSeconds: 30, DwellEvents: 1, UniqueUsers: 2},
+		testStart.Add(-time.Hour): {Impressions: 1, UniqueUsers: 1},
+	}
+	got := hourly(t, store)
+	if len(got) != len(want) {
+		t.Fatalf("hours = %v, want %v", got, want)
+	}
+	for hour, counts := range want {
+		if got[hour] != counts {
+			t.Errorf("%s = %+v, want %+v", hour.Format(time.Kitchen), got[hour], counts)
+		}
+	}
+	if pending, flushed := a.Stats(); pending != 0 || flushed != 3 {
+		t.Errorf("stats = %d pending, %d flushed, want 0 and 3", pending, flushed)
+	}
+}
+
+func TestAggregatorRetriesFailedFlush(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyStore{RollupStore: memory.New(), fail: true}
+	a := NewAggregator(store, time.Hour)
+
+	a.Add(event("u1", "view", testStart))
+	if err := a.Flush(ctx); err == nil {
+		t.Fatal("flush succeeded against a failing store")
+	}
+	a.Add(event("u2", "view", testStart))
+	store.fail = false
+	if err := a.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := hourly(t, store)[testStart], (models.RollupCounts{Impressions: 2, UniqueUsers: 2}); got != want {
+		t.Errorf("counts = %+v, want %+v", got, want)
+	}
+}
+
+func TestAggregatorForgetUser(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	a := NewAggregator(store, time.Hour)
+
+	a.Add(event("u1", "view", testStart))
+	a.Add(event("u2", "view", testStart))
+	a.ForgetUser("u1")
+	if err := a.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The view still counts, the forgotten user does not
+	if got, want := hourly(t, store)[testStart], (models.RollupCounts{Impressions: 2, UniqueUsers: 1}); got != want {
+		t.Errorf("counts = %+v, want %+v", got, want)
+	}
+}
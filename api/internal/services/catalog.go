@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
+)
+
+var ErrInvalidItem = errors.New("invalid item")
+
+const (
+	maxItemIDLength   = 255
+	maxCategoryLength = 100
+	maxTags           = 50
+)
+
+// Catalog manages content items and tells interested caches and indexes
+// which items changed.
+type Catalog struct {
+	items storage.ItemStore
+	hooks []func(ctx context.Context, itemIDs []string)
+}
+
+func NewCatalog(items storage.ItemStore) *Catalog {
+	return &Catalog{items: items}
+}
+
+// OnChange registers fn to be called with the IDs of items that were
+// created, updated or deleted. Hooks run synchronously after the write.
+func (c *Catalog) OnChange(fn func(ctx context.Context, itemIDs []string)) {
+	c.hooks = append(c.hooks, fn)
+}
+
+func (c *Catalog) Get(ctx context.Context, id string) (*models.ContentItem, error) {
+	return c.items.GetItem(ctx, id)
+}
+
+func (c *Catalog) List(ctx context.Context, category string, limit int) ([]models.ContentItem, error) {
+	return c.items.ListItems(ctx, category, limit)
+}
+
+func (c *Catalog) Create(ctx context.Context, item models.ContentItem) error {
+	if err := ValidateItem(item); err != nil {
+		return err
+	}
+	if err := c.items.CreateItem(ctx, item); err != nil {
+		return err
+	}
+	c.changed(ctx, item.ID)
+	return nil
+}
+
+func (c *Catalog) Update(ctx context.Context, item models.ContentItem) error {
+	if err := ValidateItem(item); err != nil {
+		return err
+	}
+	if err := c.items.UpdateItem(ctx, item); err != nil {
+		return err
+	}
+	c.changed(ctx, item.ID)
+	return nil
+}
+
+func (c *Catalog) Upsert(ctx context.Context, items []models.ContentItem) error {
+	ids := make([]string, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		if err := ValidateItem(item); err != nil {
+			return fmt.Errorf("item %d: %w", i, err)
+		}
+		if seen[item.ID] {
+			return fmt.Errorf("item %d: %w: duplicate id %q", i, ErrInvalidItem, item.ID)
+		}
+		seen[item.ID] = true
+		ids = append(ids, item.ID)
+	}
+
+	if err := c.items.UpsertItems(ctx, items); err != nil {
+		return err
+	}
+	c.changed(ctx, ids...)
+	return nil
+}
+
+func (c *Catalog) Delete(ctx context.Context, id string) error {
+	if err := c.items.DeleteItem(ctx, id); err != nil {
+		return err
+	}
+	c.changed(ctx, id)
+	return nil
+}
+
+func (c *Catalog) changed(ctx context.Context, itemIDs ...string) {
+	for _, hook := range c.hooks {
+		hook(ctx, itemIDs)
+	}
+}
+
+// ValidateItem checks an item against the content_items schema.
+func ValidateItem(item models.ContentItem) error {
+	switch {
+	case item.ID == "":
+		return fmt.Errorf("%w: id is required", ErrInvalidItem)
+	case len(item.ID) > maxItemIDLength:
+		return fmt.Errorf("%w: id is longer than %d characters", ErrInvalidItem, maxItemIDLength)
+	case item.Title == "":
+		return fmt.Errorf("%w: title is required", ErrInvalidItem)
+	case len(item.Category) > maxCategoryLength:
+		return fmt.Errorf("%w: category is longer than %d characters", ErrInvalidItem, maxCategoryLength)
+	case len(item.Tags) > maxTags:
+		return fmt.Errorf("%w: more than %d tags", ErrInvalidItem, maxTags)
+	}
+	for _, v := range item.Embedding {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("%w: embedding contains non-finite values", ErrInvalidItem)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"recommendation-engine/api/internal/abtest"
+	"recommendation-engine/api/internal/models"
+)
+
+// Assignments read from the store are kept in process so serving a cached
+// list does not wait on the database. A user's assignment never changes
+// once made; the TTL only bounds how long another replica serves one after
+// the user is erased.
+const (
+	assignmentCacheSize = 100000
+	assignmentCacheTTL  = 10 * time.Minute
+	assignmentPrefix    = "assignment:"
+)
+
+// SetExperiment sets the experiment users are assigned to, or nil for
+// none.
+func (r *Recommender) SetExperiment(e *abtest.Experiment) {
+	r.experiment = e
+}
+
+// Experiment returns the running experiment, or nil.
+func (r *Recommender) Experiment() *abtest.Experiment {
+	return r.experiment
+}
+
+// AssignVariant returns the user's assignment in the running experiment,
+// bucketing them and saving it to ab_test_assignments the first time. An
+// assignment is kept once made, so a user stays in their variant when the
+// weights change. It returns nil when no experiment is running.
+func (r *Recommender) AssignVariant(ctx context.Context, userID string) (*models.Assignment, error) {
+	if r.experiment == nil {
+		return nil, nil
+	}
+	if a, err := r.storedAssignment(ctx, userID); err != nil || a != nil {
+		return a, err
+	}
+
+	a := models.Assignment{
+		UserID:     userID,
+		Experiment: r.experiment.Name,
+		Variant:    r.experiment.Assign(userID),
+		AssignedAt: time.Now().UTC(),
+	}
+	if err := r.store.SaveAssignment(ctx, a); err != nil {
+		return nil, err
+	}
+	r.rememberAssignment(ctx, &a)
+	log.Printf("🧪 Assigned %s to %s/%s", userID, a.Experiment, a.Variant)
+	return &a, nil
+}
+
+// storedAssignment returns the user's saved assignment if it is to a
+// variant of the running experiment, or nil.
+func (r *Recommender) storedAssignment(ctx context.Context, userID string) (*models.Assignment, error) {
+	if r.experiment == nil {
+		return nil, nil
+	}
+	a := r.rememberedAssignment(ctx, userID)
+	if a == nil {
+		var err error
+		if a, err = r.store.GetAssignment(ctx, userID); err != nil || a == nil {
+			return nil, err
+		}
+		r.rememberAssignment(ctx, a)
+	}
+	if a.Experiment != r.experiment.Name {
+		return nil, nil
+	}
+	if _, ok := r.experiment.Variant(a.Variant); !ok {
+		return nil, nil
+	}
+	return a, nil
+}
+
+// rememberedAssignment returns the user's assignment if it is held in
+// process, or nil.
+func (r *Recommender) rememberedAssignment(ctx context.Context, userID string) *models.Assignment {
+	data, _ := r.assignments.Get(ctx, assignmentPrefix+userID)
+	if data == nil {
+		return nil
+	}
+	var a models.Assignment
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil
+	}
+	return &a
+}
+
+func (r *Recommender) rememberAssignment(ctx context.Context, a *models.Assignment) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return
+	}
+	r.assignments.Set(ctx, assignmentPrefix+a.UserID, data, assignmentCacheTTL)
+}
+
+// storedVariant is the variant of the user's saved assignment, or "" if
+// they have none or it cannot be read.
+func (r *Recommender) storedVariant(ctx context.Context, userID string) string {
+	a, err := r.storedAssignment(ctx, userID)
+	if err != nil {
+		log.Printf("Warning: failed to load assignment for %s: %v", userID, err)
+	}
+	if a == nil {
+		return ""
+	}
+	return a.Variant
+}
+
+// params returns how the variant's lists are produced: its experiment
+// parameters, or the defaults outside experiments.
+func (r *Recommender) params(variant string) abtest.Params {
+	if r.experiment != nil && variant != "" {
+		if v, ok := r.experiment.Variant(variant); ok {
+			return v.Params
+		}
+	}
+	return abtest.DefaultParams()
+}
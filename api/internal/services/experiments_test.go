@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"recommendation-engine/api/internal/abtest"
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
+	"recommendation-engine/api/internal/storage/memory"
+)
+
+// countingStore counts assignment reads.
+type countingStore struct {
+	storage.Store
+	reads int
+}
+
+func (s *countingStore) GetAssignment(ctx context.Context, userID string) (*models.Assignment, error) {
+	s.reads++
+	return s.Store.GetAssignment(ctx, userID)
+}
+
+func TestAssignVariantReadsStoreOnce(t *testing.T) {
+	ctx := context.Background()
+	experiment, err := abtest.Lookup(abtest.DefaultExperiment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &countingStore{Store: memory.New()}
+	r := NewRecommender(store, nil)
+	r.SetExperiment(experiment)
+
+	for i := 0; i < 3; i++ {
+		a, err := r.AssignVariant(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a == nil || a.Variant != "treatment" {
+			t.Fatalf("assignment = %+v, want treatment", a)
+		}
+	}
+	if store.reads != 1 {
+		t.Errorf("assignment reads = %d, want 1", store.reads)
+	}
+
+	// Erasure forgets the remembered assignment too.
+	if _, err := r.ForgetUser(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.AssignVariant(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if store.reads != 2 {
+		t.Errorf("assignment reads after erasure = %d, want 2", store.reads)
+	}
+}
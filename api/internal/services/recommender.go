@@ -1,25 +1,55 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
-	"math/rand"
-	"os"
+	"sort"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
+	"recommendation-engine/api/internal/abtest"
 	"recommendation-engine/api/internal/cache"
-	"recommendation-engine/api/internal/database"
+	"recommendation-engine/api/internal/events"
+	"recommendation-engine/api/internal/features"
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
 )
 
+// Recommender serves and tracks recommendations on top of a storage.Store
+// (Postgres, SQLite or in-memory) and a cache.Cache (Redis or in-process).
+// cache may be nil, in which case every request is computed.
 type Recommender struct {
-	db    *database.DB
-	cache *cache.RedisCache
+	store         storage.Store
+	cache         cache.Cache
+	registerItems bool
+	modelVersion  string
+	ttls          CacheTTLs
+	minViewDwell  time.Duration
+	popularity    cache.Popularity
+	features      *features.Store
+	metrics       *cache.Metrics
+	experiment    *abtest.Experiment
+	assignments   *cache.LRU
+	categories    *storage.Categories
+	clock         cache.Clock
+	flights       singleflight.Group
 }
 
-func NewRecommender(db *database.DB, cache *cache.RedisCache) *Recommender {
+// DefaultModelVersion labels lists from the built-in mock models.
+const DefaultModelVersion = "mock-v1"
+
+func NewRecommender(store storage.Store, c cache.Cache) *Recommender {
 	return &Recommender{
-		db:    db,
-		cache: cache,
+		store:        store,
+		cache:        c,
+		modelVersion: DefaultModelVersion,
+		ttls:         DefaultCacheTTLs(),
+		minViewDwell: DefaultMinViewDwell,
+		assignments:  cache.NewLRU(assignmentCacheSize, nil),
+		clock:        cache.SystemClock,
 	}
 }
 
@@ -30,47 +60,147 @@ type Recommendation struct {
 	Strategy    string  `json:"strategy"`
 }
 
-func (r *Recommender) GetRecommendations(userID string, count int) ([]Recommendation, string, error) {
+// recommendationListVersion is bumped whenever RecommendationList changes
+// in a way older readers cannot decode. Cached lists with another version
+// are misses.
+const recommendationListVersion = 1
+
+// RecommendationList is a generated list and how it was produced. It is
+// what the cache stores.
+type RecommendationList struct {
+	Version         int              `json:"version"`
+	Strategy        string           `json:"strategy"`
+	ModelVersion    string           `json:"model_version"`
+	Variant         string           `json:"variant,omitempty"`
+	GeneratedAt     time.Time        `json:"generated_at"`
+	Recommendations []Recommendation `json:"recommendations"`
+	// Cached is set when the list was served from the cache, and Stale
+	// when it was past its soft TTL and is being refreshed.
+	Cached bool `json:"-"`
+	Stale  bool `json:"-"`
+}
+
+// ModelVersion returns the label of lists generated now.
+func (r *Recommender) ModelVersion() string {
+	return r.modelVersion
+}
+
+// SetModelVersion labels lists generated from now on. Cached lists from
+// another model version are misses.
+func (r *Recommender) SetModelVersion(version string) {
+	r.modelVersion = version
+}
+
+// GetRecommendations returns up to count recommendations for the user in
+// the given experiment variant ("" outside experiments), from the cache
+// when a compatible list is held. A list past its soft TTL is still served
+// while it is refreshed in the background.
+func (r *Recommender) GetRecommendations(ctx context.Context, userID, variant string, count int) (*RecommendationList, error) {
 	// Try cache first
-	if cached, err := r.cache.GetUserRecommendations(userID); err == nil && cached != nil {
+	start := time.Now()
+	list, err := r.lookupList(ctx, userID, variant)
+	latency := time.Since(start)
+	if list != nil {
 		log.Printf("Cache hit for user: %s", userID)
-		var recs []Recommendation
-		for _, item := range cached {
-			recs = append(recs, Recommendation{
-				ItemID:      item["item_id"].(string),
-				Score:       item["score"].(float64),
-				Explanation: item["explanation"].(string),
-				Strategy:    "cached",
-			})
+		outcome := cache.Hit
+		if !r.fresh(list) {
+			list.Stale = true
+			outcome = cache.StaleHit
+			go r.refreshInBackground(userID, variant, count)
+		}
+		r.metrics.Observe(cache.RecsKeyspace, list.Strategy, outcome, latency)
+		if len(list.Recommendations) > count {
+			list.Recommendations = list.Recommendations[:count]
+		}
+		return list, nil
+	}
+
+	outcome := cache.Miss
+	if err != nil {
+		log.Printf("Warning: ignoring cached recommendations for %s: %v", userID, err)
+		outcome = cache.Error
+	}
+	list, err = r.refresh(ctx, userID, variant, count, true)
+	if r.cache != nil {
+		// Misses are counted against the strategy that filled them
+		strategy := ""
+		if list != nil {
+			strategy = list.Strategy
 		}
-		return recs, "cached", nil
+		r.metrics.Observe(cache.RecsKeyspace, strategy, outcome, latency)
 	}
+	return list, err
+}
+
+// SetCacheMetrics sets where recommendation list lookups are counted.
+func (r *Recommender) SetCacheMetrics(m *cache.Metrics) {
+	r.metrics = m
+}
+
+// generate computes a list without touching the cache.
+func (r *Recommender) generate(ctx context.Context, userID, variant string, count int) (*RecommendationList, error) {
+	params := r.params(variant)
 
 	// Check if new user (cold start)
-	recentViews, err := r.db.GetUserRecentViews(userID, 5)
+	recentViews, err := r.store.GetUserRecentViews(ctx, userID, max(params.ColdStartViews, 5))
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	var recommendations []Recommendation
-	var strategy string
+	var userFeatures *features.Snapshot
+	if len(recentViews) >= params.ColdStartViews {
+		// Strategies work without features, so a failed read is not fatal
+		if userFeatures, err = r.UserFeatures(ctx, userID); err != nil {
+			log.Printf("Warning: failed to read features for %s: %v", userID, err)
+		}
+	}
 
-	if len(recentViews) < 3 {
+	list := &RecommendationList{
+		Version:      recommendationListVersion,
+		ModelVersion: r.modelVersion,
+		Variant:      variant,
+		GeneratedAt:  r.clock.Now().UTC(),
+	}
+	if len(recentViews) < params.ColdStartViews {
 		// Cold start - show trending/popular items
-		recommendations = r.getTrendingRecommendations(count)
-		strategy = "trending"
+		list.Recommendations = r.getTrendingRecommendations(count)
+		list.Strategy = "trending"
 	} else {
 		// Personalized recommendations
-		recommendations = r.getPersonalizedRecommendations(userID, recentViews, count)
-		strategy = "personalized"
+		list.Recommendations = r.getPersonalizedRecommendations(ctx, userID, recentViews, userFeatures, params, count)
+		list.Strategy = params.Strategy
 	}
+	return list, nil
+}
 
-	// Cache the recommendations
-	if err := r.cache.SetUserRecommendations(userID, recommendations, 5*time.Minute); err != nil {
-		log.Printf("Warning: failed to cache recommendations: %v", err)
+// cachedList returns the user's cached list if it was generated for this
+// variant by the current model and list version, or nil. Entries that do
+// not decode count as misses.
+func (r *Recommender) cachedList(ctx context.Context, userID, variant string) *RecommendationList {
+	list, err := r.lookupList(ctx, userID, variant)
+	if err != nil {
+		log.Printf("Warning: ignoring cached recommendations for %s: %v", userID, err)
 	}
+	return list
+}
 
-	return recommendations, strategy, nil
+// lookupList is cachedList, returning the cache's error instead of logging
+// it.
+func (r *Recommender) lookupList(ctx context.Context, userID, variant string) (*RecommendationList, error) {
+	if r.cache == nil {
+		return nil, nil
+	}
+	var list RecommendationList
+	found, err := r.cache.GetUserRecommendations(ctx, userID, &list)
+	if err != nil {
+		return nil, err
+	}
+	if !found || list.Version != recommendationListVersion ||
+		list.ModelVersion != r.modelVersion || list.Variant != variant {
+		return nil, nil
+	}
+	list.Cached = true
+	return &list, nil
 }
 
 func (r *Recommender) getTrendingRecommendations(count int) []Recommendation {
@@ -103,7 +233,9 @@ func (r *Recommender) getTrendingRecommendations(count int) []Recommendation {
 	return recs
 }
 
-func (r *Recommender) getPersonalizedRecommendations(userID string, recentViews []string, count int) []Recommendation {
+// getPersonalizedRecommendations ranks candidates with a boost for the
+// user's category affinities when their features are known.
+func (r *Recommender) getPersonalizedRecommendations(ctx context.Context, userID string, recentViews []string, userFeatures *features.Snapshot, params abtest.Params, count int) []Recommendation {
 	// In production, this would use real ML models
 	// For now, return mock personalized recommendations
 	personalizedItems := []struct {
@@ -119,37 +251,217 @@ func (r *Recommender) getPersonalizedRecommendations(userID string, recentViews
 	}
 
 	var recs []Recommendation
-	for i, item := range personalizedItems {
-		if i >= count {
-			break
+	for _, item := range personalizedItems {
+		score := item.Score
+		if userFeatures != nil {
+			score += params.AffinityBoost * userFeatures.Affinity(r.categories.Of(ctx, item.ID))
 		}
 		recs = append(recs, Recommendation{
 			ItemID:      item.ID,
-			Score:       item.Score,
+			Score:       score,
 			Explanation: item.Explanation,
-			Strategy:    "personalized",
+			Strategy:    params.Strategy,
 		})
 	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Score > recs[j].Score })
+	if len(recs) > count {
+		recs = recs[:count]
+	}
 
 	return recs
 }
 
-func (r *Recommender) TrackUserEvent(userID, itemID, eventType string, duration *int) error {
-	// Log to database
-	if err := r.db.LogUserEvent(userID, itemID, eventType, duration); err != nil {
+// RegisterUnknownItems controls what happens to events for items missing
+// from the catalog: when enabled a placeholder item is created and the
+// event is kept, otherwise TrackUserEvent fails with storage.ErrUnknownItem.
+func (r *Recommender) RegisterUnknownItems(enabled bool) {
+	r.registerItems = enabled
+}
+
+// TrackUserEvent logs event to storage and updates the user's cached
+// activity and lists. The stores derived from events are updated by an
+// ingest.Pipeline.
+func (r *Recommender) TrackUserEvent(ctx context.Context, event models.UserEvent) error {
+	// Log to storage
+	err := r.store.LogUserEvent(ctx, event)
+	if errors.Is(err, storage.ErrUnknownItem) && r.registerItems {
+		if err := r.store.EnsureItems(ctx, []models.ContentItem{placeholderItem(event.ItemID)}); err != nil {
+			return err
+		}
+		log.Printf("📦 Registered placeholder item: %s", event.ItemID)
+		err = r.store.LogUserEvent(ctx, event)
+	}
+	if err != nil {
 		return err
 	}
 
-	// Update cache counters
-	if eventType == "view" || eventType == "click" {
-		if err := r.cache.IncrementUserActivity(userID); err != nil {
-			log.Printf("Warning: failed to update user activity: %v", err)
+	if r.cache != nil {
+		// Update cache counters
+		if event.EventType == "view" || event.EventType == "click" {
+			if err := r.cache.IncrementUserActivity(ctx, event.UserID); err != nil {
+				log.Printf("Warning: failed to update user activity: %v", err)
+			}
 		}
-	}
 
-	// Invalidate cached recommendations
-	r.cache.SetUserRecommendations(userID, nil, 0)
+		// Invalidate cached recommendations
+		if r.invalidatesList(event) {
+			if err := r.cache.InvalidateUserRecommendations(ctx, event.UserID); err != nil {
+				log.Printf("Warning: failed to invalidate cached recommendations: %v", err)
+			}
+		}
+	}
 
-	log.Printf("Tracked event: %s %s %s", userID, eventType, itemID)
+	log.Printf("Tracked event: %s %s %s", event.UserID, event.EventType, event.ItemID)
 	return nil
-}
\ No newline at end of file
+}
+
+// SetFeatures sets the store events update user features in.
+func (r *Recommender) SetFeatures(store *features.Store) {
+	r.features = store
+}
+
+// SetCategories sets where item categories are looked up when matching
+// items to the user's category affinities. They must be the categories
+// features are recorded under.
+func (r *Recommender) SetCategories(c *storage.Categories) {
+	r.categories = c
+}
+
+// UserFeatures returns the user's features, or nil if none are held or
+// there is no feature store.
+func (r *Recommender) UserFeatures(ctx context.Context, userID string) (*features.Snapshot, error) {
+	if r.features == nil {
+		return nil, nil
+	}
+	return r.features.Get(ctx, userID)
+}
+
+// SetPopularity sets the windowed item counters events are recorded in.
+func (r *Recommender) SetPopularity(p cache.Popularity) {
+	r.popularity = p
+}
+
+// TopItems returns the n most popular items over the window, overall or in
+// one category. Without counters it returns nil.
+func (r *Recommender) TopItems(ctx context.Context, category string, window time.Duration, n int) ([]cache.ItemScore, error) {
+	if r.popularity == nil {
+		return nil, nil
+	}
+	return r.popularity.Top(ctx, category, window, n)
+}
+
+// DefaultMinViewDwell is how long a view must last to invalidate the
+// viewer's cached list.
+const DefaultMinViewDwell = 10 * time.Second
+
+// SetMinViewDwell sets how long a view must last to invalidate the
+// viewer's cached list.
+func (r *Recommender) SetMinViewDwell(d time.Duration) {
+	r.minViewDwell = d
+}
+
+// invalidatesList reports whether an event says enough about the user to
+// drop their cached list. Clicks, likes and shares do; a view only when it
+// lasted at least minViewDwell; other events never do.
+func (r *Recommender) invalidatesList(e models.UserEvent) bool {
+	switch e.EventType {
+	case "click", "like", "share":
+		return true
+	case "view":
+		return e.Duration != nil && time.Duration(*e.Duration)*time.Second >= r.minViewDwell
+	}
+	return false
+}
+
+// listTags are the tags a list is cached under: its strategy and model
+// version, and every item in it.
+func listTags(list *RecommendationList) []string {
+	tags := []string{cache.StrategyTag(list.Strategy, list.ModelVersion)}
+	for _, rec := range list.Recommendations {
+		tags = append(tags, cache.ItemTag(rec.ItemID))
+	}
+	return tags
+}
+
+// InvalidateUser drops the user's cached list.
+func (r *Recommender) InvalidateUser(ctx context.Context, userID string) error {
+	if r.cache == nil {
+		return nil
+	}
+	return r.cache.InvalidateUserRecommendations(ctx, userID)
+}
+
+// InvalidateItems drops cached lists containing any of the items, after
+// catalog changes. It returns how many lists were dropped.
+func (r *Recommender) InvalidateItems(ctx context.Context, itemIDs []string) (int64, error) {
+	if r.cache == nil || len(itemIDs) == 0 {
+		return 0, nil
+	}
+	tags := make([]string, len(itemIDs))
+	for i, id := range itemIDs {
+		tags[i] = cache.ItemTag(id)
+	}
+	return r.cache.InvalidateTags(ctx, tags...)
+}
+
+// InvalidateStrategy drops cached lists produced by a strategy at a model
+// version and returns how many were dropped.
+func (r *Recommender) InvalidateStrategy(ctx context.Context, strategy, modelVersion string) (int64, error) {
+	if r.cache == nil {
+		return 0, nil
+	}
+	return r.cache.InvalidateTags(ctx, cache.StrategyTag(strategy, modelVersion))
+}
+
+// CachedUserData returns what the cache holds for the user, or nil when
+// there is no cache.
+func (r *Recommender) CachedUserData(ctx context.Context, userID string) (map[string]interface{}, error) {
+	if r.cache == nil {
+		return nil, nil
+	}
+	var recommendations json.RawMessage
+	if _, err := r.cache.GetUserRecommendations(ctx, userID, &recommendations); err != nil {
+		return nil, err
+	}
+	activity, err := r.cache.UserActivity(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"recommendations": recommendations,
+		"activity_count":  activity,
+	}, nil
+}
+
+// ForgetUser deletes the user's cached keys and features and returns how
+// many keys existed.
+func (r *Recommender) ForgetUser(ctx context.Context, userID string) (int64, error) {
+	var n int64
+	r.assignments.Delete(ctx, assignmentPrefix+userID)
+	if r.features != nil {
+		deleted, err := r.features.Delete(ctx, userID)
+		if err != nil {
+			return 0, err
+		}
+		n += deleted
+	}
+	if r.cache != nil {
+		deleted, err := r.cache.DeleteUser(ctx, userID)
+		if err != nil {
+			return n, err
+		}
+		n += deleted
+	}
+	return n, nil
+}
+
+// placeholderItem stands in for an item seen in events before it was added
+// to the catalog. A later catalog upsert replaces it.
+func placeholderItem(itemID string) models.ContentItem {
+	return models.ContentItem{
+		ID:       itemID,
+		Title:    itemID,
+		Category: events.Category(itemID),
+		Tags:     []string{"placeholder"},
+	}
+}
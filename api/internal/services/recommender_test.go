@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"recommendation-engine/api/internal/abtest"
+	"recommendation-engine/api/internal/cache"
+	"recommendation-engine/api/internal/features"
+	"recommendation-engine/api/internal/ingest"
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
+	"recommendation-engine/api/internal/storage/memory"
+)
+
+// A click on a served item raises its score through the user's category
+// affinity, more so in the treatment variant.
+func TestClickOnServedItemRaisesItsScore(t *testing.T) {
+	experiment, err := abtest.Lookup(abtest.DefaultExperiment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var boosts []float64
+	for _, variant := range []string{"control", "treatment"} {
+		t.Run(variant, func(t *testing.T) {
+			ctx := context.Background()
+			store := memory.New()
+			categories := storage.NewCategories(store)
+			userFeatures := features.NewStore(cache.NewLRU(100, nil), "memory", features.DefaultConfig())
+			pipeline := &ingest.Pipeline{Features: userFeatures, Categories: categories}
+
+			r := NewRecommender(store, nil)
+			r.RegisterUnknownItems(true)
+			r.SetFeatures(userFeatures)
+			r.SetCategories(categories)
+			r.SetExperiment(experiment)
+
+			track := func(itemID, eventType string) {
+				e := models.UserEvent{UserID: "u1", ItemID: itemID, EventType: eventType, Timestamp: time.Now().UTC()}
+				if err := r.TrackUserEvent(ctx, e); err != nil {
+					t.Fatal(err)
+				}
+				pipeline.Apply(ctx, e)
+			}
+			for _, itemID := range []string{"item_tech_2", "item_science_2", "item_health_2"} {
+				track(itemID, "view")
+			}
+
+			before := scoreOf(t, r, variant, "item_business_2")
+			track("item_business_2", "click")
+			after := scoreOf(t, r, variant, "item_business_2")
+			if after <= before {
+				t.Fatalf("score after click = %v, want more than %v", after, before)
+			}
+			boosts = append(boosts, after-before)
+		})
+	}
+	if len(boosts) == 2 && boosts[1] <= boosts[0] {
+		t.Errorf("treatment boost %v is not larger than control boost %v", boosts[1], boosts[0])
+	}
+}
+
+func scoreOf(t *testing.T, r *Recommender, variant, itemID string) float64 {
+	t.Helper()
+	list, err := r.generate(context.Background(), "u1", variant, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range list.Recommendations {
+		if rec.ItemID == itemID {
+			return rec.Score
+		}
+	}
+	t.Fatalf("%s not in %s list %+v", itemID, list.Strategy, list.Recommendations)
+	return 0
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"recommendation-engine/api/internal/cache"
+)
+
+// recsLockPrefix keys the lock an instance holds while it computes a
+// user's list. It must not start with the recs: prefix, which is
+// invalidated wholesale.
+const recsLockPrefix = "lock:recs:"
+
+// MaxListLength is how many recommendations are computed and cached per
+// list. Callers asking for fewer get a prefix of it, so requests for
+// different counts can share one computation and one cached list.
+const MaxListLength = 50
+
+// CacheTTLs controls how long cached lists are used. A list younger than
+// Soft is served as is; one between Soft and Hard is served stale while a
+// single refresh runs; after Hard it is gone and the next request computes
+// it. Lock bounds how long one instance holds the cross-process lock, and
+// LockWait how long a request waits for another instance's result before
+// computing the list itself.
+type CacheTTLs struct {
+	Soft     time.Duration
+	Hard     time.Duration
+	Lock     time.Duration
+	LockWait time.Duration
+}
+
+func DefaultCacheTTLs() CacheTTLs {
+	return CacheTTLs{
+		Soft:     5 * time.Minute,
+		Hard:     30 * time.Minute,
+		Lock:     5 * time.Second,
+		LockWait: 500 * time.Millisecond,
+	}
+}
+
+// SetCacheTTLs replaces the soft and hard TTLs and lock timings.
+func (r *Recommender) SetCacheTTLs(ttls CacheTTLs) {
+	r.ttls = ttls
+}
+
+// SetClock replaces the clock lists are stamped and aged with.
+func (r *Recommender) SetClock(clock cache.Clock) {
+	r.clock = clock
+}
+
+func (r *Recommender) fresh(list *RecommendationList) bool {
+	return r.clock.Now().Sub(list.GeneratedAt) < r.ttls.Soft
+}
+
+// refresh computes and caches the user's list and returns its first count
+// entries. Concurrent calls for the same user and variant in this process
+// share one computation; across
+// processes a short lock lets one instance compute while the others wait
+// up to LockWait for its result. With wait false a locked list is left to
+// its holder and nil is returned.
+func (r *Recommender) refresh(ctx context.Context, userID, variant string, count int, wait bool) (*RecommendationList, error) {
+	// The shared computation must not fail because the first caller left
+	ctx = context.WithoutCancel(ctx)
+	v, err, _ := r.flights.Do(userID+"\x00"+variant, func() (interface{}, error) {
+		return r.computeLocked(ctx, userID, variant, wait)
+	})
+	if err != nil {
+		return nil, err
+	}
+	shared, _ := v.(*RecommendationList)
+	if shared == nil {
+		if !wait {
+			return nil, nil
+		}
+		// Joined a background refresh that left the list to another instance
+		if shared, err = r.computeLocked(ctx, userID, variant, true); err != nil {
+			return nil, err
+		}
+	}
+
+	list := *shared
+	if len(list.Recommendations) > count {
+		list.Recommendations = list.Recommendations[:count]
+	}
+	return &list, nil
+}
+
+func (r *Recommender) computeLocked(ctx context.Context, userID, variant string, wait bool) (*RecommendationList, error) {
+	if r.cache != nil {
+		lockKey := recsLockPrefix + userID + ":" + variant
+		// The token keeps a holder whose lock expired from releasing the
+		// next holder's
+		token := lockToken()
+		locked, err := r.cache.SetNX(ctx, lockKey, token, r.ttls.Lock)
+		switch {
+		case err != nil:
+			log.Printf("Warning: failed to take recommendation lock, computing anyway: %v", err)
+		case locked:
+			defer func() {
+				if _, err := r.cache.DeleteIfEquals(ctx, lockKey, token); err != nil {
+					log.Printf("Warning: failed to release recommendation lock: %v", err)
+				}
+			}()
+		case !wait:
+			return nil, nil
+		default:
+			if list := r.awaitFreshList(ctx, userID, variant); list != nil {
+				return list, nil
+			}
+		}
+	}
+
+	list, err := r.generate(ctx, userID, variant, MaxListLength)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cache the recommendations
+	if r.cache != nil {
+		if err := r.cache.SetUserRecommendations(ctx, userID, list, r.ttls.Hard, listTags(list)...); err != nil {
+			log.Printf("Warning: failed to cache recommendations: %v", err)
+		}
+	}
+	return list, nil
+}
+
+func lockToken() []byte {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return []byte(hex.EncodeToString(b))
+}
+
+// awaitFreshList polls the cache for a fresh list written by the instance
+// holding the lock, for up to LockWait.
+func (r *Recommender) awaitFreshList(ctx context.Context, userID, variant string) *RecommendationList {
+	deadline := time.Now().Add(r.ttls.LockWait)
+	for time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		if list := r.cachedList(ctx, userID, variant); list != nil && r.fresh(list) {
+			return list
+		}
+	}
+	return nil
+}
+
+func (r *Recommender) refreshInBackground(userID, variant string, count int) {
+	if _, err := r.refresh(context.Background(), userID, variant, count, false); err != nil {
+		log.Printf("Warning: background refresh of recommendations for %s failed: %v", userID, err)
+	}
+}
+
+// HasFreshList reports whether the user's cached list for their variant is
+// within its soft TTL.
+func (r *Recommender) HasFreshList(ctx context.Context, userID string) bool {
+	list := r.cachedList(ctx, userID, r.storedVariant(ctx, userID))
+	return list != nil && r.fresh(list)
+}
+
+// Warm computes and caches the user's list for their variant unless
+// another instance is computing it, and reports whether it did. Users not
+// yet assigned are warmed outside experiments; warming does not assign
+// them.
+func (r *Recommender) Warm(ctx context.Context, userID string) (bool, error) {
+	if r.cache == nil {
+		return false, nil
+	}
+	list, err := r.refresh(ctx, userID, r.storedVariant(ctx, userID), MaxListLength, false)
+	return list != nil, err
+}
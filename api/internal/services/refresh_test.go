@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"recommendation-engine/api/internal/cache"
+	"recommendation-engine/api/internal/storage/memory"
+)
+
+func TestCachedListTTLs(t *testing.T) {
+	ttls := DefaultCacheTTLs()
+	tests := []struct {
+		name    string
+		age     time.Duration
+		outcome cache.Outcome
+	}{
+		{"new list", 0, cache.Hit},
+		{"just before the soft ttl", ttls.Soft - time.Second, cache.Hit},
+		{"at the soft ttl", ttls.Soft, cache.StaleHit},
+		{"just before the hard ttl", ttls.Hard - time.Second, cache.StaleHit},
+		{"at the hard ttl", ttls.Hard, cache.Miss},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := cache.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+			metrics := cache.NewMetrics()
+			r := NewRecommender(memory.New(), cache.NewLRU(100, clock))
+			r.SetClock(clock)
+			r.SetCacheTTLs(ttls)
+			r.SetCacheMetrics(metrics)
+
+			if _, err := r.GetRecommendations(ctx, "u1", "", 5); err != nil {
+				t.Fatal(err)
+			}
+			clock.Advance(tt.age)
+			list, err := r.GetRecommendations(ctx, "u1", "", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cached := tt.outcome != cache.Miss; list.Cached != cached {
+				t.Errorf("cached = %v, want %v", list.Cached, cached)
+			}
+			if stale := tt.outcome == cache.StaleHit; list.Stale != stale {
+				t.Errorf("stale = %v, want %v", list.Stale, stale)
+			}
+
+			// The first lookup was the miss that filled the cache
+			stats := metrics.Keyspaces()[cache.RecsKeyspace]
+			var got int64
+			switch tt.outcome {
+			case cache.Hit:
+				got = stats.Hits
+			case cache.StaleHit:
+				got = stats.StaleHits
+			case cache.Miss:
+				got = stats.Misses - 1
+			}
+			if stats.Lookups != 2 || got != 1 {
+				t.Errorf("recs stats = %+v, want one %s after the first miss", stats, tt.outcome)
+			}
+		})
+	}
+}
+
+// A list computed for a small count still serves callers asking for more.
+func TestCachedListServesLargerCounts(t *testing.T) {
+	ctx := context.Background()
+	r := NewRecommender(memory.New(), cache.NewLRU(100, nil))
+
+	first, err := r.GetRecommendations(ctx, "u1", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := r.GetRecommendations(ctx, "u1", "", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Recommendations) != 2 || len(second.Recommendations) != 5 || !second.Cached {
+		t.Errorf("got %d then %d cached=%v recommendations, want 2 then 5 cached", len(first.Recommendations), len(second.Recommendations), second.Cached)
+	}
+}
+
+// lockStealer takes the recommendation lock over while a list is being
+// cached, as another instance would once the first holder's lock expired.
+type lockStealer struct {
+	cache.Cache
+}
+
+func (c lockStealer) SetUserRecommendations(ctx context.Context, userID string, recommendations interface{}, ttl time.Duration, tags ...string) error {
+	if err := c.Cache.Set(ctx, recsLockPrefix+userID+":", []byte("other"), time.Minute); err != nil {
+		return err
+	}
+	return c.Cache.SetUserRecommendations(ctx, userID, recommendations, ttl, tags...)
+}
+
+func TestRefreshKeepsAnotherHoldersLock(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRU(100, nil)
+	r := NewRecommender(memory.New(), lockStealer{lru})
+
+	if _, err := r.GetRecommendations(ctx, "u1", "", 5); err != nil {
+		t.Fatal(err)
+	}
+	holder, err := lru.Get(ctx, recsLockPrefix+"u1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(holder) != "other" {
+		t.Errorf("lock = %q after refresh, want the other holder's", holder)
+	}
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"recommendation-engine/api/internal/storage"
+)
+
+// ErrWarmInProgress is returned when a warm run is requested while one is
+// running.
+var ErrWarmInProgress = errors.New("cache warm already in progress")
+
+// WarmerConfig controls cache warming.
+type WarmerConfig struct {
+	// Interval between scheduled runs; 0 disables them.
+	Interval time.Duration
+	// ActiveWithin selects users by users.last_active.
+	ActiveWithin time.Duration
+	// MaxUsers caps a run, most recently active first.
+	MaxUsers int
+	// Concurrency is how many lists are computed at once.
+	Concurrency int
+	// RatePerSecond caps lists computed per second; 0 means no cap. It is
+	// at most MaxWarmRate.
+	RatePerSecond float64
+}
+
+// MaxWarmRate is the highest RatePerSecond; above it use 0 for no cap.
+const MaxWarmRate = 1e6
+
+func DefaultWarmerConfig() WarmerConfig {
+	return WarmerConfig{
+		Interval:      15 * time.Minute,
+		ActiveWithin:  24 * time.Hour,
+		MaxUsers:      10000,
+		Concurrency:   4,
+		RatePerSecond: 50,
+	}
+}
+
+// WarmProgress reports the current or last warm run.
+type WarmProgress struct {
+	Running    bool       `json:"running"`
+	Trigger    string     `json:"trigger,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Total      int        `json:"total"`
+	Done       int        `json:"done"`
+	// Warmed lists were computed; Skipped were already fresh or being
+	// computed by another instance.
+	Warmed    int    `json:"warmed"`
+	Skipped   int    `json:"skipped"`
+	Failed    int    `json:"failed"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Warmer precomputes cached lists for recently active users, so a deploy
+// or cache flush does not turn every request into a miss.
+type Warmer struct {
+	recommender *Recommender
+	users       storage.UserStore
+	config      WarmerConfig
+
+	mu       sync.Mutex
+	progress WarmProgress
+}
+
+func NewWarmer(recommender *Recommender, users storage.UserStore, config WarmerConfig) *Warmer {
+	return &Warmer{recommender: recommender, users: users, config: config}
+}
+
+// Progress returns the current or last run.
+func (w *Warmer) Progress() WarmProgress {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.progress
+}
+
+// Start runs a warm in the background. It fails with ErrWarmInProgress if
+// one is running.
+func (w *Warmer) Start(trigger string) error {
+	if err := w.begin(trigger); err != nil {
+		return err
+	}
+	go w.run(context.Background())
+	return nil
+}
+
+// RunPeriodically warms every Interval until the process exits.
+func (w *Warmer) RunPeriodically() {
+	if w.config.Interval <= 0 {
+		return
+	}
+	for range time.Tick(w.config.Interval) {
+		if err := w.Start("schedule"); err != nil {
+			log.Printf("Warning: skipping scheduled cache warm: %v", err)
+		}
+	}
+}
+
+func (w *Warmer) begin(trigger string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.progress.Running {
+		return ErrWarmInProgress
+	}
+	now := time.Now().UTC()
+	w.progress = WarmProgress{Running: true, Trigger: trigger, StartedAt: &now}
+	return nil
+}
+
+func (w *Warmer) run(ctx context.Context) {
+	defer func() {
+		w.mu.Lock()
+		now := time.Now().UTC()
+		w.progress.Running = false
+		w.progress.FinishedAt = &now
+		p := w.progress
+		w.mu.Unlock()
+		log.Printf("🔥 CACHE WARM finished (%s): %d users, %d warmed, %d skipped, %d failed in %s",
+			p.Trigger, p.Total, p.Warmed, p.Skipped, p.Failed, p.FinishedAt.Sub(*p.StartedAt).Round(time.Millisecond))
+	}()
+
+	userIDs, err := w.users.RecentlyActiveUsers(ctx, time.Now().Add(-w.config.ActiveWithin), w.config.MaxUsers)
+	if err != nil {
+		w.mu.Lock()
+		w.progress.LastError = err.Error()
+		w.mu.Unlock()
+		log.Printf("Warning: cache warm could not list active users: %v", err)
+		return
+	}
+	w.mu.Lock()
+	w.progress.Total = len(userIDs)
+	w.mu.Unlock()
+	log.Printf("🔥 CACHE WARM started: %d users active in the last %s", len(userIDs), w.config.ActiveWithin)
+
+	// The rate cap applies to computations; users with a fresh list are
+	// skipped without waiting
+	var tick <-chan time.Time
+	if w.config.RatePerSecond > 0 {
+		// Rates above one per nanosecond would truncate to a zero interval
+		interval := time.Duration(float64(time.Second) / w.config.RatePerSecond)
+		if interval <= 0 {
+			interval = time.Nanosecond
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < w.config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range queue {
+				if w.recommender.HasFreshList(ctx, userID) {
+					w.record(false, nil)
+					continue
+				}
+				if tick != nil {
+					<-tick
+				}
+				w.record(w.recommender.Warm(ctx, userID))
+			}
+		}()
+	}
+	for _, userID := range userIDs {
+		queue <- userID
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// record counts one user's outcome.
+func (w *Warmer) record(warmed bool, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch {
+	case err != nil:
+		w.progress.Failed++
+		w.progress.LastError = err.Error()
+	case warmed:
+		w.progress.Warmed++
+	default:
+		w.progress.Skipped++
+	}
+	w.progress.Done++
+	if w.progress.Done%1000 == 0 {
+		log.Printf("🔥 CACHE WARM progress: %d/%d users", w.progress.Done, w.progress.Total)
+	}
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Categories looks up the category an item is filed under, as CategoryOf
+// gives it, and remembers it so ingestion and ranking do not read the
+// catalog for every event. Call Forget when items change. A nil
+// *Categories, or one without a catalog, derives categories from item IDs.
+type Categories struct {
+	items ItemStore
+
+	mu    sync.Mutex
+	known map[string]string
+}
+
+func NewCategories(items ItemStore) *Categories {
+	return &Categories{items: items, known: make(map[string]string)}
+}
+
+// Of returns the item's category. A failed catalog read falls back to the
+// category in its ID and is not remembered.
+func (c *Categories) Of(ctx context.Context, itemID string) string {
+	if c == nil || c.items == nil {
+		return CategoryOf(itemID, "")
+	}
+	c.mu.Lock()
+	category, exists := c.known[itemID]
+	c.mu.Unlock()
+	if exists {
+		return category
+	}
+
+	item, err := c.items.GetItem(ctx, itemID)
+	if err != nil {
+		log.Printf("Warning: failed to look up category of %s: %v", itemID, err)
+		return CategoryOf(itemID, "")
+	}
+	catalogCategory := ""
+	if item != nil {
+		catalogCategory = item.Category
+	}
+	category = CategoryOf(itemID, catalogCategory)
+
+	c.mu.Lock()
+	c.known[itemID] = category
+	c.mu.Unlock()
+	return category
+}
+
+// Forget drops what is remembered about the items.
+func (c *Categories) Forget(itemIDs ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range itemIDs {
+		delete(c.known, id)
+	}
+}
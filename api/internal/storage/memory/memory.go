@@ -0,0 +1,505 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
+)
+
+var _ storage.Store = (*Store)(nil)
+
+// QuarantinedEvent mirrors a row of quarantined_events.
+type QuarantinedEvent = models.QuarantinedEvent
+
+// DefaultEventRetention is how long the memory store keeps events.
+const DefaultEventRetention = 30 * 24 * time.Hour
+
+// maxViewsPerUser bounds the views indexed per user for
+// GetUserRecentViews, which only ever asks for a few.
+const maxViewsPerUser = 100
+
+// Store is an in-process implementation of storage.Store for local runs
+// and tests. Nothing is persisted. Events are kept for the event retention,
+// measured back from the newest one received.
+type Store struct {
+	mu        sync.RWMutex
+	users     map[string]models.User
+	items     map[string]models.ContentItem
+	events    []models.UserEvent
+	retention time.Duration
+	// views holds each user's latest views, oldest first
+	views       map[string][]models.UserEvent
+	quarantined []QuarantinedEvent
+	assignments map[string]models.Assignment
+	served      map[string]models.Impression
+	rollups     map[rollupKey]*models.RollupCounts
+	rollupUsers map[rollupKey]map[string]bool
+	erasures    []models.ErasureRecord
+}
+
+// rollupKey identifies one hour of an item's or a category's counters.
+type rollupKey struct {
+	category bool
+	key      string
+	hour     time.Time
+}
+
+func New() *Store {
+	return &Store{
+		users:       make(map[string]models.User),
+		items:       make(map[string]models.ContentItem),
+		retention:   DefaultEventRetention,
+		views:       make(map[string][]models.UserEvent),
+		assignments: make(map[string]models.Assignment),
+		served:      make(map[string]models.Impression),
+		rollups:     make(map[rollupKey]*models.RollupCounts),
+		rollupUsers: make(map[rollupKey]map[string]bool),
+	}
+}
+
+// SetEventRetention sets how long events are kept; 0 keeps them all.
+func (s *Store) SetEventRetention(retention time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = retention
+}
+
+func (s *Store) GetUser(ctx context.Context, id string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func (s *Store) UpsertUser(ctx context.Context, user models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, exists := s.users[user.ID]; exists {
+		user.CreatedAt = existing.CreatedAt
+	} else if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now().UTC()
+	}
+	if user.LastActive.IsZero() {
+		user.LastActive = time.Now().UTC()
+	}
+	s.users[user.ID] = user
+	return nil
+}
+
+func (s *Store) TouchUsers(ctx context.Context, lastActive map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, t := range lastActive {
+		user, exists := s.users[id]
+		if !exists {
+			user = models.User{ID: id, CreatedAt: time.Now().UTC()}
+		}
+		if t.After(user.LastActive) {
+			user.LastActive = t
+		}
+		s.users[id] = user
+	}
+	return nil
+}
+
+func (s *Store) RecentlyActiveUsers(ctx context.Context, since time.Time, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []models.User
+	for _, user := range s.users {
+		if !user.LastActive.Before(since) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].LastActive.After(users[j].LastActive) })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	ids := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return ids, nil
+}
+
+func (s *Store) GetItem(ctx context.Context, id string) (*models.ContentItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, exists := s.items[id]
+	if !exists || item.DeletedAt != nil {
+		return nil, nil
+	}
+	return &item, nil
+}
+
+func (s *Store) ListItems(ctx context.Context, category string, limit int) ([]models.ContentItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []models.ContentItem
+	for _, item := range s.items {
+		if item.DeletedAt == nil && (category == "" || item.Category == category) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].CreatedAt.After(items[j].CreatedAt)
+		}
+		return items[i].ID < items[j].ID
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (s *Store) CreateItem(ctx context.Context, item models.ContentItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, exists := s.items[item.ID]; exists && existing.DeletedAt == nil {
+		return storage.ErrAlreadyExists
+	}
+	now := time.Now().UTC()
+	item.CreatedAt, item.UpdatedAt, item.DeletedAt = now, now, nil
+	s.items[item.ID] = item
+	return nil
+}
+
+func (s *Store) UpdateItem(ctx context.Context, item models.ContentItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.items[item.ID]
+	if !exists || existing.DeletedAt != nil {
+		return storage.ErrNotFound
+	}
+	item.CreatedAt, item.UpdatedAt, item.DeletedAt = existing.CreatedAt, time.Now().UTC(), nil
+	s.items[item.ID] = item
+	return nil
+}
+
+func (s *Store) UpsertItems(ctx context.Context, items []models.ContentItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, item := range items {
+		item.CreatedAt = now
+		if existing, exists := s.items[item.ID]; exists {
+			item.CreatedAt = existing.CreatedAt
+		}
+		item.UpdatedAt, item.DeletedAt = now, nil
+		s.items[item.ID] = item
+	}
+	return nil
+}
+
+func (s *Store) DeleteItem(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, exists := s.items[id]
+	if !exists || item.DeletedAt != nil {
+		return storage.ErrNotFound
+	}
+	now := time.Now().UTC()
+	item.UpdatedAt, item.DeletedAt = now, &now
+	s.items[id] = item
+	return nil
+}
+
+func (s *Store) EnsureItems(ctx context.Context, items []models.ContentItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, item := range items {
+		if _, exists := s.items[item.ID]; exists {
+			continue
+		}
+		item.CreatedAt, item.UpdatedAt, item.DeletedAt = now, now, nil
+		s.items[item.ID] = item
+	}
+	return nil
+}
+
+func (s *Store) LogUserEvent(ctx context.Context, e models.UserEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.ReceivedAt.IsZero() {
+		e.ReceivedAt = time.Now().UTC()
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = e.ReceivedAt
+	}
+
+	// Mirror the user and item foreign keys on user_events
+	if _, exists := s.items[e.ItemID]; !exists {
+		return storage.ErrUnknownItem
+	}
+	if _, exists := s.users[e.UserID]; !exists {
+		s.users[e.UserID] = models.User{ID: e.UserID, CreatedAt: e.ReceivedAt, LastActive: e.Timestamp}
+	}
+	s.events = append(s.events, e)
+	if e.EventType == "view" {
+		views := append(s.views[e.UserID], e)
+		if len(views) > maxViewsPerUser {
+			views = views[len(views)-maxViewsPerUser:]
+		}
+		s.views[e.UserID] = views
+	}
+	s.expireEvents(e.ReceivedAt)
+	return nil
+}
+
+// expireEvents drops events received more than the retention before now,
+// along with their users' indexed views. Events arrive in receive order, so
+// the expired ones are at the front.
+func (s *Store) expireEvents(now time.Time) {
+	if s.retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-s.retention)
+	n := 0
+	for n < len(s.events) && s.events[n].ReceivedAt.Before(cutoff) {
+		e := s.events[n]
+		if e.EventType == "view" {
+			views := s.views[e.UserID]
+			for len(views) > 0 && views[0].ReceivedAt.Before(cutoff) {
+				views = views[1:]
+			}
+			if len(views) == 0 {
+				delete(s.views, e.UserID)
+			} else {
+				s.views[e.UserID] = views
+			}
+		}
+		n++
+	}
+	if n > 0 {
+		s.events = s.events[n:]
+	}
+}
+
+func (s *Store) GetUserRecentViews(ctx context.Context, userID string, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	views := append([]models.UserEvent(nil), s.views[userID]...)
+	sort.SliceStable(views, func(i, j int) bool {
+		return views[i].Timestamp.After(views[j].Timestamp)
+	})
+
+	var items []string
+	for i := 0; i < len(views) && i < limit; i++ {
+		items = append(items, views[i].ItemID)
+	}
+	return items, nil
+}
+
+func (s *Store) ForEachUserEvent(ctx context.Context, from, to time.Time, fn func(models.UserEvent) error) error {
+	s.mu.RLock()
+	events := make([]models.UserEvent, len(s.events))
+	copy(events, s.events)
+	s.mu.RUnlock()
+
+	for _, e := range events {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !from.IsZero() && e.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !e.Timestamp.Before(to) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) LogQuarantinedEvent(ctx context.Context, e models.UserEvent, userAgent string, reasons []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quarantined = append(s.quarantined, QuarantinedEvent{
+		Event:         e,
+		UserAgent:     userAgent,
+		Reasons:       reasons,
+		QuarantinedAt: time.Now().UTC(),
+	})
+	return nil
+}
+
+// Quarantined returns every quarantined event logged so far.
+func (s *Store) Quarantined() []QuarantinedEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	quarantined := make([]QuarantinedEvent, len(s.quarantined))
+	copy(quarantined, s.quarantined)
+	return quarantined
+}
+
+func (s *Store) GetAssignment(ctx context.Context, userID string) (*models.Assignment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, exists := s.assignments[userID]
+	if !exists {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+func (s *Store) SaveAssignment(ctx context.Context, a models.Assignment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a.AssignedAt.IsZero() {
+		a.AssignedAt = time.Now().UTC()
+	}
+	s.assignments[a.UserID] = a
+	return nil
+}
+
+func (s *Store) LogRecommendationsServed(ctx context.Context, imp models.Impression) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Mirror the users foreign key on recommendations_served
+	if _, exists := s.users[imp.UserID]; !exists {
+		now := time.Now().UTC()
+		s.users[imp.UserID] = models.User{ID: imp.UserID, CreatedAt: now, LastActive: now}
+	}
+	s.served[imp.RequestID] = imp
+	return nil
+}
+
+func (s *Store) GetRecommendationsServed(ctx context.Context, requestID string) (*models.Impression, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	imp, exists := s.served[requestID]
+	if !exists {
+		return nil, nil
+	}
+	return &imp, nil
+}
+
+func (s *Store) ApplyRollups(ctx context.Context, deltas []models.RollupDelta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range deltas {
+		category := storage.CategoryOf(d.ItemID, s.items[d.ItemID].Category)
+		s.applyRollup(rollupKey{key: d.ItemID, hour: d.Hour}, d)
+		s.applyRollup(rollupKey{category: true, key: category, hour: d.Hour}, d)
+	}
+	return nil
+}
+
+func (s *Store) applyRollup(key rollupKey, d models.RollupDelta) {
+	counts, exists := s.rollups[key]
+	if !exists {
+		counts = &models.RollupCounts{}
+		s.rollups[key] = counts
+	}
+	delta := d.Counts
+	delta.UniqueUsers = 0
+
+	users, exists := s.rollupUsers[key]
+	if !exists {
+		users = make(map[string]bool)
+		s.rollupUsers[key] = users
+	}
+	for _, user := range d.Users {
+		if !users[user] {
+			users[user] = true
+			delta.UniqueUsers++
+		}
+	}
+	counts.Add(delta)
+}
+
+func (s *Store) ItemRollups(ctx context.Context, from, to time.Time) ([]models.Rollup, error) {
+	return s.sumRollups(false, from, to), nil
+}
+
+func (s *Store) CategoryRollups(ctx context.Context, from, to time.Time) ([]models.Rollup, error) {
+	return s.sumRollups(true, from, to), nil
+}
+
+func (s *Store) sumRollups(category bool, from, to time.Time) []models.Rollup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sums := make(map[string]*models.Rollup)
+	for key, counts := range s.rollups {
+		if key.category != category || key.hour.Before(from) || !key.hour.Before(to) {
+			continue
+		}
+		sum, exists := sums[key.key]
+		if !exists {
+			sum = &models.Rollup{Key: key.key}
+			sums[key.key] = sum
+		}
+		sum.Add(*counts)
+	}
+
+	rollups := make([]models.Rollup, 0, len(sums))
+	for _, sum := range sums {
+		if !category {
+			item := s.items[sum.Key]
+			sum.Title, sum.Category = item.Title, storage.CategoryOf(sum.Key, item.Category)
+		}
+		rollups = append(rollups, *sum)
+	}
+	return rollups
+}
+
+func (s *Store) HourlyItemRollups(ctx context.Context, itemID string, from, to time.Time) ([]models.Rollup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rollups []models.Rollup
+	for key, counts := range s.rollups {
+		if key.category || key.key != itemID || key.hour.Before(from) || !key.hour.Before(to) {
+			continue
+		}
+		rollups = append(rollups, models.Rollup{Key: itemID, Hour: key.hour, RollupCounts: *counts})
+	}
+	sort.Slice(rollups, func(i, j int) bool {
+		return rollups[i].Hour.Before(rollups[j].Hour)
+	})
+	return rollups, nil
+}
+
+func (s *Store) PruneRollupUsers(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.rollupUsers {
+		if key.hour.Before(before) {
+			delete(s.rollupUsers, key)
+		}
+	}
+	return nil
+}
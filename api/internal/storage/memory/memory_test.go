@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+)
+
+func newStoreWithItems(t *testing.T, n int) *Store {
+	t.Helper()
+	s := New()
+	var items []models.ContentItem
+	for i := 0; i < n; i++ {
+		items = append(items, models.ContentItem{ID: "item_" + strconv.Itoa(i), Title: "Item", Category: "tech"})
+	}
+	if err := s.UpsertItems(context.Background(), items); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func logEvent(t *testing.T, s *Store, userID, itemID, eventType string, at time.Time) {
+	t.Helper()
+	e := models.UserEvent{UserID: userID, ItemID: itemID, EventType: eventType, Timestamp: at, ReceivedAt: at}
+	if err := s.LogUserEvent(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetUserRecentViews(t *testing.T) {
+	ctx := context.Background()
+	s := newStoreWithItems(t, 5)
+	logEvent(t, s, "u1", "item_0", "view", testStart)
+	logEvent(t, s, "u1", "item_1", "click", testStart.Add(time.Minute))
+	logEvent(t, s, "u2", "item_2", "view", testStart.Add(2*time.Minute))
+	logEvent(t, s, "u1", "item_3", "view", testStart.Add(3*time.Minute))
+	// Late events are ordered by event time
+	logEvent(t, s, "u1", "item_4", "view", testStart.Add(-time.Minute))
+
+	tests := []struct {
+		userID string
+		limit  int
+		want   []string
+	}{
+		{"u1", 10, []string{"item_3", "item_0", "item_4"}},
+		{"u1", 2, []string{"item_3", "item_0"}},
+		{"u2", 10, []string{"item_2"}},
+		{"u3", 10, nil},
+	}
+	for _, tt := range tests {
+		got, err := s.GetUserRecentViews(ctx, tt.userID, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetUserRecentViews(%s, %d) = %v, want %v", tt.userID, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestEventRetention(t *testing.T) {
+	ctx := context.Background()
+	s := newStoreWithItems(t, 3)
+	s.SetEventRetention(24 * time.Hour)
+	logEvent(t, s, "u1", "item_0", "view", testStart)
+	logEvent(t, s, "u2", "item_1", "view", testStart.Add(time.Hour))
+	logEvent(t, s, "u1", "item_2", "view", testStart.Add(25*time.Hour))
+
+	var kept []string
+	err := s.ForEachUserEvent(ctx, time.Time{}, time.Time{}, func(e models.UserEvent) error {
+		kept = append(kept, e.ItemID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"item_1", "item_2"}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("events kept = %v, want %v", kept, want)
+	}
+	if views, _ := s.GetUserRecentViews(ctx, "u1", 10); !reflect.DeepEqual(views, []string{"item_2"}) {
+		t.Errorf("u1 views = %v, want [item_2]", views)
+	}
+	if views, _ := s.GetUserRecentViews(ctx, "u2", 10); !reflect.DeepEqual(views, []string{"item_1"}) {
+		t.Errorf("u2 views = %v, want [item_1]", views)
+	}
+}
+
+func TestViewsPerUserAreCapped(t *testing.T) {
+	ctx := context.Background()
+	s := newStoreWithItems(t, maxViewsPerUser+10)
+	for i := 0; i < maxViewsPerUser+10; i++ {
+		logEvent(t, s, "u1", "item_"+strconv.Itoa(i), "view", testStart.Add(time.Duration(i)*time.Second))
+	}
+
+	if n := len(s.views["u1"]); n != maxViewsPerUser {
+		t.Errorf("views indexed = %d, want %d", n, maxViewsPerUser)
+	}
+	views, err := s.GetUserRecentViews(ctx, "u1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "item_" + strconv.Itoa(maxViewsPerUser+9); len(views) != 1 || views[0] != want {
+		t.Errorf("latest view = %v, want %s", views, want)
+	}
+}
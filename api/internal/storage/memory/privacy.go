@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"recommendation-engine/api/internal/models"
+)
+
+func (s *Store) ExportUser(ctx context.Context, userID string) (*models.UserExport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	export := &models.UserExport{}
+	if user, exists := s.users[userID]; exists {
+		export.User = &user
+	}
+	if a, exists := s.assignments[userID]; exists {
+		export.Assignment = &a
+	}
+	for _, e := range s.events {
+		if e.UserID == userID {
+			export.Events = append(export.Events, e)
+		}
+	}
+	for _, q := range s.quarantined {
+		if q.Event.UserID == userID {
+			export.QuarantinedEvents = append(export.QuarantinedEvents, q)
+		}
+	}
+	for _, imp := range s.served {
+		if imp.UserID == userID {
+			export.Recommendations = append(export.Recommendations, imp)
+		}
+	}
+	sort.Slice(export.Recommendations, func(i, j int) bool {
+		return export.Recommendations[i].ServedAt.Before(export.Recommendations[j].ServedAt)
+	})
+	return export, nil
+}
+
+// EraseUser mirrors the table-by-table erasure of the SQL stores.
+func (s *Store) EraseUser(ctx context.Context, userID, pseudonym string) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := make(map[string]int64)
+	for i := range s.events {
+		if s.events[i].UserID == userID {
+			s.events[i].UserID = pseudonym
+			removed["user_events"]++
+		}
+	}
+	if views, exists := s.views[userID]; exists {
+		for i := range views {
+			views[i].UserID = pseudonym
+		}
+		s.views[pseudonym] = views
+		delete(s.views, userID)
+	}
+	if removed["user_events"] > 0 {
+		pseudonymous := s.users[userID]
+		pseudonymous.ID = pseudonym
+		s.users[pseudonym] = pseudonymous
+	}
+
+	kept := s.quarantined[:0]
+	for _, q := range s.quarantined {
+		if q.Event.UserID == userID {
+			removed["quarantined_events"]++
+			continue
+		}
+		kept = append(kept, q)
+	}
+	s.quarantined = kept
+
+	for requestID, imp := range s.served {
+		if imp.UserID == userID {
+			delete(s.served, requestID)
+			removed["recommendations_served"]++
+		}
+	}
+	if _, exists := s.assignments[userID]; exists {
+		delete(s.assignments, userID)
+		removed["ab_test_assignments"]++
+	}
+	for key, users := range s.rollupUsers {
+		if users[userID] {
+			delete(users, userID)
+			if key.category {
+				removed["category_rollup_users"]++
+			} else {
+				removed["item_rollup_users"]++
+			}
+		}
+	}
+	if _, exists := s.users[userID]; exists {
+		delete(s.users, userID)
+		removed["users"]++
+	}
+	return removed, nil
+}
+
+func (s *Store) LogErasure(ctx context.Context, rec models.ErasureRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec.ID = int64(len(s.erasures) + 1)
+	s.erasures = append(s.erasures, rec)
+	return nil
+}
+
+func (s *Store) Erasures(ctx context.Context, subjectHash string, limit int) ([]models.ErasureRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []models.ErasureRecord
+	for i := len(s.erasures) - 1; i >= 0 && len(records) < limit; i-- {
+		if subjectHash == "" || s.erasures[i].SubjectHash == subjectHash {
+			records = append(records, s.erasures[i])
+		}
+	}
+	return records, nil
+}
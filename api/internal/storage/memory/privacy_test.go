@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestEraseUser(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	if err := s.UpsertItems(ctx, []models.ContentItem{{ID: "item_tech_1", Title: "Chips", Category: "tech"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range []string{"u1", "u2"} {
+		if err := s.UpsertUser(ctx, models.User{ID: userID}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.LogUserEvent(ctx, models.UserEvent{UserID: userID, ItemID: "item_tech_1", EventType: "view", Timestamp: testStart}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SaveAssignment(ctx, models.Assignment{UserID: userID, Experiment: "x", Variant: "control"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.LogRecommendationsServed(ctx, models.Impression{RequestID: "req_" + userID, UserID: userID, ServedAt: testStart}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := s.EraseUser(ctx, "u1", "erased_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"users", "user_events", "ab_test_assignments", "recommendations_served"} {
+		if removed[table] != 1 {
+			t.Errorf("removed[%s] = %d, want 1", table, removed[table])
+		}
+	}
+
+	export, err := s.ExportUser(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !export.Empty() {
+		t.Errorf("export after erasure = %+v, want empty", export)
+	}
+	// The events stay under the pseudonym, and other users are untouched
+	if pseudonymous, _ := s.ExportUser(ctx, "erased_1"); len(pseudonymous.Events) != 1 {
+		t.Errorf("pseudonymous events = %d, want 1", len(pseudonymous.Events))
+	}
+	if other, _ := s.ExportUser(ctx, "u2"); other.User == nil || len(other.Events) != 1 || other.Assignment == nil || len(other.Recommendations) != 1 {
+		t.Errorf("u2 export = %+v, want their user, event, assignment and served list", other)
+	}
+}
+
+func TestErasuresFilterBySubject(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	for _, hash := range []string{"a", "b", "a"} {
+		if err := s.LogErasure(ctx, models.ErasureRecord{SubjectHash: hash}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		subject string
+		limit   int
+		wantIDs []int64
+	}{
+		{"", 10, []int64{3, 2, 1}},
+		{"a", 10, []int64{3, 1}},
+		{"a", 1, []int64{3}},
+		{"c", 10, nil},
+	}
+	for _, tt := range tests {
+		records, err := s.Erasures(ctx, tt.subject, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, rec := range records {
+			ids = append(ids, rec.ID)
+		}
+		if len(ids) != len(tt.wantIDs) {
+			t.Errorf("Erasures(%q, %d) = %v, want %v", tt.subject, tt.limit, ids, tt.wantIDs)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tt.wantIDs[i] {
+				t.Errorf("Erasures(%q, %d) = %v, want %v", tt.subject, tt.limit, ids, tt.wantIDs)
+				break
+			}
+		}
+	}
+}
+
+func TestEraseUserMovesViews(t *testing.T) {
+	ctx := context.Background()
+	s := newStoreWithItems(t, 1)
+	logEvent(t, s, "u1", "item_0", "view", testStart)
+	if _, err := s.EraseUser(ctx, "u1", "erased_1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if views, _ := s.GetUserRecentViews(ctx, "u1", 10); len(views) != 0 {
+		t.Errorf("u1 views after erasure = %v, want none", views)
+	}
+	if views, _ := s.GetUserRecentViews(ctx, "erased_1", 10); len(views) != 1 {
+		t.Errorf("pseudonymous views = %v, want [item_0]", views)
+	}
+}
@@ -0,0 +1,238 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/timeout"
+)
+
+// ExportUser reads every row that references userID.
+func (db *DB) ExportUser(ctx context.Context, userID string) (_ *models.UserExport, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBScan)
+	defer done(&err)
+
+	export := &models.UserExport{}
+
+	var user models.User
+	err = db.QueryRowContext(ctx, `SELECT id, created_at, last_active FROM users WHERE id = $1`, userID).
+		Scan(&user.ID, &user.CreatedAt, &user.LastActive)
+	if err == nil {
+		export.User = &user
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var a models.Assignment
+	err = db.QueryRowContext(ctx, `
+		SELECT user_id, experiment_name, variant, assigned_at FROM ab_test_assignments WHERE user_id = $1
+	`, userID).Scan(&a.UserID, &a.Experiment, &a.Variant, &a.AssignedAt)
+	if err == nil {
+		export.Assignment = &a
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT `+eventColumns+` FROM user_events WHERE user_id = $1 ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		export.Events = append(export.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if export.QuarantinedEvents, err = db.exportQuarantined(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Recommendations, err = db.exportServed(ctx, userID); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+func (db *DB) exportQuarantined(ctx context.Context, userID string) ([]models.QuarantinedEvent, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT user_id, item_id, event_type, duration_seconds, event_time, received_at,
+			COALESCE(request_id, ''), COALESCE(user_agent, ''), reasons, created_at
+		FROM quarantined_events
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var quarantined []models.QuarantinedEvent
+	for rows.Next() {
+		var q models.QuarantinedEvent
+		var duration sql.NullInt32
+		var reasons string
+		if err := rows.Scan(&q.Event.UserID, &q.Event.ItemID, &q.Event.EventType, &duration, &q.Event.Timestamp,
+			&q.Event.ReceivedAt, &q.Event.RequestID, &q.UserAgent, &reasons, &q.QuarantinedAt); err != nil {
+			return nil, err
+		}
+		if duration.Valid {
+			d := int(duration.Int32)
+			q.Event.Duration = &d
+		}
+		if err := json.Unmarshal([]byte(reasons), &q.Reasons); err != nil {
+			return nil, err
+		}
+		quarantined = append(quarantined, q)
+	}
+	return quarantined, rows.Err()
+}
+
+func (db *DB) exportServed(ctx context.Context, userID string) ([]models.Impression, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT COALESCE(request_id, ''), user_id, recommended_items, strategy,
+			COALESCE(experiment_name, ''), COALESCE(ab_test_variant, ''), created_at
+		FROM recommendations_served
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var served []models.Impression
+	for rows.Next() {
+		var imp models.Impression
+		var items string
+		if err := rows.Scan(&imp.RequestID, &imp.UserID, &items, &imp.Strategy,
+			&imp.Experiment, &imp.Variant, &imp.ServedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(items), &imp.Items); err != nil {
+			return nil, err
+		}
+		served = append(served, imp)
+	}
+	return served, rows.Err()
+}
+
+// erasureSteps are run in order by EraseUser. Events are moved to the
+// pseudonym before the user row they reference is deleted.
+var erasureSteps = []struct {
+	table string
+	query string
+}{
+	{"user_events", `UPDATE user_events SET user_id = $2 WHERE user_id = $1`},
+	{"quarantined_events", `DELETE FROM quarantined_events WHERE user_id = $1`},
+	{"recommendations_served", `DELETE FROM recommendations_served WHERE user_id = $1`},
+	{"ab_test_assignments", `DELETE FROM ab_test_assignments WHERE user_id = $1`},
+	{"item_rollup_users", `DELETE FROM item_rollup_users WHERE user_id = $1`},
+	{"category_rollup_users", `DELETE FROM category_rollup_users WHERE user_id = $1`},
+	{"users", `DELETE FROM users WHERE id = $1`},
+}
+
+func (db *DB) EraseUser(ctx context.Context, userID, pseudonym string) (_ map[string]int64, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBBatch)
+	defer done(&err)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// user_events.user_id references users(id)
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO users (id, created_at, last_active) VALUES ($1, $2, $2)`,
+		pseudonym, now); err != nil {
+		return nil, err
+	}
+
+	removed := make(map[string]int64, len(erasureSteps))
+	for _, step := range erasureSteps {
+		args := []interface{}{userID}
+		if step.table == "user_events" {
+			args = append(args, pseudonym)
+		}
+		result, err := tx.ExecContext(ctx, step.query, args...)
+		if err != nil {
+			return nil, err
+		}
+		if removed[step.table], err = result.RowsAffected(); err != nil {
+			return nil, err
+		}
+	}
+	if removed["user_events"] == 0 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, pseudonym); err != nil {
+			return nil, err
+		}
+	}
+	return removed, tx.Commit()
+}
+
+func (db *DB) LogErasure(ctx context.Context, rec models.ErasureRecord) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	removed, err := jsonText(rec.Removed)
+	if err != nil {
+		return err
+	}
+	var errs sql.NullString
+	if len(rec.Errors) > 0 {
+		if errs, err = jsonText(rec.Errors); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO erasure_audit (subject_hash, requested_by, status, removed, errors, requested_at, completed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, rec.SubjectHash, nullString(rec.RequestedBy), rec.Status, removed, errs, rec.RequestedAt.UTC(), rec.CompletedAt.UTC())
+	return err
+}
+
+func (db *DB) Erasures(ctx context.Context, subjectHash string, limit int) (_ []models.ErasureRecord, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, subject_hash, COALESCE(requested_by, ''), status, removed, COALESCE(errors, ''), requested_at, completed_at
+		FROM erasure_audit
+		WHERE $1 = '' OR subject_hash = $1
+		ORDER BY requested_at DESC, id DESC
+		LIMIT $2
+	`, subjectHash, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.ErasureRecord
+	for rows.Next() {
+		var rec models.ErasureRecord
+		var removed, errs string
+		if err := rows.Scan(&rec.ID, &rec.SubjectHash, &rec.RequestedBy, &rec.Status, &removed, &errs,
+			&rec.RequestedAt, &rec.CompletedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(removed), &rec.Removed); err != nil {
+			return nil, err
+		}
+		if errs != "" {
+			if err := json.Unmarshal([]byte(errs), &rec.Errors); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,275 @@
+// Package sqlite implements the storage contracts on an embedded SQLite
+// database, for single-node deployments that do not run Postgres.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	driver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
+	"recommendation-engine/api/internal/timeout"
+)
+
+var _ storage.Store = (*DB)(nil)
+
+// recentViewsWindow bounds how far back GetUserRecentViews looks, as in
+// the Postgres store.
+const recentViewsWindow = 30 * 24 * time.Hour
+
+// DB is a storage.Store backed by a SQLite file. Times are written as UTC
+// text so they compare in time order.
+type DB struct {
+	*sql.DB
+	ops *timeout.Tracker
+}
+
+// Open opens or creates the database at path. Foreign keys are enforced,
+// the journal is WAL so reads do not block the writer, and transactions
+// take the write lock up front so they never fail upgrading it.
+func Open(path string) (*DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_time_format", "sqlite")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// SQLite has a single writer; extra connections only serve reads
+	db.SetMaxOpenConns(8)
+	db.SetMaxIdleConns(8)
+
+	log.Printf("✅ Opened SQLite database %s", path)
+	return &DB{DB: db, ops: timeout.NewTracker(timeout.DefaultConfig())}, nil
+}
+
+// SetTimeouts replaces the tracker that bounds and counts queries.
+func (db *DB) SetTimeouts(ops *timeout.Tracker) {
+	db.ops = ops
+}
+
+func (db *DB) LogUserEvent(ctx context.Context, e models.UserEvent) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	var flags sql.NullString
+	if len(e.Flags) > 0 {
+		if flags, err = jsonText(e.Flags); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO users (id, created_at, last_active) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING
+	`, e.UserID, now, e.Timestamp.UTC()); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO user_events (user_id, item_id, event_type, duration_seconds, request_id, event_time, quality_flags, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err = db.ExecContext(ctx, query, e.UserID, e.ItemID, e.EventType, e.Duration, nullString(e.RequestID),
+		e.Timestamp.UTC(), flags, now)
+	// The user was just created, so a foreign key failure is the item
+	if isForeignKeyViolation(err) {
+		return storage.ErrUnknownItem
+	}
+	return err
+}
+
+func (db *DB) LogQuarantinedEvent(ctx context.Context, e models.UserEvent, userAgent string, reasons []string) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	reasonsJSON, err := json.Marshal(reasons)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO quarantined_events
+			(user_id, item_id, event_type, duration_seconds, event_time, received_at, request_id, user_agent, reasons, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err = db.ExecContext(ctx, query, e.UserID, e.ItemID, e.EventType, e.Duration, e.Timestamp.UTC(), e.ReceivedAt.UTC(),
+		nullString(e.RequestID), nullString(userAgent), string(reasonsJSON), time.Now().UTC())
+	return err
+}
+
+func (db *DB) LogRecommendationsServed(ctx context.Context, imp models.Impression) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	items, err := json.Marshal(imp.Items)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO users (id, created_at, last_active) VALUES ($1, $2, $2) ON CONFLICT (id) DO NOTHING
+	`, imp.UserID, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO recommendations_served
+			(request_id, user_id, recommended_items, strategy, experiment_name, ab_test_variant, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err = db.ExecContext(ctx, query, imp.RequestID, imp.UserID, string(items), imp.Strategy,
+		nullString(imp.Experiment), nullString(imp.Variant), imp.ServedAt.UTC())
+	return err
+}
+
+func (db *DB) GetRecommendationsServed(ctx context.Context, requestID string) (_ *models.Impression, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	query := `
+		SELECT request_id, user_id, recommended_items, strategy,
+			COALESCE(experiment_name, ''), COALESCE(ab_test_variant, ''), created_at
+		FROM recommendations_served
+		WHERE request_id = $1
+	`
+	var imp models.Impression
+	var items string
+	err = db.QueryRowContext(ctx, query, requestID).Scan(&imp.RequestID, &imp.UserID, &items, &imp.Strategy,
+		&imp.Experiment, &imp.Variant, &imp.ServedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(items), &imp.Items); err != nil {
+		return nil, err
+	}
+	return &imp, nil
+}
+
+func (db *DB) GetUserRecentViews(ctx context.Context, userID string, limit int) (_ []string, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	query := `
+		SELECT item_id FROM user_events
+		WHERE user_id = $1 AND event_type = 'view' AND event_time >= $3
+		ORDER BY event_time DESC
+		LIMIT $2
+	`
+	rows, err := db.QueryContext(ctx, query, userID, limit, time.Now().UTC().Add(-recentViewsWindow))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []string
+	for rows.Next() {
+		var itemID string
+		if err := rows.Scan(&itemID); err != nil {
+			return nil, err
+		}
+		items = append(items, itemID)
+	}
+	return items, rows.Err()
+}
+
+// ForEachUserEvent streams events whose event time falls in [from, to) in
+// the order they were received. A zero bound is open.
+func (db *DB) ForEachUserEvent(ctx context.Context, from, to time.Time, fn func(models.UserEvent) error) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBScan)
+	defer done(&err)
+
+	query := `SELECT ` + eventColumns + ` FROM user_events WHERE TRUE`
+	var args []interface{}
+	if !from.IsZero() {
+		args = append(args, from.UTC())
+		query += fmt.Sprintf(` AND event_time >= $%d`, len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to.UTC())
+		query += fmt.Sprintf(` AND event_time < $%d`, len(args))
+	}
+	query += ` ORDER BY created_at, id`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+const eventColumns = `user_id, item_id, event_type, duration_seconds, event_time, created_at,
+	COALESCE(request_id, ''), COALESCE(quality_flags, '')`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEvent(row scanner) (models.UserEvent, error) {
+	var e models.UserEvent
+	var duration sql.NullInt32
+	var flags string
+	if err := row.Scan(&e.UserID, &e.ItemID, &e.EventType, &duration, &e.Timestamp, &e.ReceivedAt, &e.RequestID, &flags); err != nil {
+		return e, err
+	}
+	if duration.Valid {
+		d := int(duration.Int32)
+		e.Duration = &d
+	}
+	if flags != "" {
+		if err := json.Unmarshal([]byte(flags), &e.Flags); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+func isForeignKeyViolation(err error) bool {
+	var sqliteErr *driver.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// jsonText encodes v for a JSON TEXT column.
+func jsonText(v interface{}) (sql.NullString, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
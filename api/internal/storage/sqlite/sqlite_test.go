@@ -0,0 +1,172 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"recommendation-engine/api/internal/migrate"
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/storage"
+)
+
+// openTestDB opens a migrated database in a temporary directory.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := migrate.Load(filepath.Join("..", "..", "..", "..", "data", "migrations", "sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrate.NewSQLite(db.DB, migrations).Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	items := []models.ContentItem{
+		{ID: "item_tech_1", Title: "Chips", Category: "tech"},
+		{ID: "item_tech_2", Title: "Compilers", Category: "tech"},
+		{ID: "article_42", Title: "Markets", Category: "business"},
+	}
+	if err := db.UpsertItems(context.Background(), items); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func logEvent(t *testing.T, db *DB, userID, itemID, eventType string, at time.Time) {
+	t.Helper()
+	e := models.UserEvent{UserID: userID, ItemID: itemID, EventType: eventType, Timestamp: at, ReceivedAt: at}
+	if err := db.LogUserEvent(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogUserEventUnknownItem(t *testing.T) {
+	db := openTestDB(t)
+	e := models.UserEvent{UserID: "u1", ItemID: "item_missing", EventType: "view", Timestamp: time.Now()}
+	if err := db.LogUserEvent(context.Background(), e); !errors.Is(err, storage.ErrUnknownItem) {
+		t.Errorf("err = %v, want ErrUnknownItem", err)
+	}
+}
+
+func TestGetUserRecentViews(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	now := time.Now().UTC()
+	logEvent(t, db, "u1", "item_tech_1", "view", now.Add(-2*time.Hour))
+	logEvent(t, db, "u1", "article_42", "click", now.Add(-time.Hour))
+	logEvent(t, db, "u1", "item_tech_2", "view", now.Add(-time.Minute))
+	logEvent(t, db, "u2", "article_42", "view", now)
+	// Views older than the window are ignored
+	logEvent(t, db, "u1", "article_42", "view", now.Add(-recentViewsWindow-time.Hour))
+
+	views, err := db.GetUserRecentViews(ctx, "u1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"item_tech_2", "item_tech_1"}; !reflect.DeepEqual(views, want) {
+		t.Errorf("views = %v, want %v", views, want)
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	if a, err := db.GetAssignment(ctx, "u1"); err != nil || a != nil {
+		t.Fatalf("assignment before saving = %+v, %v, want none", a, err)
+	}
+
+	saved := models.Assignment{UserID: "u1", Experiment: "exp", Variant: "treatment"}
+	if err := db.SaveAssignment(ctx, saved); err != nil {
+		t.Fatal(err)
+	}
+	a, err := db.GetAssignment(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The store stamps assigned_at, as the Postgres store does
+	if a == nil || a.Experiment != saved.Experiment || a.Variant != saved.Variant || a.AssignedAt.IsZero() {
+		t.Errorf("assignment = %+v, want %+v with its assignment time", a, saved)
+	}
+}
+
+func TestApplyRollups(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	hour := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	deltas := []models.RollupDelta{
+		{ItemID: "item_tech_1", Hour: hour, Counts: models.RollupCounts{Impressions: 2, Clicks: 1}, Users: []string{"u1", "u2"}},
+		{ItemID: "article_42", Hour: hour, Counts: models.RollupCounts{Impressions: 1}, Users: []string{"u1"}},
+	}
+	if err := db.ApplyRollups(ctx, deltas); err != nil {
+		t.Fatal(err)
+	}
+	// A user already counted for the hour does not add to unique_users
+	repeat := []models.RollupDelta{{ItemID: "item_tech_1", Hour: hour, Counts: models.RollupCounts{Impressions: 1}, Users: []string{"u1"}}}
+	if err := db.ApplyRollups(ctx, repeat); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := hour.Add(-time.Hour), hour.Add(time.Hour)
+	hourly, err := db.HourlyItemRollups(ctx, "item_tech_1", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.RollupCounts{Impressions: 3, Clicks: 1, UniqueUsers: 2}
+	if len(hourly) != 1 || !hourly[0].Hour.Equal(hour) || hourly[0].RollupCounts != want {
+		t.Errorf("hourly rollups = %+v, want one hour with %+v", hourly, want)
+	}
+
+	categories, err := db.CategoryRollups(ctx, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int64)
+	for _, r := range categories {
+		got[r.Key] = r.Impressions
+	}
+	// Items are rolled up under their catalog category
+	if want := map[string]int64{"tech": 3, "business": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("category impressions = %v, want %v", got, want)
+	}
+}
+
+func TestEraseUser(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	now := time.Now().UTC()
+	logEvent(t, db, "u1", "item_tech_1", "view", now)
+	logEvent(t, db, "u2", "item_tech_1", "view", now)
+	if err := db.SaveAssignment(ctx, models.Assignment{UserID: "u1", Experiment: "exp", Variant: "control", AssignedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := db.EraseUser(ctx, "u1", "erased_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed["user_events"] != 1 || removed["ab_test_assignments"] != 1 {
+		t.Errorf("removed = %v, want one event and one assignment", removed)
+	}
+	export, err := db.ExportUser(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !export.Empty() {
+		t.Errorf("export after erasure = %+v, want empty", export)
+	}
+	if views, _ := db.GetUserRecentViews(ctx, "erased_1", 10); len(views) != 1 {
+		t.Errorf("pseudonymous views = %v, want the erased user's view", views)
+	}
+	if views, _ := db.GetUserRecentViews(ctx, "u2", 10); len(views) != 1 {
+		t.Errorf("u2 views = %v, want 1", views)
+	}
+}
@@ -0,0 +1,143 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"recommendation-engine/api/internal/models"
+	"recommendation-engine/api/internal/timeout"
+)
+
+func (db *DB) GetUser(ctx context.Context, id string) (_ *models.User, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	var user models.User
+	err = db.QueryRowContext(ctx, `SELECT id, created_at, last_active FROM users WHERE id = $1`, id).
+		Scan(&user.ID, &user.CreatedAt, &user.LastActive)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (db *DB) UpsertUser(ctx context.Context, user models.User) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	now := time.Now().UTC()
+	lastActive := user.LastActive.UTC()
+	if user.LastActive.IsZero() {
+		lastActive = now
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO users (id, created_at, last_active) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET last_active = excluded.last_active
+	`, user.ID, now, lastActive)
+	return err
+}
+
+// TouchUsers writes a batch of last_active times in one transaction.
+func (db *DB) TouchUsers(ctx context.Context, lastActive map[string]time.Time) (err error) {
+	if len(lastActive) == 0 {
+		return nil
+	}
+	ctx, done := db.ops.Start(ctx, timeout.DBBatch)
+	defer done(&err)
+
+	ids := make([]string, 0, len(lastActive))
+	for id := range lastActive {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO users (id, created_at, last_active) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET last_active = MAX(users.last_active, excluded.last_active)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, id := range ids {
+		if _, err := stmt.ExecContext(ctx, id, now, lastActive[id].UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *DB) RecentlyActiveUsers(ctx context.Context, since time.Time, limit int) (_ []string, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	query := `
+		SELECT id FROM users
+		WHERE last_active >= $1
+		ORDER BY last_active DESC
+		LIMIT $2
+	`
+	rows, err := db.QueryContext(ctx, query, since.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (db *DB) GetAssignment(ctx context.Context, userID string) (_ *models.Assignment, err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+	defer done(&err)
+
+	query := `
+		SELECT user_id, experiment_name, variant, assigned_at
+		FROM ab_test_assignments
+		WHERE user_id = $1
+	`
+	var a models.Assignment
+	err = db.QueryRowContext(ctx, query, userID).Scan(&a.UserID, &a.Experiment, &a.Variant, &a.AssignedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// SaveAssignment stores a user's variant, replacing any earlier
+// assignment.
+func (db *DB) SaveAssignment(ctx context.Context, a models.Assignment) (err error) {
+	ctx, done := db.ops.Start(ctx, timeout.DBWrite)
+	defer done(&err)
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO ab_test_assignments (user_id, experiment_name, variant, assigned_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET
+			experiment_name = excluded.experiment_name,
+			variant = excluded.variant,
+			assigned_at = excluded.assigned_at
+	`, a.UserID, a.Experiment, a.Variant, time.Now().UTC())
+	return err
+}
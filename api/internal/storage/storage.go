@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"recommendation-engine/api/internal/events"
+	"recommendation-engine/api/internal/models"
+)
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrUnknownItem is returned when an event references an item that is
+	// not in the catalog.
+	ErrUnknownItem = errors.New("unknown item")
+)
+
+// Storage contracts used by the services. database.DB implements them on
+// Postgres and memory.Store in process, so the recommender can run without
+// external services. Every call takes the caller's context so a cancelled
+// request stops waiting on storage.
+
+type UserStore interface {
+	// GetUser returns nil if the user does not exist.
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	UpsertUser(ctx context.Context, user models.User) error
+	// TouchUsers creates missing users and moves last_active forward to the
+	// given times. It never moves last_active back.
+	TouchUsers(ctx context.Context, lastActive map[string]time.Time) error
+	// RecentlyActiveUsers returns up to limit users active since the given
+	// time, most recent first.
+	RecentlyActiveUsers(ctx context.Context, since time.Time, limit int) ([]string, error)
+}
+
+// ItemStore is the content catalog. Deleted items are soft-deleted: they
+// are hidden from GetItem and ListItems but keep their row.
+type ItemStore interface {
+	// GetItem returns nil if the item does not exist or was deleted.
+	GetItem(ctx context.Context, id string) (*models.ContentItem, error)
+	// ListItems returns the newest items, optionally limited to a category.
+	ListItems(ctx context.Context, category string, limit int) ([]models.ContentItem, error)
+	// CreateItem fails with ErrAlreadyExists if a live item has the same ID.
+	// A deleted item with that ID is restored.
+	CreateItem(ctx context.Context, item models.ContentItem) error
+	// UpdateItem fails with ErrNotFound if the item does not exist.
+	UpdateItem(ctx context.Context, item models.ContentItem) error
+	// UpsertItems creates or replaces items, restoring deleted ones.
+	UpsertItems(ctx context.Context, items []models.ContentItem) error
+	// DeleteItem fails with ErrNotFound if the item does not exist.
+	DeleteItem(ctx context.Context, id string) error
+	// EnsureItems creates the items that do not exist yet and leaves the
+	// rest, including deleted ones, untouched.
+	EnsureItems(ctx context.Context, items []models.ContentItem) error
+}
+
+type EventStore interface {
+	// LogUserEvent creates the user if needed. It fails with ErrUnknownItem
+	// if the item does not exist.
+	LogUserEvent(ctx context.Context, e models.UserEvent) error
+	GetUserRecentViews(ctx context.Context, userID string, limit int) ([]string, error)
+	// ForEachUserEvent streams events whose event time falls in [from, to)
+	// in the order they were received. A zero bound is open.
+	ForEachUserEvent(ctx context.Context, from, to time.Time, fn func(models.UserEvent) error) error
+	LogQuarantinedEvent(ctx context.Context, e models.UserEvent, userAgent string, reasons []string) error
+}
+
+type AssignmentStore interface {
+	// GetAssignment returns nil if the user has no assignment.
+	GetAssignment(ctx context.Context, userID string) (*models.Assignment, error)
+	SaveAssignment(ctx context.Context, a models.Assignment) error
+}
+
+type ImpressionStore interface {
+	LogRecommendationsServed(ctx context.Context, imp models.Impression) error
+	// GetRecommendationsServed returns nil if no list was logged under
+	// requestID.
+	GetRecommendationsServed(ctx context.Context, requestID string) (*models.Impression, error)
+}
+
+// RollupStore keeps hourly engagement counters per item and per category.
+// An item's category is its catalog category, or the prefix of its ID for
+// items not in the catalog.
+type RollupStore interface {
+	// ApplyRollups adds item deltas and the category deltas derived from
+	// them in one transaction.
+	ApplyRollups(ctx context.Context, deltas []models.RollupDelta) error
+	// ItemRollups sums item counters over hours in [from, to), with each
+	// item's title and category.
+	ItemRollups(ctx context.Context, from, to time.Time) ([]models.Rollup, error)
+	// CategoryRollups sums category counters over hours in [from, to).
+	CategoryRollups(ctx context.Context, from, to time.Time) ([]models.Rollup, error)
+	// HourlyItemRollups returns one rollup per active hour of itemID in
+	// [from, to), oldest first.
+	HourlyItemRollups(ctx context.Context, itemID string, from, to time.Time) ([]models.Rollup, error)
+	// PruneRollupUsers forgets which users were counted for hours before
+	// before. Late events for those hours can no longer add unique users.
+	PruneRollupUsers(ctx context.Context, before time.Time) error
+}
+
+// PrivacyStore serves data access and erasure requests.
+type PrivacyStore interface {
+	// ExportUser returns everything stored about userID. The export is
+	// empty, not nil, if nothing is stored.
+	ExportUser(ctx context.Context, userID string) (*models.UserExport, error)
+	// EraseUser deletes the user with their assignment, served lists,
+	// quarantined events and rollup seen-user entries, and moves their
+	// events to pseudonym so aggregates are unchanged. It runs in one
+	// transaction and returns the rows affected per table.
+	EraseUser(ctx context.Context, userID, pseudonym string) (map[string]int64, error)
+	LogErasure(ctx context.Context, rec models.ErasureRecord) error
+	// Erasures returns audit records, newest first, optionally limited to
+	// one subject hash.
+	Erasures(ctx context.Context, subjectHash string, limit int) ([]models.ErasureRecord, error)
+}
+
+// CategoryOf is the category an item's rollups are filed under: its
+// catalog category if it has one, otherwise the prefix of its ID.
+func CategoryOf(itemID, catalogCategory string) string {
+	if catalogCategory != "" {
+		return catalogCategory
+	}
+	if category := events.Category(itemID); category != "" {
+		return category
+	}
+	return "uncategorized"
+}
+
+// Store is the full set of storage contracts.
+type Store interface {
+	UserStore
+	ItemStore
+	EventStore
+	AssignmentStore
+	ImpressionStore
+	RollupStore
+	PrivacyStore
+}
@@ -0,0 +1,152 @@
+package timeout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Op is a class of dependency call with its own timeout.
+type Op string
+
+const (
+	DBRead  Op = "db_read"
+	DBWrite Op = "db_write"
+	// DBBatch covers multi-row writes such as bulk upserts.
+	DBBatch Op = "db_batch"
+	// DBScan covers full-table streams like replay, which are unbounded by
+	// default.
+	DBScan     Op = "db_scan"
+	CacheRead  Op = "cache_read"
+	CacheWrite Op = "cache_write"
+)
+
+// Config maps each Op to its timeout. Zero means no timeout.
+type Config map[Op]time.Duration
+
+func DefaultConfig() Config {
+	return Config{
+		DBRead:     2 * time.Second,
+		DBWrite:    3 * time.Second,
+		DBBatch:    30 * time.Second,
+		DBScan:     0,
+		CacheRead:  100 * time.Millisecond,
+		CacheWrite: 250 * time.Millisecond,
+	}
+}
+
+// ConfigFromEnv returns DefaultConfig overridden by DB_READ_TIMEOUT,
+// DB_WRITE_TIMEOUT, DB_BATCH_TIMEOUT, DB_SCAN_TIMEOUT, CACHE_READ_TIMEOUT
+// and CACHE_WRITE_TIMEOUT (Go duration strings).
+func ConfigFromEnv() (Config, error) {
+	c := DefaultConfig()
+	for key, op := range map[string]Op{
+		"DB_READ_TIMEOUT":     DBRead,
+		"DB_WRITE_TIMEOUT":    DBWrite,
+		"DB_BATCH_TIMEOUT":    DBBatch,
+		"DB_SCAN_TIMEOUT":     DBScan,
+		"CACHE_READ_TIMEOUT":  CacheRead,
+		"CACHE_WRITE_TIMEOUT": CacheWrite,
+	} {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return c, fmt.Errorf("%s: %w", key, err)
+		}
+		c[op] = d
+	}
+	return c, nil
+}
+
+// Counts tallies the outcomes of one Op. Timeouts and cancellations (the
+// caller went away) are not counted as errors.
+type Counts struct {
+	Calls    int64 `json:"calls"`
+	Errors   int64 `json:"errors"`
+	Timeouts int64 `json:"timeouts"`
+	Canceled int64 `json:"canceled"`
+}
+
+// Tracker applies per-Op timeouts and counts outcomes.
+type Tracker struct {
+	config Config
+	mu     sync.Mutex
+	counts map[Op]*Counts
+}
+
+func NewTracker(config Config) *Tracker {
+	return &Tracker{config: config, counts: make(map[Op]*Counts)}
+}
+
+// Start bounds ctx by op's timeout. The returned func must be deferred
+// with a pointer to the call's final error: it releases the context,
+// counts the outcome and, if the deadline or cancellation caused the
+// error, wraps it so errors.Is matches context.DeadlineExceeded or
+// context.Canceled whatever the driver returned.
+//
+//	ctx, done := db.ops.Start(ctx, timeout.DBRead)
+//	defer done(&err)
+func (t *Tracker) Start(ctx context.Context, op Op) (context.Context, func(*error)) {
+	cancel := context.CancelFunc(func() {})
+	if d := t.config[op]; d > 0 {
+		ctx, cancel = context.WithTimeout(ctx, d)
+	}
+	return ctx, func(errp *error) {
+		defer cancel()
+
+		var err error
+		if errp != nil {
+			err = *errp
+		}
+		if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+			err = fmt.Errorf("%w: %v", ctx.Err(), err)
+			*errp = err
+		}
+		t.record(op, err)
+	}
+}
+
+func (t *Tracker) record(op Op, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, exists := t.counts[op]
+	if !exists {
+		c = &Counts{}
+		t.counts[op] = c
+	}
+	c.Calls++
+	switch {
+	case err == nil:
+	case errors.Is(err, context.DeadlineExceeded):
+		c.Timeouts++
+	case errors.Is(err, context.Canceled):
+		c.Canceled++
+	default:
+		c.Errors++
+	}
+}
+
+// Stats returns a copy of the counts for every Op seen so far.
+func (t *Tracker) Stats() map[Op]Counts {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make(map[Op]Counts, len(t.counts))
+	for op, c := range t.counts {
+		stats[op] = *c
+	}
+	return stats
+}
+
+// IsCanceled reports whether err came from a timeout or a cancelled
+// request rather than a failing dependency.
+func IsCanceled(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
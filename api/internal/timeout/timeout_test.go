@@ -0,0 +1,90 @@
+package timeout
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// call runs a dependency call that fails with driverErr once ctx is done,
+// as drivers do, or succeeds after work.
+func call(ctx context.Context, tr *Tracker, op Op, work time.Duration, driverErr error) (err error) {
+	ctx, done := tr.Start(ctx, op)
+	defer done(&err)
+
+	select {
+	case <-time.After(work):
+		return nil
+	case <-ctx.Done():
+		return driverErr
+	}
+}
+
+func TestStartClassifiesOutcomes(t *testing.T) {
+	driverErr := errors.New("driver: bad connection")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		limit  time.Duration
+		work   time.Duration
+		is     error
+		counts Counts
+	}{
+		{"success", context.Background(), time.Second, 0, nil, Counts{Calls: 1}},
+		{"timeout", context.Background(), 10 * time.Millisecond, time.Second, context.DeadlineExceeded, Counts{Calls: 1, Timeouts: 1}},
+		{"caller went away", canceled, time.Second, time.Second, context.Canceled, Counts{Calls: 1, Canceled: 1}},
+		{"no limit", context.Background(), 0, 20 * time.Millisecond, nil, Counts{Calls: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTracker(Config{DBRead: tt.limit})
+			err := call(tt.ctx, tr, DBRead, tt.work, driverErr)
+			if tt.is == nil && err != nil {
+				t.Fatalf("err = %v, want nil", err)
+			}
+			if tt.is != nil && (!errors.Is(err, tt.is) || !IsCanceled(err)) {
+				t.Errorf("err = %v, want one matching %v", err, tt.is)
+			}
+			if got := tr.Stats()[DBRead]; got != tt.counts {
+				t.Errorf("counts = %+v, want %+v", got, tt.counts)
+			}
+		})
+	}
+}
+
+func TestStartCountsDependencyErrors(t *testing.T) {
+	tr := NewTracker(DefaultConfig())
+	driverErr := errors.New("driver: bad connection")
+
+	_, done := tr.Start(context.Background(), CacheWrite)
+	err := driverErr
+	done(&err)
+
+	if err != driverErr || IsCanceled(err) {
+		t.Errorf("err = %v, want the driver error unchanged", err)
+	}
+	if got := tr.Stats()[CacheWrite]; got != (Counts{Calls: 1, Errors: 1}) {
+		t.Errorf("counts = %+v, want one error", got)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("DB_READ_TIMEOUT", "750ms")
+	t.Setenv("DB_SCAN_TIMEOUT", "1h")
+	c, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c[DBRead] != 750*time.Millisecond || c[DBScan] != time.Hour || c[DBWrite] != DefaultConfig()[DBWrite] {
+		t.Errorf("config = %v", c)
+	}
+
+	t.Setenv("CACHE_READ_TIMEOUT", "fast")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("invalid CACHE_READ_TIMEOUT was accepted")
+	}
+}
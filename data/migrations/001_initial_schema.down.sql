@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS recommendations_served;
+DROP TABLE IF EXISTS ab_test_assignments;
+DROP TABLE IF EXISTS user_events;
+DROP TABLE IF EXISTS content_items;
+DROP TABLE IF EXISTS users;
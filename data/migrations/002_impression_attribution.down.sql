@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_user_events_request_id;
+DROP INDEX IF EXISTS idx_recommendations_served_request_id;
+
+ALTER TABLE user_events DROP COLUMN IF EXISTS request_id;
+
+ALTER TABLE recommendations_served
+    DROP COLUMN IF EXISTS experiment_name,
+    DROP COLUMN IF EXISTS request_id;
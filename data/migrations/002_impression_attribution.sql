@@ -0,0 +1,9 @@
+-- Request IDs tie served recommendation lists to the events they produce
+ALTER TABLE recommendations_served
+    ADD COLUMN request_id VARCHAR(64),
+    ADD COLUMN experiment_name VARCHAR(255);
+
+ALTER TABLE user_events ADD COLUMN request_id VARCHAR(64);
+
+CREATE UNIQUE INDEX idx_recommendations_served_request_id ON recommendations_served(request_id);
+CREATE INDEX idx_user_events_request_id ON user_events(request_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_user_events_event_time;
+ALTER TABLE user_events DROP COLUMN IF EXISTS event_time;
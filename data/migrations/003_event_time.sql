@@ -0,0 +1,8 @@
+-- Event time as reported by the client; created_at remains the receive time
+ALTER TABLE user_events ADD COLUMN event_time TIMESTAMP;
+UPDATE user_events SET event_time = created_at WHERE event_time IS NULL;
+ALTER TABLE user_events
+    ALTER COLUMN event_time SET DEFAULT CURRENT_TIMESTAMP,
+    ALTER COLUMN event_time SET NOT NULL;
+
+CREATE INDEX idx_user_events_event_time ON user_events(event_time);
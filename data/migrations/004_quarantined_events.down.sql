@@ -0,0 +1,2 @@
+ALTER TABLE user_events DROP COLUMN IF EXISTS quality_flags;
+DROP TABLE IF EXISTS quarantined_events;
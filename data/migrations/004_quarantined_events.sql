@@ -0,0 +1,19 @@
+-- Events held back by the event-quality filter, kept for review
+CREATE TABLE quarantined_events (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    item_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    duration_seconds INTEGER,
+    event_time TIMESTAMP NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    request_id VARCHAR(64),
+    user_agent TEXT,
+    reasons JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE user_events ADD COLUMN quality_flags JSONB;
+
+CREATE INDEX idx_quarantined_events_user_id ON quarantined_events(user_id);
+CREATE INDEX idx_quarantined_events_created_at ON quarantined_events(created_at);
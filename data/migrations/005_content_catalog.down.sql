@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_content_items_category;
+
+ALTER TABLE content_items
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS updated_at;
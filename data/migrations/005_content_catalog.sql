@@ -0,0 +1,8 @@
+-- Catalog maintenance from the Go API: edit tracking and soft deletes
+ALTER TABLE content_items
+    ADD COLUMN updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN deleted_at TIMESTAMP;
+
+UPDATE content_items SET updated_at = created_at;
+
+CREATE INDEX idx_content_items_category ON content_items(category) WHERE deleted_at IS NULL;
@@ -0,0 +1,30 @@
+ALTER TABLE user_events RENAME TO user_events_partitioned;
+ALTER INDEX user_events_pkey RENAME TO user_events_partitioned_pkey;
+ALTER SEQUENCE user_events_id_seq OWNED BY NONE;
+
+CREATE TABLE user_events (
+    id INTEGER PRIMARY KEY DEFAULT nextval('user_events_id_seq'),
+    user_id VARCHAR(255) CONSTRAINT user_events_user_id_fkey REFERENCES users(id),
+    item_id VARCHAR(255) CONSTRAINT user_events_item_id_fkey REFERENCES content_items(id),
+    event_type VARCHAR(50) NOT NULL,
+    duration_seconds INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    request_id VARCHAR(64),
+    event_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    quality_flags JSONB
+);
+
+INSERT INTO user_events
+    (id, user_id, item_id, event_type, duration_seconds, created_at, request_id, event_time, quality_flags)
+SELECT id, user_id, item_id, event_type, duration_seconds, created_at, request_id, event_time, quality_flags
+FROM user_events_partitioned;
+
+-- Dropping the partitioned table drops its partitions and indexes
+DROP TABLE user_events_partitioned;
+ALTER SEQUENCE user_events_id_seq OWNED BY user_events.id;
+
+CREATE INDEX idx_user_events_user_id ON user_events(user_id);
+CREATE INDEX idx_user_events_item_id ON user_events(item_id);
+CREATE INDEX idx_user_events_created_at ON user_events(created_at);
+CREATE INDEX idx_user_events_request_id ON user_events(request_id);
+CREATE INDEX idx_user_events_event_time ON user_events(event_time);
@@ -0,0 +1,57 @@
+-- Range-partition user_events on event_time. The API creates partitions
+-- ahead of time and archives or drops old ones (EVENT_PARTITION_INTERVAL,
+-- EVENT_RETENTION_DAYS). Rows outside every partition land in
+-- user_events_default until a partition covering them is created.
+ALTER TABLE user_events RENAME TO user_events_unpartitioned;
+ALTER INDEX user_events_pkey RENAME TO user_events_unpartitioned_pkey;
+ALTER SEQUENCE user_events_id_seq OWNED BY NONE;
+
+-- The partition key has to be part of the primary key
+CREATE TABLE user_events (
+    id INTEGER NOT NULL DEFAULT nextval('user_events_id_seq'),
+    user_id VARCHAR(255) CONSTRAINT user_events_user_id_fkey REFERENCES users(id),
+    item_id VARCHAR(255) CONSTRAINT user_events_item_id_fkey REFERENCES content_items(id),
+    event_type VARCHAR(50) NOT NULL,
+    duration_seconds INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    request_id VARCHAR(64),
+    event_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    quality_flags JSONB,
+    PRIMARY KEY (id, event_time)
+) PARTITION BY RANGE (event_time);
+
+CREATE TABLE user_events_default PARTITION OF user_events DEFAULT;
+
+-- Monthly partitions for the events already stored
+DO $$
+DECLARE
+    month TIMESTAMP;
+    last_month TIMESTAMP;
+BEGIN
+    SELECT date_trunc('month', MIN(event_time)), date_trunc('month', MAX(event_time))
+    INTO month, last_month
+    FROM user_events_unpartitioned;
+
+    WHILE month <= last_month LOOP
+        EXECUTE format(
+            'CREATE TABLE %I PARTITION OF user_events FOR VALUES FROM (%L) TO (%L)',
+            'user_events_p' || to_char(month, 'YYYYMM'), month, month + INTERVAL '1 month'
+        );
+        month := month + INTERVAL '1 month';
+    END LOOP;
+END $$;
+
+INSERT INTO user_events
+    (id, user_id, item_id, event_type, duration_seconds, created_at, request_id, event_time, quality_flags)
+SELECT id, user_id, item_id, event_type, duration_seconds, created_at, request_id, event_time, quality_flags
+FROM user_events_unpartitioned;
+
+DROP TABLE user_events_unpartitioned;
+ALTER SEQUENCE user_events_id_seq OWNED BY user_events.id;
+
+CREATE INDEX idx_user_events_user_id ON user_events(user_id);
+CREATE INDEX idx_user_events_item_id ON user_events(item_id);
+CREATE INDEX idx_user_events_created_at ON user_events(created_at);
+CREATE INDEX idx_user_events_request_id ON user_events(request_id);
+CREATE INDEX idx_user_events_event_time ON user_events(event_time);
+CREATE INDEX idx_user_events_user_event_time ON user_events(user_id, event_time DESC);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS category_rollup_users;
+DROP TABLE IF EXISTS item_rollup_users;
+DROP TABLE IF EXISTS category_hourly_rollups;
+DROP TABLE IF EXISTS item_hourly_rollups;
@@ -0,0 +1,48 @@
+-- Hourly engagement counters per item and per category, maintained
+-- incrementally by the API from accepted events
+CREATE TABLE item_hourly_rollups (
+    item_id VARCHAR(255) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    impressions BIGINT NOT NULL DEFAULT 0,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    recommended BIGINT NOT NULL DEFAULT 0,
+    dwell_seconds BIGINT NOT NULL DEFAULT 0,
+    dwell_events BIGINT NOT NULL DEFAULT 0,
+    unique_users BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (item_id, hour)
+);
+
+CREATE TABLE category_hourly_rollups (
+    category VARCHAR(100) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    impressions BIGINT NOT NULL DEFAULT 0,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    recommended BIGINT NOT NULL DEFAULT 0,
+    dwell_seconds BIGINT NOT NULL DEFAULT 0,
+    dwell_events BIGINT NOT NULL DEFAULT 0,
+    unique_users BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (category, hour)
+);
+
+-- Users already counted towards unique_users, kept only while late events
+-- for the hour can still arrive
+CREATE TABLE item_rollup_users (
+    item_id VARCHAR(255) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    PRIMARY KEY (item_id, hour, user_id)
+);
+
+CREATE TABLE category_rollup_users (
+    category VARCHAR(100) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    PRIMARY KEY (category, hour, user_id)
+);
+
+CREATE INDEX idx_item_hourly_rollups_hour ON item_hourly_rollups(hour);
+CREATE INDEX idx_category_hourly_rollups_hour ON category_hourly_rollups(hour);
+CREATE INDEX idx_item_rollup_users_hour ON item_rollup_users(hour);
+CREATE INDEX idx_category_rollup_users_hour ON category_rollup_users(hour);
@@ -0,0 +1,13 @@
+-- One row per user erasure. The user ID is kept only as a SHA-256 hash.
+CREATE TABLE erasure_audit (
+    id SERIAL PRIMARY KEY,
+    subject_hash CHAR(64) NOT NULL,
+    requested_by VARCHAR(255),
+    status VARCHAR(20) NOT NULL,
+    removed JSONB NOT NULL, -- rows or entries removed per location
+    errors JSONB,
+    requested_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_erasure_audit_subject_hash ON erasure_audit(subject_hash);
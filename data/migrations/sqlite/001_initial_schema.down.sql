@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS category_rollup_users;
+DROP TABLE IF EXISTS item_rollup_users;
+DROP TABLE IF EXISTS category_hourly_rollups;
+DROP TABLE IF EXISTS item_hourly_rollups;
+DROP TABLE IF EXISTS quarantined_events;
+DROP TABLE IF EXISTS recommendations_served;
+DROP TABLE IF EXISTS ab_test_assignments;
+DROP TABLE IF EXISTS user_events;
+DROP TABLE IF EXISTS content_items;
+DROP TABLE IF EXISTS users;
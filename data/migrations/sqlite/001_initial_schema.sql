@@ -0,0 +1,119 @@
+-- SQLite schema for single-node deployments, equivalent to the Postgres
+-- schema as of migration 007. JSON columns are stored as TEXT and
+-- timestamps as UTC text, which sorts in time order. user_events is not
+-- partitioned.
+CREATE TABLE users (
+    id VARCHAR(255) PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_active TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE content_items (
+    id VARCHAR(255) PRIMARY KEY,
+    title TEXT NOT NULL,
+    description TEXT,
+    category VARCHAR(100),
+    tags TEXT, -- JSON array
+    embedding_vector TEXT, -- JSON array of floats
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE TABLE user_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id VARCHAR(255) REFERENCES users(id),
+    item_id VARCHAR(255) REFERENCES content_items(id),
+    event_type VARCHAR(50) NOT NULL,
+    duration_seconds INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    request_id VARCHAR(64),
+    event_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    quality_flags TEXT -- JSON array
+);
+
+CREATE TABLE ab_test_assignments (
+    user_id VARCHAR(255) PRIMARY KEY,
+    experiment_name VARCHAR(255) NOT NULL,
+    variant VARCHAR(50) NOT NULL,
+    assigned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE recommendations_served (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    request_id VARCHAR(64),
+    user_id VARCHAR(255) REFERENCES users(id),
+    recommended_items TEXT NOT NULL, -- JSON array of item IDs
+    strategy VARCHAR(100) NOT NULL,
+    experiment_name VARCHAR(255),
+    ab_test_variant VARCHAR(50),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE quarantined_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id VARCHAR(255) NOT NULL,
+    item_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    duration_seconds INTEGER,
+    event_time TIMESTAMP NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    request_id VARCHAR(64),
+    user_agent TEXT,
+    reasons TEXT NOT NULL, -- JSON array
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE item_hourly_rollups (
+    item_id VARCHAR(255) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    impressions BIGINT NOT NULL DEFAULT 0,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    recommended BIGINT NOT NULL DEFAULT 0,
+    dwell_seconds BIGINT NOT NULL DEFAULT 0,
+    dwell_events BIGINT NOT NULL DEFAULT 0,
+    unique_users BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (item_id, hour)
+);
+
+CREATE TABLE category_hourly_rollups (
+    category VARCHAR(100) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    impressions BIGINT NOT NULL DEFAULT 0,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    recommended BIGINT NOT NULL DEFAULT 0,
+    dwell_seconds BIGINT NOT NULL DEFAULT 0,
+    dwell_events BIGINT NOT NULL DEFAULT 0,
+    unique_users BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (category, hour)
+);
+
+CREATE TABLE item_rollup_users (
+    item_id VARCHAR(255) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    PRIMARY KEY (item_id, hour, user_id)
+);
+
+CREATE TABLE category_rollup_users (
+    category VARCHAR(100) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    PRIMARY KEY (category, hour, user_id)
+);
+
+CREATE INDEX idx_content_items_category ON content_items(category) WHERE deleted_at IS NULL;
+CREATE INDEX idx_user_events_user_event_time ON user_events(user_id, event_time DESC);
+CREATE INDEX idx_user_events_item_id ON user_events(item_id);
+CREATE INDEX idx_user_events_event_time ON user_events(event_time);
+CREATE INDEX idx_user_events_request_id ON user_events(request_id);
+CREATE INDEX idx_ab_test_assignments_experiment ON ab_test_assignments(experiment_name);
+CREATE UNIQUE INDEX idx_recommendations_served_request_id ON recommendations_served(request_id);
+CREATE INDEX idx_quarantined_events_user_id ON quarantined_events(user_id);
+CREATE INDEX idx_quarantined_events_created_at ON quarantined_events(created_at);
+CREATE INDEX idx_item_hourly_rollups_hour ON item_hourly_rollups(hour);
+CREATE INDEX idx_category_hourly_rollups_hour ON category_hourly_rollups(hour);
+CREATE INDEX idx_item_rollup_users_hour ON item_rollup_users(hour);
+CREATE INDEX idx_category_rollup_users_hour ON category_rollup_users(hour);
@@ -0,0 +1,13 @@
+-- One row per user erasure. The user ID is kept only as a SHA-256 hash.
+CREATE TABLE erasure_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subject_hash CHAR(64) NOT NULL,
+    requested_by VARCHAR(255),
+    status VARCHAR(20) NOT NULL,
+    removed TEXT NOT NULL, -- JSON object of rows or entries removed per location
+    errors TEXT, -- JSON object
+    requested_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_erasure_audit_subject_hash ON erasure_audit(subject_hash);
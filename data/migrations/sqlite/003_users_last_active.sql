@@ -0,0 +1,2 @@
+-- Lets the cache warmer find recently active users without a full scan.
+CREATE INDEX IF NOT EXISTS idx_users_last_active ON users(last_active DESC);